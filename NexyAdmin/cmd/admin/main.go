@@ -106,6 +106,7 @@ func main() {
 	protected.HandleFunc("/stats/users", statsController.GetUserStats).Methods("GET")
 	protected.HandleFunc("/stats/chats", statsController.GetChatStats).Methods("GET")
 	protected.HandleFunc("/stats/messages", statsController.GetMessageStats).Methods("GET")
+	protected.HandleFunc("/stats/calls", statsController.GetCallStats).Methods("GET")
 
 	protected.HandleFunc("/backup/create", backupController.CreateBackup).Methods("POST")
 	protected.HandleFunc("/backup/list", backupController.ListBackups).Methods("GET")
@@ -116,6 +117,7 @@ func main() {
 	protected.HandleFunc("/diagnostics/health", diagnosticController.HealthCheck).Methods("GET")
 	protected.HandleFunc("/diagnostics/database", diagnosticController.DatabaseDiagnostics).Methods("GET")
 	protected.HandleFunc("/diagnostics/redis", diagnosticController.RedisDiagnostics).Methods("GET")
+	protected.HandleFunc("/diagnostics/dispatch", diagnosticController.DispatchDiagnostics).Methods("GET")
 	protected.HandleFunc("/diagnostics/system", diagnosticController.SystemInfo).Methods("GET")
 
 	router.PathPrefix("/").Handler(http.FileServer(http.Dir("./web")))
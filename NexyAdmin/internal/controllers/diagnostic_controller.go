@@ -48,6 +48,17 @@ func (c *DiagnosticController) RedisDiagnostics(w http.ResponseWriter, r *http.R
 	json.NewEncoder(w).Encode(diag)
 }
 
+func (c *DiagnosticController) DispatchDiagnostics(w http.ResponseWriter, r *http.Request) {
+	diag, err := c.service.GetDispatchDiagnostics(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diag)
+}
+
 func (c *DiagnosticController) SystemInfo(w http.ResponseWriter, r *http.Request) {
 	info, err := c.service.GetSystemInfo(r.Context())
 	if err != nil {
@@ -96,6 +96,33 @@ type TimeSeriesData struct {
 	Value int    `json:"value"`
 }
 
+// CallQualityDay aggregates the stats summaries clients posted for calls
+// on one day
+type CallQualityDay struct {
+	Date          string  `json:"date"`
+	Reports       int     `json:"reports"`
+	AvgRTTMs      float64 `json:"avg_rtt_ms"`
+	AvgJitterMs   float64 `json:"avg_jitter_ms"`
+	AvgPacketLoss float64 `json:"avg_packet_loss"`
+	AvgBitrate    float64 `json:"avg_bitrate_kbps"`
+	RelayReports  int     `json:"relay_reports"`
+}
+
+// CallQualityByPath compares relayed (TURN) and direct media
+type CallQualityByPath struct {
+	Relay         bool    `json:"relay"`
+	Reports       int     `json:"reports"`
+	AvgRTTMs      float64 `json:"avg_rtt_ms"`
+	AvgJitterMs   float64 `json:"avg_jitter_ms"`
+	AvgPacketLoss float64 `json:"avg_packet_loss"`
+	AvgBitrate    float64 `json:"avg_bitrate_kbps"`
+}
+
+type CallQualityStats struct {
+	Daily  []CallQualityDay    `json:"daily"`
+	ByPath []CallQualityByPath `json:"by_path"`
+}
+
 type BackupInfo struct {
 	Filename  string    `json:"filename"`
 	Size      int64     `json:"size"`
@@ -125,6 +152,22 @@ type RedisDiagnostics struct {
 	KeyCount         int64  `json:"key_count"`
 }
 
+// DispatchDiagnostics mirrors the worker pool stats each NexyServer node
+// publishes to Redis on every heartbeat
+type DispatchDiagnostics struct {
+	NodeID        string  `json:"node_id"`
+	Workers       int     `json:"workers"`
+	QueueCapacity int     `json:"queue_capacity"`
+	QueueDepth    int     `json:"queue_depth"`
+	MaxQueueDepth int     `json:"max_queue_depth"`
+	Processed     int64   `json:"processed"`
+	AvgWaitMs     float64 `json:"avg_wait_ms"`
+	AvgHandleMs   float64 `json:"avg_handle_ms"`
+	MaxWaitMs     float64 `json:"max_wait_ms"`
+	MaxHandleMs   float64 `json:"max_handle_ms"`
+	Timestamp     int64   `json:"timestamp"`
+}
+
 type SystemDiagnostics struct {
 	Uptime       string `json:"uptime"`
 	GoVersion    string `json:"go_version"`
@@ -146,3 +146,68 @@ func (r *StatsRepository) GetChatStats(ctx context.Context) (map[string]int, err
 
 	return stats, nil
 }
+
+func (r *StatsRepository) GetCallQuality(ctx context.Context, days int) (*models.CallQualityStats, error) {
+	stats := &models.CallQualityStats{
+		Daily:  []models.CallQualityDay{},
+		ByPath: []models.CallQualityByPath{},
+	}
+
+	query := `
+		SELECT DATE(created_at) as date, COUNT(*),
+		       COALESCE(AVG(rtt_ms), 0), COALESCE(AVG(jitter_ms), 0),
+		       COALESCE(AVG(packet_loss), 0), COALESCE(AVG(bitrate_kbps), 0),
+		       COUNT(*) FILTER (WHERE candidate_type = 'relay')
+		FROM call_quality
+		WHERE created_at >= NOW() - INTERVAL '1 day' * $1
+		GROUP BY DATE(created_at)
+		ORDER BY date ASC`
+
+	rows, err := r.db.QueryContext(ctx, query, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.CallQualityDay
+		var date time.Time
+		err := rows.Scan(&date, &item.Reports, &item.AvgRTTMs, &item.AvgJitterMs,
+			&item.AvgPacketLoss, &item.AvgBitrate, &item.RelayReports)
+		if err != nil {
+			return nil, err
+		}
+		item.Date = date.Format("2006-01-02")
+		stats.Daily = append(stats.Daily, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT candidate_type = 'relay' as relay, COUNT(*),
+		       COALESCE(AVG(rtt_ms), 0), COALESCE(AVG(jitter_ms), 0),
+		       COALESCE(AVG(packet_loss), 0), COALESCE(AVG(bitrate_kbps), 0)
+		FROM call_quality
+		WHERE created_at >= NOW() - INTERVAL '1 day' * $1
+		GROUP BY relay
+		ORDER BY relay ASC`
+
+	pathRows, err := r.db.QueryContext(ctx, query, days)
+	if err != nil {
+		return nil, err
+	}
+	defer pathRows.Close()
+
+	for pathRows.Next() {
+		var item models.CallQualityByPath
+		err := pathRows.Scan(&item.Relay, &item.Reports, &item.AvgRTTMs, &item.AvgJitterMs,
+			&item.AvgPacketLoss, &item.AvgBitrate)
+		if err != nil {
+			return nil, err
+		}
+		stats.ByPath = append(stats.ByPath, item)
+	}
+
+	return stats, pathRows.Err()
+}
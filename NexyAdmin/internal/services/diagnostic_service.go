@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"runtime"
 	"time"
 
@@ -99,6 +100,29 @@ func (s *DiagnosticService) GetRedisDiagnostics(ctx context.Context) (*models.Re
 	return diag, nil
 }
 
+// GetDispatchDiagnostics returns the WebSocket worker pool stats of every live server node
+func (s *DiagnosticService) GetDispatchDiagnostics(ctx context.Context) ([]models.DispatchDiagnostics, error) {
+	nodes := []models.DispatchDiagnostics{}
+
+	iter := s.redisClient.Scan(ctx, 0, "nexy:cluster:dispatch:*", 100).Iterator()
+	for iter.Next(ctx) {
+		data, err := s.redisClient.Get(ctx, iter.Val()).Bytes()
+		if err != nil {
+			continue
+		}
+
+		var node models.DispatchDiagnostics
+		if err := json.Unmarshal(data, &node); err == nil {
+			nodes = append(nodes, node)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	return nodes, nil
+}
+
 func (s *DiagnosticService) GetSystemInfo(ctx context.Context) (*models.SystemDiagnostics, error) {
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
@@ -50,3 +50,7 @@ func (s *StatsService) GetChatStats(ctx context.Context) (map[string]int, error)
 func (s *StatsService) GetMessageStats(ctx context.Context, days int) ([]models.TimeSeriesData, error) {
 	return s.repo.GetMessageActivity(ctx, days)
 }
+
+func (s *StatsService) GetCallQuality(ctx context.Context, days int) (*models.CallQualityStats, error) {
+	return s.repo.GetCallQuality(ctx, days)
+}
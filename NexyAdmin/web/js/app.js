@@ -89,13 +89,45 @@ const DashboardView = {
                         <canvas ref="messageChart"></canvas>
                     </div>
                 </div>
+
+                <div class="card">
+                    <div class="card-header">
+                        <h2>Call Quality (Last 30 Days)</h2>
+                    </div>
+                    <div class="chart-container">
+                        <canvas ref="callChart"></canvas>
+                    </div>
+                    <table v-if="callStats.by_path && callStats.by_path.length">
+                        <thead>
+                            <tr>
+                                <th>Path</th>
+                                <th>Reports</th>
+                                <th>Avg RTT</th>
+                                <th>Avg Jitter</th>
+                                <th>Avg Packet Loss</th>
+                                <th>Avg Bitrate</th>
+                            </tr>
+                        </thead>
+                        <tbody>
+                            <tr v-for="path in callStats.by_path" :key="path.relay">
+                                <td>{{ path.relay ? 'Relay (TURN)' : 'Direct' }}</td>
+                                <td>{{ path.reports }}</td>
+                                <td>{{ path.avg_rtt_ms.toFixed(0) }} ms</td>
+                                <td>{{ path.avg_jitter_ms.toFixed(0) }} ms</td>
+                                <td>{{ path.avg_packet_loss.toFixed(2) }}%</td>
+                                <td>{{ path.avg_bitrate_kbps.toFixed(0) }} kbps</td>
+                            </tr>
+                        </tbody>
+                    </table>
+                </div>
             </div>
         </div>
     `,
     data() {
         return {
             loading: true,
-            stats: {}
+            stats: {},
+            callStats: {}
         };
     },
     async mounted() {
@@ -106,6 +138,12 @@ const DashboardView = {
             try {
                 const { data } = await api.get('/stats/overview');
                 this.stats = data;
+                try {
+                    const calls = await api.get('/stats/calls');
+                    this.callStats = calls.data;
+                } catch (error) {
+                    console.error('Failed to load call stats:', error);
+                }
                 this.$nextTick(() => {
                     this.renderCharts();
                 });
@@ -159,6 +197,44 @@ const DashboardView = {
                     }
                 });
             }
+
+            if (this.callStats.daily && this.$refs.callChart) {
+                new Chart(this.$refs.callChart, {
+                    type: 'line',
+                    data: {
+                        labels: this.callStats.daily.map(d => d.date),
+                        datasets: [{
+                            label: 'Avg RTT (ms)',
+                            data: this.callStats.daily.map(d => d.avg_rtt_ms),
+                            borderColor: '#4299e1',
+                            backgroundColor: 'rgba(66, 153, 225, 0.1)',
+                            tension: 0.4
+                        }, {
+                            label: 'Avg Packet Loss (%)',
+                            data: this.callStats.daily.map(d => d.avg_packet_loss),
+                            borderColor: '#e53e3e',
+                            backgroundColor: 'rgba(229, 62, 62, 0.1)',
+                            tension: 0.4,
+                            yAxisID: 'loss'
+                        }, {
+                            label: 'Relayed (%)',
+                            data: this.callStats.daily.map(d => d.reports ? d.relay_reports * 100 / d.reports : 0),
+                            borderColor: '#ed8936',
+                            backgroundColor: 'rgba(237, 137, 54, 0.1)',
+                            tension: 0.4,
+                            yAxisID: 'loss'
+                        }]
+                    },
+                    options: {
+                        responsive: true,
+                        maintainAspectRatio: false,
+                        scales: {
+                            y: { position: 'left', beginAtZero: true },
+                            loss: { position: 'right', beginAtZero: true, grid: { drawOnChartArea: false } }
+                        }
+                    }
+                });
+            }
         }
     }
 };
@@ -4,6 +4,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 
@@ -14,6 +15,7 @@ import (
 	"github.com/vtstv/nexy/internal/repositories"
 	"github.com/vtstv/nexy/internal/routes"
 	"github.com/vtstv/nexy/internal/services"
+	"github.com/vtstv/nexy/internal/signaling"
 	nexy "github.com/vtstv/nexy/internal/ws"
 )
 
@@ -47,6 +49,8 @@ func main() {
 	folderRepo := repositories.NewFolderRepository(db)
 	syncRepo := repositories.NewSyncRepository(db.DB)
 	reactionRepo := repositories.NewReactionRepository(db.DB)
+	callRepo := repositories.NewCallRepository(db.DB)
+	scheduledRepo := repositories.NewScheduledMessageRepository(db.DB)
 
 	authService := services.NewAuthService(userRepo, refreshTokenRepo, &cfg.JWT)
 	userService := services.NewUserService(userRepo, chatRepo, messageRepo)
@@ -55,6 +59,8 @@ func main() {
 	inviteService := services.NewInviteService(inviteRepo)
 	fileService := services.NewFileService(fileRepo, &cfg.Upload)
 	messageService := services.NewMessageService(messageRepo, chatRepo, userRepo, reactionRepo, fileService)
+	messageService.SetEditWindow(cfg.Messages.EditWindow)
+	messageService.SetDeleteWindow(cfg.Messages.DeleteWindow)
 	qrService := services.NewQRService()
 	e2eService := services.NewE2EService(e2eRepo)
 	onlineStatusService := services.NewOnlineStatusService(userRepo)
@@ -62,11 +68,34 @@ func main() {
 	syncService := services.NewSyncService(syncRepo)
 	fcmService := services.NewFcmService(cfg, userRepo)
 	reactionService := services.NewReactionService(reactionRepo, messageRepo, chatRepo)
+	chatAccessService := services.NewChatAccessService(chatRepo)
+	mentionService := services.NewMentionService(messageRepo)
+	callService := services.NewCallService(callRepo, chatRepo, messageRepo)
+	turnService := services.NewTURNService(&cfg.TURN)
+	scheduledService := services.NewScheduledMessageService(scheduledRepo, chatRepo)
+	expiryService := services.NewMessageExpiryService(messageRepo, chatRepo, userRepo, fileService)
 
 	nexyChatRepo := nexy.NewNexyChatRepo(chatRepo)
 	nexy.SetAllowedOrigins(cfg.CORS.AllowedOrigins)
 	hub := nexy.NewHub(redisClient.Client, messageRepo, nexyChatRepo, userRepo, fcmService)
+	hub.SetAuthorizer(chatAccessService)
+	hub.SetMentionResolver(mentionService)
+	hub.SetDispatchSize(cfg.WS.DispatchWorkers, cfg.WS.DispatchQueueSize)
+	hub.SetPresenceService(onlineStatusService)
+	signalingHandler := signaling.NewSignalingHandler(hub, redisClient.Client, sessionRepo, chatRepo)
+	signalingHandler.SetRecorder(callService)
+	signalingHandler.SetPushNotifier(fcmService)
+	hub.SetCallHandler(signalingHandler)
+	hub.SetForwarder(messageService)
+	hub.SetPollVoter(messageService)
+	hub.SetLiveLocations(messageService)
+	hub.SetMessageEditor(messageService)
+	callService.SetPublisher(hub)
+	scheduledService.SetSender(hub)
+	expiryService.SetPublisher(hub)
 	go hub.Run()
+	go scheduledService.RunDispatcher(context.Background())
+	go expiryService.RunSweeper(context.Background())
 
 	// Wire up online status service and hub to contact service
 	contactService.SetOnlineStatusService(onlineStatusService)
@@ -82,19 +111,23 @@ func main() {
 
 	authController := controllers.NewAuthController(authService, sessionRepo, folderRepo)
 	userController := controllers.NewUserController(userService, qrService)
+	userController.SetPresencePublisher(hub)
 	groupController := controllers.NewGroupController(groupService, hub)
 	inviteController := controllers.NewInviteController(inviteService)
 	messageController := controllers.NewMessageController(messageService, hub)
 	fileController := controllers.NewFileController(fileService)
 	e2eController := controllers.NewE2EController(e2eService)
 	contactController := controllers.NewContactController(contactService)
-	turnController := controllers.NewTURNController(cfg)
+	turnController := controllers.NewTURNController(turnService)
 	sessionController := controllers.NewSessionController(sessionRepo, refreshTokenRepo)
 	sessionController.SetNotifier(hub)
 	folderController := controllers.NewFolderController(folderRepo)
 	syncController := controllers.NewSyncController(syncService)
 	fcmController := controllers.NewFcmController(fcmService)
 	reactionController := controllers.NewReactionController(reactionService, hub)
+	callController := controllers.NewCallController(callService)
+	scheduleController := controllers.NewScheduledMessageController(scheduledService)
+	expiryController := controllers.NewMessageExpiryController(expiryService)
 
 	wsHandler := nexy.NewWSHandler(hub)
 	wsController := controllers.NewWSController(wsHandler, authService)
@@ -119,6 +152,9 @@ func main() {
 		syncController,
 		fcmController,
 		reactionController,
+		callController,
+		scheduleController,
+		expiryController,
 		authMiddleware,
 		corsMiddleware,
 		rateLimiter,
@@ -21,6 +21,8 @@ type Config struct {
 	RateLimit RateLimitConfig
 	TURN      TURNConfig
 	FCM       FCMConfig
+	WS        WSConfig
+	Messages  MessagesConfig
 }
 
 type ServerConfig struct {
@@ -74,10 +76,32 @@ type RateLimitConfig struct {
 }
 
 type TURNConfig struct {
-	ServerURL     string
-	Username      string
-	Password      string
-	STUNServerURL string
+	// Secret is coturn's static-auth-secret. Clients get short-lived
+	// credentials derived from it instead of a shared password.
+	Secret        string
+	CredentialTTL time.Duration
+	Servers       []ICEServerConfig
+}
+
+// ICEServerConfig is one STUN/TURN server entry handed to clients. Region is
+// a hint clients can use to prefer nearby relays.
+type ICEServerConfig struct {
+	URLs   []string
+	Region string
+}
+
+type WSConfig struct {
+	DispatchWorkers   int
+	DispatchQueueSize int
+}
+
+// MessagesConfig holds limits on what users may do with sent messages
+type MessagesConfig struct {
+	// EditWindow is how long after sending a message can be edited, 0 for no limit
+	EditWindow time.Duration
+	// DeleteWindow is how long after sending a sender can delete a message for
+	// everyone, 0 for no limit
+	DeleteWindow time.Duration
 }
 
 type FCMConfig struct {
@@ -120,6 +144,40 @@ func Load() (*Config, error) {
 		rateLimitWindow = 60
 	}
 
+	turnCredentialTTL, err := time.ParseDuration(getEnv("TURN_CREDENTIAL_TTL", "12h"))
+	if err != nil {
+		turnCredentialTTL = 12 * time.Hour
+	}
+
+	// TURN_SERVERS lists every server; the single-server variables are the fallback
+	iceServers := parseICEServers(getEnv("TURN_SERVERS", ""))
+	if len(iceServers) == 0 {
+		iceServers = []ICEServerConfig{
+			{URLs: []string{getEnv("STUN_SERVER_URL", "stun:localhost:3478")}},
+			{URLs: []string{getEnv("TURN_SERVER_URL", "turn:localhost:3478")}},
+		}
+	}
+
+	dispatchWorkers, err := strconv.Atoi(getEnv("WS_DISPATCH_WORKERS", "32"))
+	if err != nil {
+		dispatchWorkers = 32
+	}
+
+	dispatchQueueSize, err := strconv.Atoi(getEnv("WS_DISPATCH_QUEUE_SIZE", "256"))
+	if err != nil {
+		dispatchQueueSize = 256
+	}
+
+	editWindow, err := time.ParseDuration(getEnv("MESSAGE_EDIT_WINDOW", "48h"))
+	if err != nil {
+		editWindow = 48 * time.Hour
+	}
+
+	deleteWindow, err := time.ParseDuration(getEnv("MESSAGE_DELETE_WINDOW", "48h"))
+	if err != nil {
+		deleteWindow = 48 * time.Hour
+	}
+
 	allowedMimeTypes := strings.Split(getEnv("ALLOWED_MIME_TYPES", "image/jpeg,image/png,image/gif,image/webp,video/mp4,audio/mpeg,application/pdf"), ",")
 	allowedOrigins := strings.Split(getEnv("CORS_ALLOWED_ORIGINS", "http://localhost:3000"), ",")
 
@@ -167,15 +225,22 @@ func Load() (*Config, error) {
 			Window:   rateLimitWindow,
 		},
 		TURN: TURNConfig{
-			ServerURL:     getEnv("TURN_SERVER_URL", "turn:localhost:3478"),
-			Username:      getEnv("TURN_USERNAME", "nexy"),
-			Password:      getEnv("TURN_PASSWORD", "nexy_turn_password"),
-			STUNServerURL: getEnv("STUN_SERVER_URL", "stun:localhost:3478"),
+			Secret:        getEnv("TURN_SECRET", ""),
+			CredentialTTL: turnCredentialTTL,
+			Servers:       iceServers,
 		},
 		FCM: FCMConfig{
 			Enabled:               getEnv("FCM_ENABLED", "false") == "true",
 			ServiceAccountKeyPath: getEnv("FCM_SERVICE_ACCOUNT_KEY", "./firebase-service-account.json"),
 		},
+		WS: WSConfig{
+			DispatchWorkers:   dispatchWorkers,
+			DispatchQueueSize: dispatchQueueSize,
+		},
+		Messages: MessagesConfig{
+			EditWindow:   editWindow,
+			DeleteWindow: deleteWindow,
+		},
 	}, nil
 }
 
@@ -194,3 +259,33 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// parseICEServers reads TURN_SERVERS, a ';' separated list of servers. Each
+// server is a ',' separated list of URLs, optionally prefixed by a region:
+//
+//	eu=turn:eu.example.com:3478,turns:eu.example.com:5349;us=turn:us.example.com:3478
+func parseICEServers(value string) []ICEServerConfig {
+	var servers []ICEServerConfig
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		var server ICEServerConfig
+		// URLs may carry "?transport=tcp", so only a prefix without a scheme is a region
+		if region, urls, ok := strings.Cut(entry, "="); ok && !strings.Contains(region, ":") {
+			server.Region = strings.TrimSpace(region)
+			entry = urls
+		}
+		for _, url := range strings.Split(entry, ",") {
+			if url = strings.TrimSpace(url); url != "" {
+				server.URLs = append(server.URLs, url)
+			}
+		}
+		if len(server.URLs) > 0 {
+			servers = append(servers, server)
+		}
+	}
+	return servers
+}
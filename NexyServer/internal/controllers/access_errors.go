@@ -0,0 +1,27 @@
+/*
+ * © 2025 Murr | https://github.com/vtstv
+ */
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/vtstv/nexy/internal/services"
+)
+
+// writeAccessError answers with 404 or 403 when err is a chat access refusal
+// and reports whether it did
+func writeAccessError(w http.ResponseWriter, err error) bool {
+	var accessErr *services.AccessError
+	if !errors.As(err, &accessErr) {
+		return false
+	}
+
+	status := http.StatusForbidden
+	if accessErr.Code == services.AccessChatNotFound {
+		status = http.StatusNotFound
+	}
+	http.Error(w, accessErr.Message, status)
+	return true
+}
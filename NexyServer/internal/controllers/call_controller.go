@@ -0,0 +1,110 @@
+/*
+ * © 2025 Murr | https://github.com/vtstv
+ */
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/vtstv/nexy/internal/middleware"
+	"github.com/vtstv/nexy/internal/models"
+	"github.com/vtstv/nexy/internal/services"
+)
+
+type CallController struct {
+	callService *services.CallService
+}
+
+func NewCallController(callService *services.CallService) *CallController {
+	return &CallController{callService: callService}
+}
+
+// GetCallHistory lists the user's placed and received calls, newest first
+func (c *CallController) GetCallHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit := 50
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil {
+			limit = l
+		}
+	}
+
+	offset := 0
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil {
+			offset = o
+		}
+	}
+
+	calls, err := c.callService.GetCallHistory(r.Context(), userID, limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if calls == nil {
+		calls = []*models.Call{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(calls)
+}
+
+type CallQualityRequest struct {
+	RTTMs         *int     `json:"rtt_ms"`
+	JitterMs      *int     `json:"jitter_ms"`
+	PacketLoss    *float64 `json:"packet_loss"`
+	BitrateKbps   *int     `json:"bitrate_kbps"`
+	CandidateType string   `json:"candidate_type"`
+}
+
+// ReportQuality stores the client's WebRTC stats summary for a finished call.
+// The call is recorded shortly after hangup, so a 404 right after the call
+// ended is worth one retry.
+func (c *CallController) ReportQuality(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req CallQualityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	report := &models.CallQualityReport{
+		CallID:        mux.Vars(r)["callId"],
+		UserID:        userID,
+		RTTMs:         req.RTTMs,
+		JitterMs:      req.JitterMs,
+		PacketLoss:    req.PacketLoss,
+		BitrateKbps:   req.BitrateKbps,
+		CandidateType: req.CandidateType,
+	}
+
+	if err := c.callService.RecordQuality(r.Context(), report); err != nil {
+		switch err.Error() {
+		case "call not found":
+			http.Error(w, "Call not found", http.StatusNotFound)
+		case "invalid candidate type", "invalid stats":
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(report)
+}
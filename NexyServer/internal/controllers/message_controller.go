@@ -5,6 +5,7 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -62,6 +63,9 @@ func (c *MessageController) GetChatHistory(w http.ResponseWriter, r *http.Reques
 
 	messages, err := c.messageService.GetChatHistory(r.Context(), chatID, userID, limit, offset)
 	if err != nil {
+		if writeAccessError(w, err) {
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -84,6 +88,7 @@ func (c *MessageController) DeleteMessage(w http.ResponseWriter, r *http.Request
 
 	var req struct {
 		MessageID string `json:"message_id"`
+		ForMe     bool   `json:"for_me"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -96,14 +101,17 @@ func (c *MessageController) DeleteMessage(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	msg, err := c.messageService.DeleteMessage(r.Context(), req.MessageID, userID)
+	msg, err := c.messageService.DeleteMessage(r.Context(), req.MessageID, userID, req.ForMe)
 	if err != nil {
+		if writeAccessError(w, err) {
+			return
+		}
 		if err.Error() == "message not found" {
 			http.Error(w, "Message not found", http.StatusNotFound)
 			return
 		}
-		if err.Error() == "unauthorized" {
-			http.Error(w, "Unauthorized", http.StatusForbidden)
+		if err.Error() == "delete window has expired" {
+			http.Error(w, err.Error(), http.StatusForbidden)
 			return
 		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -111,7 +119,11 @@ func (c *MessageController) DeleteMessage(w http.ResponseWriter, r *http.Request
 	}
 
 	if c.hub != nil {
-		c.hub.BroadcastDelete(msg)
+		if req.ForMe {
+			c.hub.BroadcastHide(userID, msg)
+		} else {
+			c.hub.BroadcastDelete(msg)
+		}
 	}
 
 	w.WriteHeader(http.StatusNoContent)
@@ -132,20 +144,33 @@ func (c *MessageController) UpdateMessage(w http.ResponseWriter, r *http.Request
 	}
 
 	var req struct {
-		Content string `json:"content"`
+		Content  string                 `json:"content"`
+		Mentions []models.MentionEntity `json:"mentions"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if req.Content == "" {
-		http.Error(w, "Content cannot be empty", http.StatusBadRequest)
-		return
-	}
-
-	msg, err := c.messageService.UpdateMessage(r.Context(), messageID, userID, req.Content)
+	msg, err := c.messageService.UpdateMessage(r.Context(), messageID, userID, req.Content, req.Mentions)
 	if err != nil {
+		if writeAccessError(w, err) {
+			return
+		}
+		var bodyErr *models.MessageBodyError
+		if errors.As(err, &bodyErr) {
+			http.Error(w, bodyErr.Message, http.StatusBadRequest)
+			return
+		}
+		// Refused mentions
+		if _, ok := err.(interface{ ErrorCode() string }); ok {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err.Error() == "edit window has expired" {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -180,6 +205,9 @@ func (c *MessageController) SearchMessages(w http.ResponseWriter, r *http.Reques
 
 	messages, err := c.messageService.SearchMessages(r.Context(), chatID, userID, query)
 	if err != nil {
+		if writeAccessError(w, err) {
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -223,6 +251,9 @@ func (c *MessageController) GetMessageByID(w http.ResponseWriter, r *http.Reques
 			http.Error(w, "Message not found", http.StatusNotFound)
 			return
 		}
+		if writeAccessError(w, err) {
+			return
+		}
 		if err.Error() == "unauthorized" {
 			http.Error(w, "Unauthorized", http.StatusForbidden)
 			return
@@ -234,3 +265,422 @@ func (c *MessageController) GetMessageByID(w http.ResponseWriter, r *http.Reques
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(message)
 }
+
+func (c *MessageController) ForwardMessages(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		MessageIDs []string `json:"message_ids"`
+		ChatIDs    []int    `json:"chat_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	messages, err := c.messageService.ForwardMessages(r.Context(), userID, req.MessageIDs, req.ChatIDs)
+	if err != nil {
+		if writeAccessError(w, err) {
+			return
+		}
+		switch err.Error() {
+		case "message not found":
+			http.Error(w, "Message not found", http.StatusNotFound)
+		case "no messages to forward", "too many messages to forward", "no target chats", "too many target chats",
+			"system messages cannot be forwarded", "polls cannot be forwarded", "locations cannot be forwarded",
+			"message cannot be forwarded":
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case "recipient has disabled voice messages":
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if c.hub != nil {
+		for _, msg := range messages {
+			c.hub.BroadcastMessage(msg)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(messages)
+}
+
+func (c *MessageController) PinMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	chatID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid chat ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		MessageID string `json:"message_id"`
+		ForMe     bool   `json:"for_me"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.MessageID == "" {
+		http.Error(w, "Missing message_id", http.StatusBadRequest)
+		return
+	}
+
+	pin, system, err := c.messageService.PinMessage(r.Context(), chatID, userID, req.MessageID, req.ForMe)
+	if err != nil {
+		writePinError(w, err)
+		return
+	}
+
+	if c.hub != nil {
+		if system != nil {
+			c.hub.BroadcastSystemMessage(system)
+		}
+		c.hub.BroadcastPin(userID, pin.Message, pin.ForMe)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(pin)
+}
+
+func (c *MessageController) UnpinMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	chatID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid chat ID", http.StatusBadRequest)
+		return
+	}
+	forMe := r.URL.Query().Get("for_me") == "true"
+
+	msg, err := c.messageService.UnpinMessage(r.Context(), chatID, userID, vars["messageId"], forMe)
+	if err != nil {
+		writePinError(w, err)
+		return
+	}
+
+	if c.hub != nil {
+		c.hub.BroadcastUnpin(userID, msg, forMe)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writePinError(w http.ResponseWriter, err error) {
+	if writeAccessError(w, err) {
+		return
+	}
+	switch err.Error() {
+	case "message not found", "message not pinned":
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case "message already pinned":
+		http.Error(w, err.Error(), http.StatusConflict)
+	case "system messages cannot be pinned", "pins for one side are only available in private chats":
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (c *MessageController) GetReplies(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit := 50
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil {
+			limit = l
+		}
+	}
+
+	offset := 0
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil {
+			offset = o
+		}
+	}
+
+	replies, err := c.messageService.GetReplies(r.Context(), mux.Vars(r)["messageId"], userID, limit, offset)
+	if err != nil {
+		if err.Error() == "message not found" {
+			http.Error(w, "Message not found", http.StatusNotFound)
+			return
+		}
+		if writeAccessError(w, err) {
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if replies == nil {
+		replies = []*models.Message{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(replies)
+}
+
+func (c *MessageController) MarkThreadRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// An empty body marks the whole thread read
+	var req struct {
+		LastReadReplyID int `json:"last_read_reply_id"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	thread, err := c.messageService.MarkThreadRead(r.Context(), mux.Vars(r)["messageId"], userID, req.LastReadReplyID)
+	if err != nil {
+		if err.Error() == "message not found" {
+			http.Error(w, "Message not found", http.StatusNotFound)
+			return
+		}
+		if writeAccessError(w, err) {
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(thread)
+}
+
+func (c *MessageController) GetEditHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	edits, err := c.messageService.GetEditHistory(r.Context(), mux.Vars(r)["messageId"], userID)
+	if err != nil {
+		if err.Error() == "message not found" {
+			http.Error(w, "Message not found", http.StatusNotFound)
+			return
+		}
+		if writeAccessError(w, err) {
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if edits == nil {
+		edits = []*models.MessageEdit{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(edits)
+}
+
+// NextUnreadMention jumps to the oldest unread mention of the user in the
+// chat after the after_id message, marking it read
+func (c *MessageController) NextUnreadMention(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	chatID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid chat ID", http.StatusBadRequest)
+		return
+	}
+
+	afterID := 0
+	if afterStr := r.URL.Query().Get("after_id"); afterStr != "" {
+		if afterID, err = strconv.Atoi(afterStr); err != nil {
+			http.Error(w, "Invalid after_id", http.StatusBadRequest)
+			return
+		}
+	}
+
+	msg, remaining, err := c.messageService.NextUnreadMention(r.Context(), chatID, userID, afterID)
+	if err != nil {
+		if writeAccessError(w, err) {
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":   msg,
+		"remaining": remaining,
+	})
+}
+
+func (c *MessageController) VotePoll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Options []int `json:"options"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := c.messageService.VotePoll(r.Context(), mux.Vars(r)["messageId"], userID, req.Options)
+	if err != nil {
+		writePollError(w, err)
+		return
+	}
+
+	if c.hub != nil {
+		c.hub.BroadcastPollUpdate(msg, userID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg.Poll)
+}
+
+func (c *MessageController) ClosePoll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	msg, err := c.messageService.ClosePoll(r.Context(), mux.Vars(r)["messageId"], userID)
+	if err != nil {
+		writePollError(w, err)
+		return
+	}
+
+	if c.hub != nil {
+		c.hub.BroadcastPollUpdate(msg, userID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg.Poll)
+}
+
+func writePollError(w http.ResponseWriter, err error) {
+	if writeAccessError(w, err) {
+		return
+	}
+	switch err.Error() {
+	case "message not found":
+		http.Error(w, "Message not found", http.StatusNotFound)
+	case "poll is closed", "quiz already answered":
+		http.Error(w, err.Error(), http.StatusConflict)
+	case "message is not a poll", "quiz answers cannot be withdrawn", "only one option can be chosen", "invalid poll option":
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (c *MessageController) UpdateLiveLocation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+		Accuracy  *float64 `json:"accuracy"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Latitude == nil || req.Longitude == nil {
+		http.Error(w, "latitude and longitude are required", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := c.messageService.UpdateLiveLocation(r.Context(), mux.Vars(r)["messageId"], userID, *req.Latitude, *req.Longitude, req.Accuracy)
+	if err != nil {
+		writeLocationError(w, err)
+		return
+	}
+
+	if c.hub != nil {
+		c.hub.BroadcastLocation(msg)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg.Location)
+}
+
+func (c *MessageController) StopLiveLocation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	msg, err := c.messageService.StopLiveLocation(r.Context(), mux.Vars(r)["messageId"], userID)
+	if err != nil {
+		writeLocationError(w, err)
+		return
+	}
+
+	if c.hub != nil {
+		c.hub.BroadcastLocation(msg)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg.Location)
+}
+
+func writeLocationError(w http.ResponseWriter, err error) {
+	if writeAccessError(w, err) {
+		return
+	}
+	switch err.Error() {
+	case "message not found":
+		http.Error(w, "Message not found", http.StatusNotFound)
+	case "only the sender can share their location":
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case "live location has ended":
+		http.Error(w, err.Error(), http.StatusConflict)
+	case "message is not a location", "invalid coordinates":
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,62 @@
+/*
+ * © 2025 Murr | https://github.com/vtstv
+ */
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/vtstv/nexy/internal/middleware"
+	"github.com/vtstv/nexy/internal/services"
+)
+
+type MessageExpiryController struct {
+	expiryService *services.MessageExpiryService
+}
+
+func NewMessageExpiryController(expiryService *services.MessageExpiryService) *MessageExpiryController {
+	return &MessageExpiryController{expiryService: expiryService}
+}
+
+// SetChatTTL sets the chat's auto-delete timer in seconds. Allowed values are
+// one day, one week and 30 days, or 0 to turn it off.
+func (c *MessageExpiryController) SetChatTTL(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	chatID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid chat ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		TTL int `json:"ttl"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := c.expiryService.SetChatTTL(r.Context(), chatID, userID, req.TTL)
+	if err != nil {
+		if writeAccessError(w, err) {
+			return
+		}
+		if err.Error() == "invalid ttl" {
+			http.Error(w, "ttl must be 0, 86400, 604800 or 2592000", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg)
+}
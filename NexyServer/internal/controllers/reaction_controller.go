@@ -53,6 +53,9 @@ func (c *ReactionController) AddReaction(w http.ResponseWriter, r *http.Request)
 	result, err := c.reactionService.AddReaction(r.Context(), req.MessageID, userID, req.Emoji)
 	if err != nil {
 		log.Printf("AddReaction error: %v", err)
+		if writeAccessError(w, err) {
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -90,6 +93,9 @@ func (c *ReactionController) RemoveReaction(w http.ResponseWriter, r *http.Reque
 
 	chatID, err := c.reactionService.RemoveReaction(r.Context(), req.MessageID, userID, req.Emoji)
 	if err != nil {
+		if writeAccessError(w, err) {
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
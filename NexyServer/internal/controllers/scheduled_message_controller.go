@@ -0,0 +1,176 @@
+/*
+ * © 2025 Murr | https://github.com/vtstv
+ */
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/vtstv/nexy/internal/middleware"
+	"github.com/vtstv/nexy/internal/models"
+	"github.com/vtstv/nexy/internal/services"
+)
+
+type ScheduledMessageController struct {
+	scheduledService *services.ScheduledMessageService
+}
+
+func NewScheduledMessageController(scheduledService *services.ScheduledMessageService) *ScheduledMessageController {
+	return &ScheduledMessageController{scheduledService: scheduledService}
+}
+
+// ScheduleMessageRequest carries a chat_message body to post at SendAt. The
+// response holds the message_id the message will be sent with.
+type ScheduleMessageRequest struct {
+	ChatID int             `json:"chat_id"`
+	Body   json.RawMessage `json:"body"`
+	SendAt time.Time       `json:"send_at"`
+}
+
+type UpdateScheduledMessageRequest struct {
+	Body   json.RawMessage `json:"body"`
+	SendAt time.Time       `json:"send_at"`
+}
+
+func (c *ScheduledMessageController) Schedule(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req ScheduleMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.ChatID == 0 {
+		http.Error(w, "Missing chat_id", http.StatusBadRequest)
+		return
+	}
+
+	msg := &models.ScheduledMessage{
+		ChatID:   req.ChatID,
+		SenderID: userID,
+		Body:     req.Body,
+		SendAt:   req.SendAt.UTC(),
+	}
+	if err := c.scheduledService.Schedule(r.Context(), msg); err != nil {
+		writeScheduledError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(msg)
+}
+
+// GetScheduled lists the user's pending messages, optionally for one chat
+func (c *ScheduledMessageController) GetScheduled(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	chatID := 0
+	if chatIDStr := r.URL.Query().Get("chat_id"); chatIDStr != "" {
+		id, err := strconv.Atoi(chatIDStr)
+		if err != nil {
+			http.Error(w, "Invalid chat_id", http.StatusBadRequest)
+			return
+		}
+		chatID = id
+	}
+
+	messages, err := c.scheduledService.GetPending(r.Context(), userID, chatID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if messages == nil {
+		messages = []*models.ScheduledMessage{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(messages)
+}
+
+func (c *ScheduledMessageController) UpdateScheduled(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid scheduled message ID", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateScheduledMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := c.scheduledService.Update(r.Context(), id, userID, req.Body, req.SendAt.UTC())
+	if err != nil {
+		writeScheduledError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg)
+}
+
+func (c *ScheduledMessageController) CancelScheduled(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid scheduled message ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := c.scheduledService.Cancel(r.Context(), id, userID); err != nil {
+		writeScheduledError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeScheduledError(w http.ResponseWriter, err error) {
+	if writeAccessError(w, err) {
+		return
+	}
+	var bodyErr *models.MessageBodyError
+	if errors.As(err, &bodyErr) {
+		http.Error(w, bodyErr.Message, http.StatusBadRequest)
+		return
+	}
+
+	switch msg := err.Error(); {
+	case msg == "scheduled message not found":
+		http.Error(w, msg, http.StatusNotFound)
+	case msg == "scheduled message is no longer pending", strings.Contains(msg, "duplicate key"):
+		http.Error(w, msg, http.StatusConflict)
+	case strings.HasPrefix(msg, "send_at"), strings.HasPrefix(msg, "invalid"), strings.HasSuffix(msg, "is required"):
+		http.Error(w, msg, http.StatusBadRequest)
+	default:
+		http.Error(w, msg, http.StatusInternalServerError)
+	}
+}
@@ -6,44 +6,43 @@ package controllers
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
-	"github.com/vtstv/nexy/internal/config"
+	"github.com/vtstv/nexy/internal/middleware"
+	"github.com/vtstv/nexy/internal/services"
 )
 
 type TURNController struct {
-	config *config.Config
+	turnService *services.TURNService
 }
 
-func NewTURNController(cfg *config.Config) *TURNController {
+func NewTURNController(turnService *services.TURNService) *TURNController {
 	return &TURNController{
-		config: cfg,
+		turnService: turnService,
 	}
 }
 
-type ICEServer struct {
-	URLs       []string `json:"urls"`
-	Username   string   `json:"username,omitempty"`
-	Credential string   `json:"credential,omitempty"`
-}
-
 type ICEConfigResponse struct {
-	ICEServers []ICEServer `json:"iceServers"`
+	ICEServers []services.ICEServer `json:"iceServers"`
+	TTL        int64                `json:"ttl"`        // Seconds the credentials stay valid
+	ExpiresAt  int64                `json:"expires_at"` // Unix time, refetch before then
 }
 
+// GetICEServers returns STUN/TURN servers with credentials for the caller.
+// An optional region query parameter moves matching servers to the front.
 func (c *TURNController) GetICEServers(w http.ResponseWriter, r *http.Request) {
-	iceServers := []ICEServer{
-		{
-			URLs: []string{c.config.TURN.STUNServerURL},
-		},
-		{
-			URLs:       []string{c.config.TURN.ServerURL},
-			Username:   c.config.TURN.Username,
-			Credential: c.config.TURN.Password,
-		},
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
 	}
 
+	iceServers, expiresAt := c.turnService.ICEServers(userID, r.URL.Query().Get("region"))
+
 	response := ICEConfigResponse{
 		ICEServers: iceServers,
+		TTL:        int64(time.Until(expiresAt).Round(time.Second).Seconds()),
+		ExpiresAt:  expiresAt.Unix(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -14,9 +14,15 @@ import (
 	"github.com/vtstv/nexy/internal/services"
 )
 
+// PresencePublisher pushes a user's presence to the users allowed to see it
+type PresencePublisher interface {
+	PublishPresence(userID int)
+}
+
 type UserController struct {
-	userService *services.UserService
-	qrService   *services.QRService
+	userService       *services.UserService
+	qrService         *services.QRService
+	presencePublisher PresencePublisher
 }
 
 func NewUserController(userService *services.UserService, qrService *services.QRService) *UserController {
@@ -26,6 +32,10 @@ func NewUserController(userService *services.UserService, qrService *services.QR
 	}
 }
 
+func (c *UserController) SetPresencePublisher(publisher PresencePublisher) {
+	c.presencePublisher = publisher
+}
+
 type MuteRequest struct {
 	Until    *time.Time `json:"until,omitempty"`
 	Duration string     `json:"duration,omitempty"` // "1h", "1d", "1m", "forever"
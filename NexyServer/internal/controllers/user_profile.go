@@ -10,6 +10,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/vtstv/nexy/internal/middleware"
+	"github.com/vtstv/nexy/internal/models"
 )
 
 type UpdateProfileRequest struct {
@@ -27,6 +28,12 @@ type UpdateProfileRequest struct {
 	ShowOnlineStatus        *bool  `json:"show_online_status"`
 }
 
+type UpdatePresenceRequest struct {
+	State             string               `json:"state"` // online, away, dnd or invisible
+	CustomStatus      *models.CustomStatus `json:"custom_status"`
+	ClearCustomStatus bool                 `json:"clear_custom_status"`
+}
+
 // GetMe returns current user profile
 func (c *UserController) GetMe(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserID(r)
@@ -96,6 +103,34 @@ func (c *UserController) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(user)
 }
 
+// UpdatePresence sets the current user's presence state and custom status
+func (c *UserController) UpdatePresence(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req UpdatePresenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	user, err := c.userService.UpdatePresence(r.Context(), userID, req.State, req.CustomStatus, req.ClearCustomStatus)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if c.presencePublisher != nil {
+		c.presencePublisher.PublishPresence(userID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
 // SearchUsers searches for users by query
 func (c *UserController) SearchUsers(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("query")
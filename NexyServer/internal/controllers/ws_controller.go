@@ -5,6 +5,7 @@ package controllers
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/vtstv/nexy/internal/services"
@@ -56,5 +57,13 @@ func (c *WSController) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		deviceID = r.Header.Get("X-Device-ID")
 	}
 
-	c.wsHandler.ServeWS(w, r, userID, deviceID)
+	// Reconnecting clients send the last stream sequence they acked so missed events can be replayed
+	lastSeq := int64(-1)
+	if lastSeqStr := r.URL.Query().Get("last_seq"); lastSeqStr != "" {
+		if parsed, err := strconv.ParseInt(lastSeqStr, 10, 64); err == nil && parsed >= 0 {
+			lastSeq = parsed
+		}
+	}
+
+	c.wsHandler.ServeWS(w, r, userID, deviceID, lastSeq)
 }
@@ -0,0 +1,289 @@
+/*
+ * © 2025 Murr | https://github.com/vtstv
+ */
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MessageBody is the body of a message a client sends, as a chat_message
+// frame or as a scheduled message
+type MessageBody struct {
+	Content     string             `json:"content"`
+	MessageType string             `json:"message_type"`
+	MediaURL    string             `json:"media_url"`
+	MediaType   string             `json:"media_type"`
+	FileSize    *int64             `json:"file_size"`
+	Duration    *int               `json:"duration"`
+	ReplyToID   *int               `json:"reply_to_id"`
+	TTL         *int               `json:"ttl"` // Seconds until the message disappears
+	Encryption  *MessageEncryption `json:"encryption"`
+	Mentions    []MentionEntity    `json:"mentions"`
+	Poll        *NewPoll           `json:"poll"`
+	Location    *NewLocation       `json:"location"`
+}
+
+// MessageEncryption says how the content of an end-to-end encrypted message
+// was encrypted
+type MessageEncryption struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"key_id,omitempty"`
+}
+
+// MessageStorage is where a message type keeps what does not fit the
+// messages row
+type MessageStorage string
+
+const (
+	StorageMessage  MessageStorage = "message"  // the messages row alone
+	StoragePoll     MessageStorage = "poll"     // polls and poll_options
+	StorageLocation MessageStorage = "location" // message_locations
+)
+
+// MessageTypeSpec declares a message type clients may send. System messages
+// are posted by the server alone and have none.
+type MessageTypeSpec struct {
+	Name        string
+	Action      ChatAction     // Needed in the chat to send it
+	Storage     MessageStorage // Where its payload is stored
+	Media       bool           // Carries an uploaded file in media_url
+	Encryptable bool           // May carry end-to-end encrypted content
+
+	// Preview turns a message's content into its notification text; nil
+	// shows the content
+	Preview func(content string) string
+
+	// Validate checks what is particular to the type, after the checks all
+	// types share
+	Validate func(body *MessageBody) error
+}
+
+// MessageBodyError refuses a malformed message body
+type MessageBodyError struct {
+	Code    string
+	Message string
+}
+
+func (e *MessageBodyError) Error() string     { return e.Message }
+func (e *MessageBodyError) ErrorCode() string { return e.Code }
+
+func invalidMessage(code, format string, args ...interface{}) error {
+	return &MessageBodyError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+var messageTypes = map[string]*MessageTypeSpec{}
+
+// RegisterMessageType adds a message type clients may send. It panics if the
+// name is taken, so it belongs in init.
+func RegisterMessageType(spec *MessageTypeSpec) {
+	if _, ok := messageTypes[spec.Name]; ok {
+		panic("message type " + spec.Name + " registered twice")
+	}
+	messageTypes[spec.Name] = spec
+}
+
+// LookupMessageType returns the registered message type with the given name
+func LookupMessageType(name string) (*MessageTypeSpec, bool) {
+	spec, ok := messageTypes[name]
+	return spec, ok
+}
+
+// ParseMessageBody parses a message body and validates it against its type.
+// Errors are *MessageBodyError.
+func ParseMessageBody(data []byte) (*MessageBody, *MessageTypeSpec, error) {
+	var body MessageBody
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, nil, invalidMessage("invalid_message", "malformed message body")
+	}
+
+	spec, ok := LookupMessageType(body.MessageType)
+	if !ok {
+		return nil, nil, invalidMessage("invalid_message_type", "unknown message type %q", body.MessageType)
+	}
+	if err := spec.validate(&body); err != nil {
+		return nil, nil, err
+	}
+	return &body, spec, nil
+}
+
+// validate runs the checks shared by all types, then the type's own
+func (spec *MessageTypeSpec) validate(body *MessageBody) error {
+	if body.TTL != nil && (*body.TTL <= 0 || *body.TTL > MaxMessageTTL) {
+		return invalidMessage("invalid_message", "ttl must be between 1 and %d seconds", MaxMessageTTL)
+	}
+	if body.Encryption != nil && !spec.Encryptable {
+		return invalidMessage("invalid_message", "%s messages cannot be encrypted", spec.Name)
+	}
+	if spec.Media && body.MediaURL == "" {
+		return invalidMessage("invalid_message", "media_url is required")
+	}
+	if !spec.Media && (body.MediaURL != "" || body.FileSize != nil || body.Duration != nil) {
+		return invalidMessage("invalid_message", "%s messages cannot carry media", spec.Name)
+	}
+	if (spec.Storage == StoragePoll) != (body.Poll != nil) {
+		return invalidMessage("invalid_poll", "a poll must come with message type poll")
+	}
+	if (spec.Storage == StorageLocation) != (body.Location != nil) {
+		return invalidMessage("invalid_location", "a location must come with message type location")
+	}
+	if spec.Validate != nil {
+		return spec.Validate(body)
+	}
+	return nil
+}
+
+// ValidateMessageEdit checks new content for a message of the given type.
+// Types keeping their payload outside the messages row, and system messages,
+// cannot be edited. Errors are *MessageBodyError.
+func ValidateMessageEdit(messageType, content string) error {
+	spec, ok := LookupMessageType(messageType)
+	if !ok || spec.Storage != StorageMessage {
+		return invalidMessage("message_not_editable", "%s messages cannot be edited", messageType)
+	}
+	if spec.Validate != nil {
+		return spec.Validate(&MessageBody{MessageType: messageType, Content: content})
+	}
+	return nil
+}
+
+// NotificationPreview is the text a push notification shows for a message of
+// this type with the given content
+func (spec *MessageTypeSpec) NotificationPreview(content string) string {
+	if spec.Preview != nil {
+		return spec.Preview(content)
+	}
+	return content
+}
+
+func previewAs(text string) func(string) string {
+	return func(string) string { return text }
+}
+
+// previewOr shows the content, or fallback when there is none
+func previewOr(fallback string) func(string) string {
+	return func(content string) string {
+		if content == "" {
+			return fallback
+		}
+		return content
+	}
+}
+
+func init() {
+	RegisterMessageType(&MessageTypeSpec{
+		Name:        "text",
+		Action:      ChatActionSendMessages,
+		Storage:     StorageMessage,
+		Encryptable: true,
+		Validate: func(body *MessageBody) error {
+			if strings.TrimSpace(body.Content) == "" {
+				return invalidMessage("invalid_message", "message content is required")
+			}
+			return nil
+		},
+	})
+	RegisterMessageType(&MessageTypeSpec{
+		Name:        "media",
+		Action:      ChatActionSendMedia,
+		Storage:     StorageMessage,
+		Media:       true,
+		Encryptable: true,
+		Preview:     previewAs("Sent a media"),
+	})
+	RegisterMessageType(&MessageTypeSpec{
+		Name:        "file",
+		Action:      ChatActionSendMedia,
+		Storage:     StorageMessage,
+		Media:       true,
+		Encryptable: true,
+		Preview:     previewAs("Sent a file"),
+	})
+	RegisterMessageType(&MessageTypeSpec{
+		Name:        "voice",
+		Action:      ChatActionSendMedia,
+		Storage:     StorageMessage,
+		Media:       true,
+		Encryptable: true,
+		Preview:     previewAs("Sent a voice message"),
+		Validate: func(body *MessageBody) error {
+			if body.Duration != nil && *body.Duration < 0 {
+				return invalidMessage("invalid_message", "duration cannot be negative")
+			}
+			return nil
+		},
+	})
+	RegisterMessageType(&MessageTypeSpec{
+		Name:     "poll",
+		Action:   ChatActionSendMessages,
+		Storage:  StoragePoll,
+		Preview:  previewOr("Sent a poll"),
+		Validate: validatePoll,
+	})
+	RegisterMessageType(&MessageTypeSpec{
+		Name:     "location",
+		Action:   ChatActionSendMessages,
+		Storage:  StorageLocation,
+		Preview:  previewOr("Sent a location"),
+		Validate: validateLocation,
+	})
+}
+
+func validatePoll(body *MessageBody) error {
+	poll := body.Poll
+	question := strings.TrimSpace(poll.Question)
+	if question == "" || utf8.RuneCountInString(question) > MaxPollQuestionLength {
+		return invalidMessage("invalid_poll", "poll question must be 1 to %d characters", MaxPollQuestionLength)
+	}
+	if len(poll.Options) < MinPollOptions || len(poll.Options) > MaxPollOptions {
+		return invalidMessage("invalid_poll", "a poll needs %d to %d options", MinPollOptions, MaxPollOptions)
+	}
+	seen := make(map[string]bool, len(poll.Options))
+	for _, option := range poll.Options {
+		text := strings.TrimSpace(option)
+		if text == "" || utf8.RuneCountInString(text) > MaxPollOptionLength {
+			return invalidMessage("invalid_poll", "poll options must be 1 to %d characters", MaxPollOptionLength)
+		}
+		if seen[text] {
+			return invalidMessage("invalid_poll", "poll options must differ")
+		}
+		seen[text] = true
+	}
+
+	if poll.Quiz {
+		if poll.MultipleChoice {
+			return invalidMessage("invalid_poll", "a quiz has a single answer")
+		}
+		if poll.CorrectOption == nil || *poll.CorrectOption < 0 || *poll.CorrectOption >= len(poll.Options) {
+			return invalidMessage("invalid_poll", "a quiz needs its correct option")
+		}
+	} else if poll.CorrectOption != nil {
+		return invalidMessage("invalid_poll", "only quizzes have a correct option")
+	}
+
+	if poll.CloseAt != nil && *poll.CloseAt <= time.Now().Unix() {
+		return invalidMessage("invalid_poll", "poll close time must be in the future")
+	}
+	return nil
+}
+
+func validateLocation(body *MessageBody) error {
+	loc := body.Location
+	if loc.Latitude < -90 || loc.Latitude > 90 || loc.Longitude < -180 || loc.Longitude > 180 {
+		return invalidMessage("invalid_location", "invalid coordinates")
+	}
+	if loc.Accuracy != nil && *loc.Accuracy < 0 {
+		return invalidMessage("invalid_location", "accuracy cannot be negative")
+	}
+	if utf8.RuneCountInString(loc.Venue) > MaxVenueLength {
+		return invalidMessage("invalid_location", "venue must be at most %d characters", MaxVenueLength)
+	}
+	if loc.LivePeriod != 0 && (loc.LivePeriod < MinLivePeriod || loc.LivePeriod > MaxLivePeriod) {
+		return invalidMessage("invalid_location", "live period must be %d to %d seconds", MinLivePeriod, MaxLivePeriod)
+	}
+	return nil
+}
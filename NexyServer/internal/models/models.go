@@ -3,28 +3,49 @@
  */
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type User struct {
-	ID                      int        `json:"id"`
-	Username                string     `json:"username"`
-	Email                   string     `json:"email"`
-	PasswordHash            string     `json:"-"`
-	DisplayName             string     `json:"display_name"`
-	AvatarURL               string     `json:"avatar_url"`
-	Bio                     string     `json:"bio"`
-	PhoneNumber             string     `json:"phone_number,omitempty"`
-	PhonePrivacy            string     `json:"phone_privacy,omitempty"`
-	AllowPhoneDiscovery     bool       `json:"allow_phone_discovery"`
-	FcmToken                string     `json:"-"`
-	ReadReceiptsEnabled     bool       `json:"read_receipts_enabled"`
-	TypingIndicatorsEnabled bool       `json:"typing_indicators_enabled"`
-	VoiceMessagesEnabled    bool       `json:"voice_messages_enabled"`
-	ShowOnlineStatus        bool       `json:"show_online_status"`
-	LastSeen                *time.Time `json:"last_seen,omitempty"`
-	OnlineStatus            string     `json:"online_status,omitempty"`
-	CreatedAt               time.Time  `json:"created_at"`
-	UpdatedAt               time.Time  `json:"updated_at"`
+	ID                      int           `json:"id"`
+	Username                string        `json:"username"`
+	Email                   string        `json:"email"`
+	PasswordHash            string        `json:"-"`
+	DisplayName             string        `json:"display_name"`
+	AvatarURL               string        `json:"avatar_url"`
+	Bio                     string        `json:"bio"`
+	PhoneNumber             string        `json:"phone_number,omitempty"`
+	PhonePrivacy            string        `json:"phone_privacy,omitempty"`
+	AllowPhoneDiscovery     bool          `json:"allow_phone_discovery"`
+	FcmToken                string        `json:"-"`
+	ReadReceiptsEnabled     bool          `json:"read_receipts_enabled"`
+	TypingIndicatorsEnabled bool          `json:"typing_indicators_enabled"`
+	VoiceMessagesEnabled    bool          `json:"voice_messages_enabled"`
+	ShowOnlineStatus        bool          `json:"show_online_status"`
+	LastSeen                *time.Time    `json:"last_seen,omitempty"`
+	OnlineStatus            string        `json:"online_status,omitempty"`
+	PresenceState           string        `json:"presence_state,omitempty"`
+	CustomStatus            *CustomStatus `json:"custom_status,omitempty"`
+	CreatedAt               time.Time     `json:"created_at"`
+	UpdatedAt               time.Time     `json:"updated_at"`
+}
+
+// Presence states. Offline is never stored, it is what viewers see when the
+// user has no connection or is invisible.
+const (
+	PresenceOnline    = "online"
+	PresenceAway      = "away"
+	PresenceDND       = "dnd"
+	PresenceInvisible = "invisible"
+	PresenceOffline   = "offline"
+)
+
+type CustomStatus struct {
+	Text      string     `json:"text,omitempty"`
+	Emoji     string     `json:"emoji,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 type RefreshToken struct {
@@ -78,20 +99,56 @@ type Chat struct {
 	IsMember             bool             `json:"is_member,omitempty"`
 	MutedUntil           *time.Time       `json:"muted_until,omitempty"`
 	UnreadCount          int              `json:"unread_count"`
+	UnreadMentionCount   int              `json:"unread_mention_count"`
 	LastReadMessageId    int              `json:"last_read_message_id"`
 	FirstUnreadMessageId string           `json:"first_unread_message_id,omitempty"`
 	IsPinned             bool             `json:"is_pinned"`
 	PinnedAt             *time.Time       `json:"pinned_at,omitempty"`
+	MessageTTL           *int             `json:"message_ttl,omitempty"` // Auto-delete timer in seconds
+	Pinned               []*PinnedMessage `json:"pinned,omitempty"`      // Pinned messages the viewer sees, newest first
 }
 
+// PinnedMessage is a message pinned to the top of a chat
+type PinnedMessage struct {
+	Message  *Message  `json:"message"`
+	PinnedBy *int      `json:"pinned_by,omitempty"`
+	PinnedAt time.Time `json:"pinned_at"`
+	ForMe    bool      `json:"for_me,omitempty"` // Pinned only on the viewer's side of a private chat
+}
+
+// Auto-delete timers a chat can be set to, in seconds
+const (
+	ChatTTLDay   = 24 * 60 * 60
+	ChatTTLWeek  = 7 * ChatTTLDay
+	ChatTTLMonth = 30 * ChatTTLDay
+)
+
+// MaxMessageTTL bounds the TTL a single message can carry, in seconds
+const MaxMessageTTL = ChatTTLMonth
+
 type ChatPermissions struct {
-	SendMessages bool `json:"send_messages"`
-	SendMedia    bool `json:"send_media"`
-	AddUsers     bool `json:"add_users"`
-	PinMessages  bool `json:"pin_messages"`
-	ChangeInfo   bool `json:"change_info"`
+	SendMessages   bool `json:"send_messages"`
+	SendMedia      bool `json:"send_media"`
+	AddUsers       bool `json:"add_users"`
+	PinMessages    bool `json:"pin_messages"`
+	ChangeInfo     bool `json:"change_info"`
+	DeleteMessages bool `json:"delete_messages"` // Only honoured for admins; owners always have it
 }
 
+// ChatAction is an operation checked against chat membership, bans and permissions
+type ChatAction string
+
+const (
+	ChatActionView         ChatAction = "view"          // read history; allowed for non-members of public groups
+	ChatActionParticipate  ChatAction = "participate"   // typing, read receipts, reactions, calls
+	ChatActionSendMessages ChatAction = "send_messages" // post or edit text
+	ChatActionSendMedia    ChatAction = "send_media"    // post media, files and voice
+	ChatActionChangeInfo   ChatAction = "change_info"   // chat settings such as the auto-delete timer
+	ChatActionPinMessages  ChatAction = "pin_messages"  // pin and unpin messages for every member
+	ChatActionDeleteOthers ChatAction = "delete_others" // delete other members' messages for everyone
+	ChatActionClosePolls   ChatAction = "close_polls"   // close polls other members started
+)
+
 type ChatMember struct {
 	ID                int              `json:"id"`
 	ChatID            int              `json:"chat_id"`
@@ -136,10 +193,140 @@ type Message struct {
 	Status      string          `json:"status,omitempty"`
 	Pts         int             `json:"pts,omitempty"` // sequence number for sync
 	Reactions   []ReactionCount `json:"reactions,omitempty"`
+	Mentions    []MentionEntity `json:"mentions,omitempty"`
+	Poll        *Poll           `json:"poll,omitempty"`
+	Location    *Location       `json:"location,omitempty"`
+	Forward     *ForwardInfo    `json:"forward,omitempty"`
+	Thread      *ThreadInfo     `json:"thread,omitempty"`     // Replies to this message, if any
+	TTL         *int            `json:"ttl,omitempty"`        // Seconds until deletion, overrides the chat timer
+	ExpiresAt   *time.Time      `json:"expires_at,omitempty"` // Set when the message disappears
 	CreatedAt   time.Time       `json:"created_at"`
 	UpdatedAt   time.Time       `json:"updated_at"`
 }
 
+// MentionEntity marks the span of a message's text that refers to a user.
+// Offset and Length count characters of the content.
+type MentionEntity struct {
+	UserID int `json:"user_id"`
+	Offset int `json:"offset"`
+	Length int `json:"length"`
+}
+
+// MaxMentions bounds how many mentions one message can carry
+const MaxMentions = 50
+
+// MentionTarget is a user a message is about to mention, with what decides
+// whether they may be
+type MentionTarget struct {
+	UserID   int
+	Username string
+	IsMember bool
+	Blocked  bool // Either the sender or the user blocked the other
+}
+
+// NewPoll is the poll a client attaches to a poll message
+type NewPoll struct {
+	Question       string   `json:"question"`
+	Options        []string `json:"options"`
+	MultipleChoice bool     `json:"multiple_choice,omitempty"`
+	PublicVoters   bool     `json:"public_voters,omitempty"`
+	Quiz           bool     `json:"quiz,omitempty"`
+	CorrectOption  *int     `json:"correct_option,omitempty"` // Index of the right answer, quizzes only
+	CloseAt        *int64   `json:"close_at,omitempty"`       // Unix time the poll stops taking votes
+}
+
+// Limits on the polls a message can carry
+const (
+	MaxPollQuestionLength = 300
+	MaxPollOptionLength   = 100
+	MinPollOptions        = 2
+	MaxPollOptions        = 10
+)
+
+// Poll is a poll message's question with its results as one user sees them.
+// A quiz's answer is only revealed to its creator, to users who answered and
+// once it is closed.
+type Poll struct {
+	ID             int          `json:"id"`
+	MessageID      int          `json:"message_id"`
+	CreatedBy      int          `json:"created_by"`
+	Question       string       `json:"question"`
+	Options        []PollOption `json:"options"`
+	MultipleChoice bool         `json:"multiple_choice"`
+	PublicVoters   bool         `json:"public_voters"`
+	Quiz           bool         `json:"quiz"`
+	CorrectOption  *int         `json:"correct_option,omitempty"`
+	TotalVoters    int          `json:"total_voters"`
+	MyVotes        []int        `json:"my_votes,omitempty"`
+	CloseAt        *time.Time   `json:"close_at,omitempty"`
+	ClosedAt       *time.Time   `json:"closed_at,omitempty"`
+	Closed         bool         `json:"closed"`
+}
+
+// PollOption is one answer of a poll with its votes. VoterIDs is only filled
+// in for polls with public voters.
+type PollOption struct {
+	Text     string `json:"text"`
+	Voters   int    `json:"voters"`
+	VoterIDs []int  `json:"voter_ids,omitempty"`
+}
+
+// NewLocation is the location a client attaches to a location message
+type NewLocation struct {
+	Latitude   float64  `json:"latitude"`
+	Longitude  float64  `json:"longitude"`
+	Accuracy   *float64 `json:"accuracy,omitempty"` // Radius in meters
+	Venue      string   `json:"venue,omitempty"`
+	LivePeriod int      `json:"live_period,omitempty"` // Seconds to share it live for, 0 for a fixed location
+}
+
+// Limits on location messages
+const (
+	MinLivePeriod  = 60
+	MaxLivePeriod  = 24 * 60 * 60
+	MaxVenueLength = 200
+)
+
+// Location is what a location message shows. A live location is moved in
+// place by its sender until LiveUntil, or until they stop sharing it.
+type Location struct {
+	Latitude  float64    `json:"latitude"`
+	Longitude float64    `json:"longitude"`
+	Accuracy  *float64   `json:"accuracy,omitempty"`
+	Venue     string     `json:"venue,omitempty"`
+	LiveUntil *time.Time `json:"live_until,omitempty"`
+	Live      bool       `json:"live"` // Still being shared
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// MessageEdit is a version of a message's text that a later edit replaced
+type MessageEdit struct {
+	ID        int       `json:"id"`
+	MessageID int       `json:"message_id"`
+	Content   string    `json:"content"`
+	EditedBy  *int      `json:"edited_by,omitempty"`
+	WrittenAt time.Time `json:"written_at"` // When this version was posted or last edited
+	EditedAt  time.Time `json:"edited_at"`  // When it was replaced
+}
+
+// ThreadInfo summarizes the replies to a message. UnreadCount counts other
+// users' replies after the last one the viewer marked read.
+type ThreadInfo struct {
+	ReplyCount        int       `json:"reply_count"`
+	UnreadCount       int       `json:"unread_count"`
+	LastReplyID       int       `json:"last_reply_id"`
+	LastReplySenderID int       `json:"last_reply_sender_id"`
+	LastReplyAt       time.Time `json:"last_reply_at"`
+}
+
+// ForwardInfo attributes a forwarded message to where it was first posted.
+// The IDs are nil once that user or chat has been deleted.
+type ForwardInfo struct {
+	FromUserID *int      `json:"from_user_id,omitempty"`
+	FromChatID *int      `json:"from_chat_id,omitempty"`
+	Date       time.Time `json:"date"`
+}
+
 type MessageStatus struct {
 	ID        int       `json:"id"`
 	MessageID int       `json:"message_id"`
@@ -163,6 +350,78 @@ type ReactionCount struct {
 	ReactedBy bool   `json:"reacted_by"` // true if current user reacted with this emoji
 }
 
+// Final states of a call, see migrations/011_add_calls.sql
+const (
+	CallStatusEnded   = "ended"
+	CallStatusMissed  = "missed"
+	CallStatusBusy    = "busy"
+	CallStatusTimeout = "timeout"
+)
+
+type Call struct {
+	ID         int        `json:"id"`
+	CallID     string     `json:"call_id"`
+	CallerID   int        `json:"caller_id"`
+	CalleeID   *int       `json:"callee_id,omitempty"`
+	ChatID     *int       `json:"chat_id,omitempty"`
+	IsVideo    bool       `json:"is_video"`
+	Status     string     `json:"status"`
+	EndReason  string     `json:"end_reason,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	AnsweredAt *time.Time `json:"answered_at,omitempty"`
+	EndedAt    *time.Time `json:"ended_at,omitempty"`
+	Duration   *int       `json:"duration,omitempty"` // Seconds between answer and hangup
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// States of a scheduled message, see migrations/013_add_scheduled_messages.sql
+const (
+	ScheduledPending   = "pending"
+	ScheduledSending   = "sending"
+	ScheduledSent      = "sent"
+	ScheduledCancelled = "cancelled"
+	ScheduledFailed    = "failed"
+)
+
+// ScheduledMessage is a message the server posts on the sender's behalf at
+// SendAt. Body has the same shape as a chat_message frame body.
+type ScheduledMessage struct {
+	ID        int             `json:"id"`
+	MessageID string          `json:"message_id"`
+	ChatID    int             `json:"chat_id"`
+	SenderID  int             `json:"sender_id"`
+	Body      json.RawMessage `json:"body"`
+	SendAt    time.Time       `json:"send_at"`
+	Status    string          `json:"status"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error,omitempty"`
+	SentAt    *time.Time      `json:"sent_at,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// ICE candidate types a call's selected pair can use, see
+// migrations/012_add_call_quality.sql
+const (
+	CandidateHost  = "host"
+	CandidateSrflx = "srflx"
+	CandidatePrflx = "prflx"
+	CandidateRelay = "relay"
+)
+
+// CallQualityReport is one participant's WebRTC stats summary for a call
+type CallQualityReport struct {
+	ID            int       `json:"id"`
+	CallID        string    `json:"call_id"`
+	UserID        int       `json:"user_id"`
+	RTTMs         *int      `json:"rtt_ms,omitempty"`
+	JitterMs      *int      `json:"jitter_ms,omitempty"`
+	PacketLoss    *float64  `json:"packet_loss,omitempty"` // Percent of packets lost
+	BitrateKbps   *int      `json:"bitrate_kbps,omitempty"`
+	CandidateType string    `json:"candidate_type"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
 type File struct {
 	ID               int       `json:"id"`
 	FileID           string    `json:"file_id"`
@@ -235,6 +494,13 @@ type Update struct {
 }
 
 // Response for getDifference API
+// updates_log types. A deleted message is gone for every member of its chat,
+// a hidden one only for the user named in the update.
+const (
+	UpdateDeleteMessage = "delete_message"
+	UpdateHideMessage   = "hide_message"
+)
+
 type UpdatesDifference struct {
 	NewMessages     []*Message `json:"new_messages"`
 	EditedMessages  []*Message `json:"edited_messages,omitempty"`
@@ -0,0 +1,160 @@
+/*
+ * © 2025 Murr | https://github.com/vtstv
+ */
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/vtstv/nexy/internal/models"
+)
+
+type CallRepository struct {
+	db *sql.DB
+}
+
+func NewCallRepository(db *sql.DB) *CallRepository {
+	return &CallRepository{db: db}
+}
+
+// Create stores a finished call. It reports false if the caller's call was
+// already recorded, so callers can skip side effects on a repeated write.
+// Call IDs come from clients, so only the caller and call ID together are
+// unique.
+func (r *CallRepository) Create(ctx context.Context, call *models.Call) (bool, error) {
+	query := `
+		INSERT INTO calls (call_id, caller_id, callee_id, chat_id, is_video, status, end_reason, started_at, answered_at, ended_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9, $10)
+		ON CONFLICT (caller_id, call_id) DO NOTHING
+		RETURNING id, created_at`
+
+	err := r.db.QueryRowContext(ctx, query,
+		call.CallID,
+		call.CallerID,
+		call.CalleeID,
+		call.ChatID,
+		call.IsVideo,
+		call.Status,
+		call.EndReason,
+		call.StartedAt,
+		call.AnsweredAt,
+		call.EndedAt,
+	).Scan(&call.ID, &call.CreatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetUserHistory lists calls the user placed or received, newest first
+func (r *CallRepository) GetUserHistory(ctx context.Context, userID, limit, offset int) ([]*models.Call, error) {
+	query := `
+		SELECT id, call_id, caller_id, callee_id, chat_id, is_video, status, COALESCE(end_reason, ''),
+		       started_at, answered_at, ended_at, created_at
+		FROM calls
+		WHERE caller_id = $1 OR callee_id = $1
+		ORDER BY started_at DESC
+		LIMIT $2 OFFSET $3`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var calls []*models.Call
+	for rows.Next() {
+		call := &models.Call{}
+		var calleeID, chatID sql.NullInt64
+		var answeredAt, endedAt sql.NullTime
+		if err := rows.Scan(
+			&call.ID,
+			&call.CallID,
+			&call.CallerID,
+			&calleeID,
+			&chatID,
+			&call.IsVideo,
+			&call.Status,
+			&call.EndReason,
+			&call.StartedAt,
+			&answeredAt,
+			&endedAt,
+			&call.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if calleeID.Valid {
+			id := int(calleeID.Int64)
+			call.CalleeID = &id
+		}
+		if chatID.Valid {
+			id := int(chatID.Int64)
+			call.ChatID = &id
+		}
+		if answeredAt.Valid {
+			call.AnsweredAt = &answeredAt.Time
+		}
+		if endedAt.Valid {
+			call.EndedAt = &endedAt.Time
+		}
+		if call.AnsweredAt != nil && call.EndedAt != nil {
+			duration := int(call.EndedAt.Sub(*call.AnsweredAt).Seconds())
+			call.Duration = &duration
+		}
+		calls = append(calls, call)
+	}
+	return calls, rows.Err()
+}
+
+// IsParticipant reports whether the user placed or received the call, or is
+// a member of the chat a group call took place in
+func (r *CallRepository) IsParticipant(ctx context.Context, callID string, userID int) (bool, error) {
+	query := `
+		SELECT EXISTS(
+			SELECT 1 FROM calls c
+			WHERE c.call_id = $1 AND ` + callParticipantFilter + `
+		)`
+
+	var exists bool
+	err := r.db.QueryRowContext(ctx, query, callID, userID).Scan(&exists)
+	return exists, err
+}
+
+// callParticipantFilter matches calls c the user $2 placed or received, or
+// group calls of a chat they are a member of
+const callParticipantFilter = `(c.caller_id = $2 OR c.callee_id = $2
+			       OR (c.callee_id IS NULL AND EXISTS(
+			           SELECT 1 FROM chat_members cm WHERE cm.chat_id = c.chat_id AND cm.user_id = $2)))`
+
+// SaveQuality stores a participant's stats summary, replacing any earlier
+// report they posted for the same call. Of several calls with this ID the
+// user took part in, the latest gets it. It returns sql.ErrNoRows when the
+// user took part in none.
+func (r *CallRepository) SaveQuality(ctx context.Context, report *models.CallQualityReport) error {
+	query := `
+		INSERT INTO call_quality (caller_id, call_id, user_id, rtt_ms, jitter_ms, packet_loss, bitrate_kbps, candidate_type)
+		SELECT c.caller_id, c.call_id, $2::int, $3::int, $4::int, $5::real, $6::int, $7
+		FROM calls c
+		WHERE c.call_id = $1 AND ` + callParticipantFilter + `
+		ORDER BY c.started_at DESC
+		LIMIT 1
+		ON CONFLICT (caller_id, call_id, user_id) DO UPDATE SET
+			rtt_ms = EXCLUDED.rtt_ms,
+			jitter_ms = EXCLUDED.jitter_ms,
+			packet_loss = EXCLUDED.packet_loss,
+			bitrate_kbps = EXCLUDED.bitrate_kbps,
+			candidate_type = EXCLUDED.candidate_type,
+			created_at = CURRENT_TIMESTAMP
+		RETURNING id, created_at`
+
+	return r.db.QueryRowContext(ctx, query,
+		report.CallID,
+		report.UserID,
+		report.RTTMs,
+		report.JitterMs,
+		report.PacketLoss,
+		report.BitrateKbps,
+		report.CandidateType,
+	).Scan(&report.ID, &report.CreatedAt)
+}
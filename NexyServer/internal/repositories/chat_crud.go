@@ -50,12 +50,12 @@ func (r *ChatRepository) Create(ctx context.Context, chat *models.Chat) error {
 func (r *ChatRepository) GetByID(ctx context.Context, id int) (*models.Chat, error) {
 	chat := &models.Chat{}
 	query := `
-		SELECT c.id, c.type, c.group_type, c.name, c.username, c.description, c.avatar_url, c.created_by, c.default_permissions, c.created_at, c.updated_at,
+		SELECT c.id, c.type, c.group_type, c.name, c.username, c.description, c.avatar_url, c.created_by, c.default_permissions, c.message_ttl, c.created_at, c.updated_at,
 			(SELECT COUNT(*) FROM chat_members WHERE chat_id = c.id) as member_count
 		FROM chats c
 		WHERE c.id = $1`
 
-	var createdBy sql.NullInt64
+	var createdBy, messageTTL sql.NullInt64
 	var username, description, groupType sql.NullString
 	var defaultPermissions []byte
 
@@ -69,6 +69,7 @@ func (r *ChatRepository) GetByID(ctx context.Context, id int) (*models.Chat, err
 		&chat.AvatarURL,
 		&createdBy,
 		&defaultPermissions,
+		&messageTTL,
 		&chat.CreatedAt,
 		&chat.UpdatedAt,
 		&chat.MemberCount,
@@ -92,6 +93,10 @@ func (r *ChatRepository) GetByID(ctx context.Context, id int) (*models.Chat, err
 	if groupType.Valid {
 		chat.GroupType = groupType.String
 	}
+	if messageTTL.Valid {
+		ttl := int(messageTTL.Int64)
+		chat.MessageTTL = &ttl
+	}
 	if len(defaultPermissions) > 0 {
 		var perms models.ChatPermissions
 		if err := json.Unmarshal(defaultPermissions, &perms); err == nil {
@@ -140,6 +145,13 @@ func (r *ChatRepository) UpdateChat(ctx context.Context, chat *models.Chat) erro
 	return err
 }
 
+// SetMessageTTL sets the chat's auto-delete timer, nil turning it off
+func (r *ChatRepository) SetMessageTTL(ctx context.Context, chatID int, ttl *int) error {
+	query := `UPDATE chats SET message_ttl = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, ttl, chatID)
+	return err
+}
+
 // DeleteChat deletes a chat from the database
 func (r *ChatRepository) DeleteChat(ctx context.Context, chatID int) error {
 	query := `DELETE FROM chats WHERE id = $1`
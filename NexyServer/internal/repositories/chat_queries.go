@@ -92,7 +92,7 @@ func (r *ChatRepository) GetSelfChat(ctx context.Context, userID int) (*models.C
 func (r *ChatRepository) GetUserChats(ctx context.Context, userID int) ([]*models.Chat, error) {
 	// use last_read_message_id to calculate unread count and first unread message
 	query := `
-		SELECT c.id, c.type, c.name, c.avatar_url, c.created_by, c.created_at, c.updated_at, 
+		SELECT c.id, c.type, c.name, c.avatar_url, c.created_by, c.message_ttl, c.created_at, c.updated_at, 
 			cm.muted_until, COALESCE(cm.last_read_message_id, 0) as last_read_message_id,
 			COALESCE(cm.is_pinned, FALSE) as is_pinned, cm.pinned_at,
 			COALESCE((
@@ -112,7 +112,18 @@ func (r *ChatRepository) GetUserChats(ctx context.Context, userID int) ([]*model
 				AND m.id > COALESCE(cm.last_read_message_id, 0)
 				ORDER BY m.id ASC
 				LIMIT 1
-			), '') as first_unread_message_id
+			), '') as first_unread_message_id,
+			(
+				SELECT COUNT(DISTINCT mm.message_id)
+				FROM message_mentions mm
+				JOIN messages m ON m.id = mm.message_id
+				WHERE mm.chat_id = c.id
+				AND mm.user_id = $1
+				AND mm.is_read = FALSE
+				AND m.is_deleted = FALSE
+				AND (m.expires_at IS NULL OR m.expires_at > CURRENT_TIMESTAMP)
+				AND NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.message_id = m.id AND h.user_id = $1)
+			) as unread_mention_count
 		FROM chats c
 		INNER JOIN chat_members cm ON c.id = cm.chat_id
 		WHERE cm.user_id = $1
@@ -127,7 +138,7 @@ func (r *ChatRepository) GetUserChats(ctx context.Context, userID int) ([]*model
 	chats := []*models.Chat{}
 	for rows.Next() {
 		chat := &models.Chat{}
-		var createdBy sql.NullInt64
+		var createdBy, messageTTL sql.NullInt64
 		var mutedUntil sql.NullTime
 		var pinnedAt sql.NullTime
 		var firstUnreadMessageId sql.NullString
@@ -137,6 +148,7 @@ func (r *ChatRepository) GetUserChats(ctx context.Context, userID int) ([]*model
 			&chat.Name,
 			&chat.AvatarURL,
 			&createdBy,
+			&messageTTL,
 			&chat.CreatedAt,
 			&chat.UpdatedAt,
 			&mutedUntil,
@@ -145,6 +157,7 @@ func (r *ChatRepository) GetUserChats(ctx context.Context, userID int) ([]*model
 			&pinnedAt,
 			&chat.UnreadCount,
 			&firstUnreadMessageId,
+			&chat.UnreadMentionCount,
 		)
 		if err != nil {
 			return nil, err
@@ -153,6 +166,10 @@ func (r *ChatRepository) GetUserChats(ctx context.Context, userID int) ([]*model
 			id := int(createdBy.Int64)
 			chat.CreatedBy = &id
 		}
+		if messageTTL.Valid {
+			ttl := int(messageTTL.Int64)
+			chat.MessageTTL = &ttl
+		}
 		if mutedUntil.Valid {
 			chat.MutedUntil = &mutedUntil.Time
 		}
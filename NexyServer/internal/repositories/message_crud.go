@@ -3,20 +3,34 @@ package repositories
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"log"
+	"time"
 
 	"github.com/vtstv/nexy/internal/models"
 )
 
 // Create creates a new message
 func (r *MessageRepository) Create(ctx context.Context, msg *models.Message) error {
+	return r.insert(ctx, r.db, msg)
+}
+
+// rowQuerier is what insert needs from a database handle or a transaction
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (r *MessageRepository) insert(ctx context.Context, q rowQuerier, msg *models.Message) error {
+	// The message's own TTL wins over the chat timer, which does not apply to
+	// system messages such as the one announcing it
 	query := `
-		INSERT INTO messages (message_id, chat_id, sender_id, message_type, content, media_url, media_type, file_size, duration, reply_to_id)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-		RETURNING id, COALESCE(pts, id), created_at, updated_at`
+		INSERT INTO messages (message_id, chat_id, sender_id, message_type, content, media_url, media_type, file_size, duration, reply_to_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10,
+			CURRENT_TIMESTAMP + INTERVAL '1 second' * COALESCE($11::int,
+				(SELECT message_ttl FROM chats WHERE id = $2 AND $4 <> 'system')))
+		RETURNING id, COALESCE(pts, id), expires_at, created_at, updated_at`
 
-	return r.db.QueryRowContext(ctx, query,
+	var expiresAt sql.NullTime
+	err := q.QueryRowContext(ctx, query,
 		msg.MessageID,
 		msg.ChatID,
 		msg.SenderID,
@@ -27,7 +41,12 @@ func (r *MessageRepository) Create(ctx context.Context, msg *models.Message) err
 		msg.FileSize,
 		msg.Duration,
 		msg.ReplyToID,
-	).Scan(&msg.ID, &msg.Pts, &msg.CreatedAt, &msg.UpdatedAt)
+		msg.TTL,
+	).Scan(&msg.ID, &msg.Pts, &expiresAt, &msg.CreatedAt, &msg.UpdatedAt)
+	if expiresAt.Valid {
+		msg.ExpiresAt = &expiresAt.Time
+	}
+	return err
 }
 
 // GetByID retrieves a message by its database ID
@@ -35,7 +54,8 @@ func (r *MessageRepository) GetByID(ctx context.Context, id int) (*models.Messag
 	msg := &models.Message{}
 	query := `
 		SELECT id, message_id, chat_id, sender_id, message_type, content, media_url, media_type, 
-			   file_size, duration, reply_to_id, is_edited, is_deleted, created_at, updated_at
+			   file_size, duration, reply_to_id, is_edited, is_deleted,
+			   forwarded_from_user_id, forwarded_from_chat_id, forwarded_date, created_at, updated_at
 		FROM messages
 		WHERE id = $1`
 
@@ -44,6 +64,8 @@ func (r *MessageRepository) GetByID(ctx context.Context, id int) (*models.Messag
 	var duration sql.NullInt64
 	var mediaURL sql.NullString
 	var mediaType sql.NullString
+	var fromUserID, fromChatID sql.NullInt64
+	var forwardedDate sql.NullTime
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&msg.ID,
 		&msg.MessageID,
@@ -58,6 +80,9 @@ func (r *MessageRepository) GetByID(ctx context.Context, id int) (*models.Messag
 		&replyToID,
 		&msg.IsEdited,
 		&msg.IsDeleted,
+		&fromUserID,
+		&fromChatID,
+		&forwardedDate,
 		&msg.CreatedAt,
 		&msg.UpdatedAt,
 	)
@@ -78,6 +103,7 @@ func (r *MessageRepository) GetByID(ctx context.Context, id int) (*models.Messag
 		id := int(replyToID.Int64)
 		msg.ReplyToID = &id
 	}
+	msg.Forward = forwardInfo(fromUserID, fromChatID, forwardedDate)
 	return msg, err
 }
 
@@ -86,7 +112,8 @@ func (r *MessageRepository) GetByUUID(ctx context.Context, uuid string) (*models
 	msg := &models.Message{}
 	query := `
 		SELECT id, message_id, chat_id, sender_id, message_type, content, media_url, media_type, 
-			   file_size, duration, reply_to_id, is_edited, is_deleted, created_at, updated_at
+			   file_size, duration, reply_to_id, is_edited, is_deleted,
+			   forwarded_from_user_id, forwarded_from_chat_id, forwarded_date, created_at, updated_at
 		FROM messages
 		WHERE message_id = $1`
 
@@ -95,6 +122,8 @@ func (r *MessageRepository) GetByUUID(ctx context.Context, uuid string) (*models
 	var duration sql.NullInt64
 	var mediaURL sql.NullString
 	var mediaType sql.NullString
+	var fromUserID, fromChatID sql.NullInt64
+	var forwardedDate sql.NullTime
 	err := r.db.QueryRowContext(ctx, query, uuid).Scan(
 		&msg.ID,
 		&msg.MessageID,
@@ -109,6 +138,9 @@ func (r *MessageRepository) GetByUUID(ctx context.Context, uuid string) (*models
 		&replyToID,
 		&msg.IsEdited,
 		&msg.IsDeleted,
+		&fromUserID,
+		&fromChatID,
+		&forwardedDate,
 		&msg.CreatedAt,
 		&msg.UpdatedAt,
 	)
@@ -132,24 +164,29 @@ func (r *MessageRepository) GetByUUID(ctx context.Context, uuid string) (*models
 		id := int(replyToID.Int64)
 		msg.ReplyToID = &id
 	}
+	msg.Forward = forwardInfo(fromUserID, fromChatID, forwardedDate)
 	return msg, nil
 }
 
-// GetByChatID retrieves messages for a chat with pagination
-func (r *MessageRepository) GetByChatID(ctx context.Context, chatID int, limit, offset int) ([]*models.Message, error) {
+// GetByChatID retrieves messages for a chat with pagination, leaving out
+// those the user deleted for themselves
+func (r *MessageRepository) GetByChatID(ctx context.Context, chatID, userID int, limit, offset int) ([]*models.Message, error) {
 	query := `
 		SELECT m.id, m.message_id, m.chat_id, m.sender_id, m.message_type, m.content, m.media_url, m.media_type,
-			   m.file_size, m.duration, m.reply_to_id, m.is_edited, m.is_deleted, m.created_at, m.updated_at,
+			   m.file_size, m.duration, m.reply_to_id, m.is_edited, m.is_deleted, m.expires_at, m.created_at, m.updated_at,
+			   m.forwarded_from_user_id, m.forwarded_from_chat_id, m.forwarded_date,
 			   COALESCE(
 				   (SELECT status FROM message_status ms WHERE ms.message_id = m.id AND ms.user_id != m.sender_id ORDER BY CASE status WHEN 'read' THEN 3 WHEN 'delivered' THEN 2 ELSE 1 END DESC LIMIT 1),
 				   'sent'
 			   ) as status
 		FROM messages m
 		WHERE m.chat_id = $1
+		  AND (m.expires_at IS NULL OR m.expires_at > CURRENT_TIMESTAMP)
+		  AND NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.message_id = m.id AND h.user_id = $4)
 		ORDER BY m.created_at DESC
 		LIMIT $2 OFFSET $3`
 
-	rows, err := r.db.QueryContext(ctx, query, chatID, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, chatID, limit, offset, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -163,6 +200,9 @@ func (r *MessageRepository) GetByChatID(ctx context.Context, chatID int, limit,
 		var duration sql.NullInt64
 		var mediaURL sql.NullString
 		var mediaType sql.NullString
+		var expiresAt sql.NullTime
+		var fromUserID, fromChatID sql.NullInt64
+		var forwardedDate sql.NullTime
 		var status string
 		err := rows.Scan(
 			&msg.ID,
@@ -178,13 +218,20 @@ func (r *MessageRepository) GetByChatID(ctx context.Context, chatID int, limit,
 			&replyToID,
 			&msg.IsEdited,
 			&msg.IsDeleted,
+			&expiresAt,
 			&msg.CreatedAt,
 			&msg.UpdatedAt,
+			&fromUserID,
+			&fromChatID,
+			&forwardedDate,
 			&status,
 		)
 		if err != nil {
 			return nil, err
 		}
+		if expiresAt.Valid {
+			msg.ExpiresAt = &expiresAt.Time
+		}
 
 		// Clear content for deleted messages to protect privacy
 		if msg.IsDeleted {
@@ -213,68 +260,81 @@ func (r *MessageRepository) GetByChatID(ctx context.Context, chatID int, limit,
 			id := int(replyToID.Int64)
 			msg.ReplyToID = &id
 		}
+		msg.Forward = forwardInfo(fromUserID, fromChatID, forwardedDate)
 		messages = append(messages, msg)
 	}
 
 	return messages, rows.Err()
 }
 
-// Update updates an existing message
+// Update updates an existing message and replaces its mentions with
+// msg.Mentions. The text it replaces is kept in message_edits, unless the edit
+// leaves it unchanged.
 func (r *MessageRepository) Update(ctx context.Context, msg *models.Message) error {
-	query := `
-		UPDATE messages 
-		SET content = $1, is_edited = $2, updated_at = NOW()
-		WHERE message_id = $3 AND sender_id = $4
-		RETURNING updated_at`
+	tx, err := r.db.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	return r.db.QueryRowContext(ctx, query,
-		msg.Content,
-		true,
+	var id int
+	var previous sql.NullString
+	var writtenAt time.Time
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, content, CASE WHEN is_edited THEN updated_at ELSE created_at END
+		FROM messages
+		WHERE message_id = $1 AND sender_id = $2
+		FOR UPDATE`,
 		msg.MessageID,
 		msg.SenderID,
-	).Scan(&msg.UpdatedAt)
-}
+	).Scan(&id, &previous, &writtenAt)
+	if err != nil {
+		return err
+	}
+
+	if previous.String != msg.Content {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO message_edits (message_id, content, edited_by, written_at)
+			VALUES ($1, $2, $3, $4)`,
+			id, previous.String, msg.SenderID, writtenAt)
+		if err != nil {
+			return err
+		}
+	}
 
-// DeleteMessage soft-deletes a message
-func (r *MessageRepository) DeleteMessage(ctx context.Context, messageID string, userID int) error {
 	query := `
 		UPDATE messages 
-		SET is_deleted = true, updated_at = CURRENT_TIMESTAMP
-		WHERE message_id = $1`
+		SET content = $1, is_edited = $2, updated_at = NOW()
+		WHERE id = $3
+		RETURNING updated_at`
 
-	result, err := r.db.ExecContext(ctx, query, messageID)
-	if err != nil {
+	if err := tx.QueryRowContext(ctx, query,
+		msg.Content,
+		true,
+		id,
+	).Scan(&msg.UpdatedAt); err != nil {
 		return err
 	}
 
-	rows, err := result.RowsAffected()
-	if err != nil {
+	msg.ID = id
+	if err := replaceMentions(ctx, tx, msg); err != nil {
 		return err
 	}
-
-	if rows == 0 {
-		return sql.ErrNoRows
-	}
-
-	return nil
+	return tx.Commit()
 }
 
-// CreateMessageFromWebSocket creates a message from WebSocket data
+// CreateMessageFromWebSocket creates a message from WebSocket data, validated
+// against its message type and stored where the type keeps its payload
 func (r *MessageRepository) CreateMessageFromWebSocket(ctx context.Context, messageID string, chatID, senderID int, bodyJSON []byte) (int, error) {
-	var body struct {
-		Content     string `json:"content"`
-		MessageType string `json:"message_type"`
-		MediaURL    string `json:"media_url"`
-		MediaType   string `json:"media_type"`
-		FileSize    *int64 `json:"file_size"`
-		Duration    *int   `json:"duration"`
-		ReplyToID   *int   `json:"reply_to_id"`
-	}
-
-	if err := json.Unmarshal(bodyJSON, &body); err != nil {
-		log.Printf("Failed to parse message body: %v", err)
+	body, spec, err := models.ParseMessageBody(bodyJSON)
+	if err != nil {
+		log.Printf("Refused message body: %v", err)
 		return 0, err
 	}
+	// The question stands in for the text in previews and search
+	if body.Poll != nil && body.Content == "" {
+		body.Content = body.Poll.Question
+	}
 
 	msg := &models.Message{
 		MessageID:   messageID,
@@ -287,13 +347,27 @@ func (r *MessageRepository) CreateMessageFromWebSocket(ctx context.Context, mess
 		FileSize:    body.FileSize,
 		Duration:    body.Duration,
 		ReplyToID:   body.ReplyToID,
+		TTL:         body.TTL,
+		Mentions:    body.Mentions,
 	}
 
 	log.Printf("Creating message: id=%s, chatID=%d, senderID=%d, type=%s, content='%s'",
 		messageID, chatID, senderID, body.MessageType, body.Content)
 
-	if err := r.Create(ctx, msg); err != nil {
+	switch spec.Storage {
+	case models.StoragePoll:
+		err = r.CreatePollMessage(ctx, msg, body.Poll)
+	case models.StorageLocation:
+		err = r.CreateLocationMessage(ctx, msg, body.Location)
+	default:
+		err = r.Create(ctx, msg)
+	}
+	if err != nil {
 		return 0, err
 	}
+	// The message is already posted, so a lost mention does not fail it
+	if err := r.SaveMentions(ctx, msg); err != nil {
+		log.Printf("Failed to save mentions of message %s: %v", messageID, err)
+	}
 	return msg.ID, nil
 }
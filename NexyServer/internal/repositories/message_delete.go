@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// DeleteForEveryone soft-deletes a message and logs the deletion to
+// updates_log so sync reports it to every member. Callers check who may
+// delete it. It returns sql.ErrNoRows if the message is missing or already
+// deleted.
+func (r *MessageRepository) DeleteForEveryone(ctx context.Context, msg *models.Message) error {
+	tx, err := r.db.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE messages
+		SET is_deleted = true, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND is_deleted = false`, msg.ID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	data, _ := json.Marshal(map[string]string{"message_id": msg.MessageID})
+	if err := r.logUpdate(ctx, tx, msg.ChatID, models.UpdateDeleteMessage, data); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// HideMessage deletes a message for one user only. The hide is logged to
+// updates_log for that user's other devices. Hiding it twice is a no-op.
+func (r *MessageRepository) HideMessage(ctx context.Context, userID int, msg *models.Message) error {
+	tx, err := r.db.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO hidden_messages (user_id, message_id, chat_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`, userID, msg.ID, msg.ChatID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil || rows == 0 {
+		return err
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{"message_id": msg.MessageID, "user_id": userID})
+	if err := r.logUpdate(ctx, tx, msg.ChatID, models.UpdateHideMessage, data); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *MessageRepository) logUpdate(ctx context.Context, tx *sql.Tx, chatID int, updateType string, data []byte) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO updates_log (pts, chat_id, update_type, update_data, created_at)
+		VALUES (get_next_pts(), $1, $2, $3, NOW())`, chatID, updateType, data)
+	return err
+}
@@ -0,0 +1,41 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// GetEditHistory returns the replaced versions of a message, oldest first
+func (r *MessageRepository) GetEditHistory(ctx context.Context, messageID int) ([]*models.MessageEdit, error) {
+	query := `
+		SELECT id, message_id, content, edited_by, written_at, edited_at
+		FROM message_edits
+		WHERE message_id = $1
+		ORDER BY id ASC`
+
+	rows, err := r.db.QueryContext(ctx, query, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var edits []*models.MessageEdit
+	for rows.Next() {
+		edit := &models.MessageEdit{}
+		var content sql.NullString
+		var editedBy sql.NullInt64
+		if err := rows.Scan(&edit.ID, &edit.MessageID, &content, &editedBy, &edit.WrittenAt, &edit.EditedAt); err != nil {
+			return nil, err
+		}
+		edit.Content = content.String
+		if editedBy.Valid {
+			id := int(editedBy.Int64)
+			edit.EditedBy = &id
+		}
+		edits = append(edits, edit)
+	}
+
+	return edits, rows.Err()
+}
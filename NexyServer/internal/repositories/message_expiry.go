@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// DeleteExpired hard-deletes up to limit messages whose expires_at has
+// passed and returns them. Their message_status and reaction rows go with them
+// through ON DELETE CASCADE. Each deletion is logged to updates_log so sync
+// reports it to clients that were offline. Rows locked by another instance are
+// skipped, so concurrent sweepers never delete the same message twice.
+func (r *MessageRepository) DeleteExpired(ctx context.Context, limit int) ([]*models.Message, error) {
+	tx, err := r.db.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM messages
+		WHERE id IN (
+			SELECT id FROM messages
+			WHERE expires_at <= CURRENT_TIMESTAMP
+			ORDER BY expires_at ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, message_id, chat_id, sender_id, COALESCE(media_url, '')`
+
+	rows, err := tx.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []*models.Message
+	for rows.Next() {
+		msg := &models.Message{}
+		if err := rows.Scan(&msg.ID, &msg.MessageID, &msg.ChatID, &msg.SenderID, &msg.MediaURL); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, msg := range messages {
+		data, _ := json.Marshal(map[string]string{"message_id": msg.MessageID})
+		if err := r.logUpdate(ctx, tx, msg.ChatID, models.UpdateDeleteMessage, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// IsMediaReferenced reports whether any message, sent or still scheduled,
+// points at the media URL
+func (r *MessageRepository) IsMediaReferenced(ctx context.Context, mediaURL string) (bool, error) {
+	query := `
+		SELECT EXISTS(SELECT 1 FROM messages WHERE media_url = $1)
+		    OR EXISTS(SELECT 1 FROM scheduled_messages
+		              WHERE status IN ('pending', 'sending') AND body->>'media_url' = $1)`
+	var exists bool
+	err := r.db.QueryRowContext(ctx, query, mediaURL).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,125 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// ForwardCopy is one copy for CreateForwarded to make: the message SourceID
+// posted into ChatID as MessageID
+type ForwardCopy struct {
+	MessageID string
+	SourceID  int
+	ChatID    int
+}
+
+// CreateForwarded copies source messages into chats as new messages from
+// senderID, all in one transaction. A copy points at the same media file
+// rather than a new upload. It is attributed to where the content was first
+// posted, so forwarding a forward keeps the original author, chat and date.
+// The target chat's timer applies to the copy. Deleted, expired and
+// end-to-end encrypted messages cannot be forwarded and yield sql.ErrNoRows,
+// in which case no copy is made.
+func (r *MessageRepository) CreateForwarded(ctx context.Context, senderID int, copies []ForwardCopy) ([]*models.Message, error) {
+	tx, err := r.db.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	messages := make([]*models.Message, 0, len(copies))
+	for _, c := range copies {
+		msg, err := r.createForwarded(ctx, tx, c, senderID)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (r *MessageRepository) createForwarded(ctx context.Context, q rowQuerier, c ForwardCopy, senderID int) (*models.Message, error) {
+	query := `
+		INSERT INTO messages (message_id, chat_id, sender_id, message_type, content, media_url, media_type, file_size, duration,
+			forwarded_from_user_id, forwarded_from_chat_id, forwarded_date, expires_at)
+		SELECT $1, $2, $3, m.message_type, m.content, m.media_url, m.media_type, m.file_size, m.duration,
+			CASE WHEN m.forwarded_date IS NULL THEN m.sender_id ELSE m.forwarded_from_user_id END,
+			CASE WHEN m.forwarded_date IS NULL THEN m.chat_id ELSE m.forwarded_from_chat_id END,
+			COALESCE(m.forwarded_date, m.created_at),
+			CURRENT_TIMESTAMP + INTERVAL '1 second' * (SELECT message_ttl FROM chats WHERE id = $2)
+		FROM messages m
+		WHERE m.id = $4
+		  AND m.is_deleted = false
+		  AND COALESCE(m.encrypted, false) = false
+		  AND (m.expires_at IS NULL OR m.expires_at > CURRENT_TIMESTAMP)
+		RETURNING id, COALESCE(pts, id), message_type, content, media_url, media_type, file_size, duration,
+			forwarded_from_user_id, forwarded_from_chat_id, forwarded_date, expires_at, created_at, updated_at`
+
+	msg := &models.Message{
+		MessageID: c.MessageID,
+		ChatID:    c.ChatID,
+		SenderID:  senderID,
+	}
+	var mediaURL, mediaType sql.NullString
+	var fileSize, duration sql.NullInt64
+	var fromUserID, fromChatID sql.NullInt64
+	var forwardedDate, expiresAt sql.NullTime
+	err := q.QueryRowContext(ctx, query, c.MessageID, c.ChatID, senderID, c.SourceID).Scan(
+		&msg.ID, &msg.Pts, &msg.MessageType, &msg.Content, &mediaURL, &mediaType, &fileSize, &duration,
+		&fromUserID, &fromChatID, &forwardedDate, &expiresAt, &msg.CreatedAt, &msg.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.MediaURL = mediaURL.String
+	msg.MediaType = mediaType.String
+	if fileSize.Valid {
+		msg.FileSize = &fileSize.Int64
+	}
+	if duration.Valid {
+		d := int(duration.Int64)
+		msg.Duration = &d
+	}
+	msg.Forward = forwardInfo(fromUserID, fromChatID, forwardedDate)
+	if expiresAt.Valid {
+		msg.ExpiresAt = &expiresAt.Time
+	}
+	return msg, nil
+}
+
+// IsMediaSharedWith reports whether a live message other than exceptID, such
+// as a forwarded copy, or a pending scheduled message points at the media URL
+func (r *MessageRepository) IsMediaSharedWith(ctx context.Context, mediaURL string, exceptID int) (bool, error) {
+	query := `
+		SELECT EXISTS(SELECT 1 FROM messages WHERE media_url = $1 AND id <> $2 AND is_deleted = false)
+		    OR EXISTS(SELECT 1 FROM scheduled_messages
+		              WHERE status IN ('pending', 'sending') AND body->>'media_url' = $1)`
+	var exists bool
+	err := r.db.QueryRowContext(ctx, query, mediaURL, exceptID).Scan(&exists)
+	return exists, err
+}
+
+// forwardInfo builds the attribution from the forwarded_* columns, nil for a
+// message that was not forwarded
+func forwardInfo(fromUserID, fromChatID sql.NullInt64, date sql.NullTime) *models.ForwardInfo {
+	if !date.Valid {
+		return nil
+	}
+	info := &models.ForwardInfo{Date: date.Time}
+	if fromUserID.Valid {
+		id := int(fromUserID.Int64)
+		info.FromUserID = &id
+	}
+	if fromChatID.Valid {
+		id := int(fromChatID.Int64)
+		info.FromChatID = &id
+	}
+	return info
+}
@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// locationColumns are read by scanLocation, in this order
+const locationColumns = `l.latitude, l.longitude, l.accuracy, l.venue, l.live_until,
+	l.stopped_at IS NULL AND l.live_until > CURRENT_TIMESTAMP, l.updated_at`
+
+// scanLocation scans dest followed by locationColumns
+func scanLocation(row rowScanner, dest ...interface{}) (*models.Location, error) {
+	loc := &models.Location{}
+	var accuracy sql.NullFloat64
+	var venue sql.NullString
+	var liveUntil sql.NullTime
+	var live sql.NullBool
+	dest = append(dest, &loc.Latitude, &loc.Longitude, &accuracy, &venue, &liveUntil, &live, &loc.UpdatedAt)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	if accuracy.Valid {
+		loc.Accuracy = &accuracy.Float64
+	}
+	loc.Venue = venue.String
+	if liveUntil.Valid {
+		loc.LiveUntil = &liveUntil.Time
+	}
+	loc.Live = live.Bool
+	return loc, nil
+}
+
+// CreateLocationMessage creates a location message together with its
+// location, live for loc.LivePeriod seconds if set
+func (r *MessageRepository) CreateLocationMessage(ctx context.Context, msg *models.Message, loc *models.NewLocation) error {
+	tx, err := r.db.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := r.insert(ctx, tx, msg); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO message_locations (message_id, latitude, longitude, accuracy, venue, live_until)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''),
+			CASE WHEN $6 > 0 THEN CURRENT_TIMESTAMP + INTERVAL '1 second' * $6 END)`,
+		msg.ID, loc.Latitude, loc.Longitude, loc.Accuracy, loc.Venue, loc.LivePeriod)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetLocations returns the locations of the given messages. Messages without
+// one are absent from the result.
+func (r *MessageRepository) GetLocations(ctx context.Context, messageIDs []int) (map[int]*models.Location, error) {
+	locations := make(map[int]*models.Location)
+	if len(messageIDs) == 0 {
+		return locations, nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT l.message_id, `+locationColumns+`
+		FROM message_locations l
+		WHERE l.message_id = ANY($1)`, pq.Array(messageIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int
+		loc, err := scanLocation(rows, &messageID)
+		if err != nil {
+			return nil, err
+		}
+		locations[messageID] = loc
+	}
+	return locations, rows.Err()
+}
+
+// UpdateLiveLocation moves a live location that is still being shared. It
+// returns sql.ErrNoRows when the location is not live (any more).
+func (r *MessageRepository) UpdateLiveLocation(ctx context.Context, messageID int, latitude, longitude float64, accuracy *float64) (*models.Location, error) {
+	row := r.db.QueryRowContext(ctx, `
+		UPDATE message_locations l
+		SET latitude = $2, longitude = $3, accuracy = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE l.message_id = $1 AND l.stopped_at IS NULL AND l.live_until > CURRENT_TIMESTAMP
+		RETURNING `+locationColumns, messageID, latitude, longitude, accuracy)
+	return scanLocation(row)
+}
+
+// StopLiveLocation ends sharing a live location early. It returns
+// sql.ErrNoRows when the location is not live (any more).
+func (r *MessageRepository) StopLiveLocation(ctx context.Context, messageID int) (*models.Location, error) {
+	row := r.db.QueryRowContext(ctx, `
+		UPDATE message_locations l
+		SET stopped_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE l.message_id = $1 AND l.stopped_at IS NULL AND l.live_until > CURRENT_TIMESTAMP
+		RETURNING `+locationColumns, messageID)
+	return scanLocation(row)
+}
+
+// EndExpiredLiveLocations marks up to limit live locations whose period ran
+// out as stopped and returns their messages with the final location. Rows
+// another sweeper is ending are skipped.
+func (r *MessageRepository) EndExpiredLiveLocations(ctx context.Context, limit int) ([]*models.Message, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE message_locations l
+		SET stopped_at = l.live_until
+		FROM messages m
+		WHERE m.id = l.message_id AND l.message_id IN (
+			SELECT message_id FROM message_locations
+			WHERE stopped_at IS NULL AND live_until <= CURRENT_TIMESTAMP
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING m.id, m.message_id, m.chat_id, m.sender_id, `+locationColumns, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ended []*models.Message
+	for rows.Next() {
+		msg := &models.Message{MessageType: "location"}
+		loc, err := scanLocation(rows, &msg.ID, &msg.MessageID, &msg.ChatID, &msg.SenderID)
+		if err != nil {
+			return nil, err
+		}
+		msg.Location = loc
+		ended = append(ended, msg)
+	}
+	return ended, rows.Err()
+}
@@ -0,0 +1,184 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// GetMentionTargets looks up the users named by username or ID, with whether
+// each is a member of the chat and whether a block stands between them and
+// the sender. Names and IDs matching no user are absent from the result.
+func (r *MessageRepository) GetMentionTargets(ctx context.Context, chatID, senderID int, usernames []string, userIDs []int) ([]models.MentionTarget, error) {
+	query := `
+		SELECT u.id, u.username,
+		       EXISTS (SELECT 1 FROM chat_members cm WHERE cm.chat_id = $1 AND cm.user_id = u.id),
+		       EXISTS (
+		           SELECT 1 FROM contacts b
+		           WHERE b.status = 'blocked'
+		             AND ((b.user_id = $2 AND b.contact_user_id = u.id) OR (b.user_id = u.id AND b.contact_user_id = $2))
+		       )
+		FROM users u
+		WHERE u.username = ANY($3) OR u.id = ANY($4)`
+
+	rows, err := r.db.QueryContext(ctx, query, chatID, senderID, pq.Array(usernames), pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []models.MentionTarget
+	for rows.Next() {
+		var target models.MentionTarget
+		if err := rows.Scan(&target.UserID, &target.Username, &target.IsMember, &target.Blocked); err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, rows.Err()
+}
+
+// SaveMentions stores the message's mentions. Those of the sender are stored
+// as already read.
+func (r *MessageRepository) SaveMentions(ctx context.Context, msg *models.Message) error {
+	return saveMentions(ctx, r.db, msg, nil)
+}
+
+// execer is what saveMentions needs from a database handle or a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// saveMentions stores the message's mentions, as read for the sender and for
+// readUserIDs
+func saveMentions(ctx context.Context, q execer, msg *models.Message, readUserIDs []int) error {
+	if len(msg.Mentions) == 0 {
+		return nil
+	}
+
+	userIDs := make([]int, 0, len(msg.Mentions))
+	offsets := make([]int, 0, len(msg.Mentions))
+	lengths := make([]int, 0, len(msg.Mentions))
+	for _, mention := range msg.Mentions {
+		userIDs = append(userIDs, mention.UserID)
+		offsets = append(offsets, mention.Offset)
+		lengths = append(lengths, mention.Length)
+	}
+
+	query := `
+		INSERT INTO message_mentions (message_id, chat_id, user_id, span_offset, span_length, is_read)
+		SELECT $1, $2, m.user_id, m.span_offset, m.span_length, m.user_id = $3 OR m.user_id = ANY(COALESCE($7::int[], '{}'))
+		FROM unnest($4::int[], $5::int[], $6::int[]) AS m(user_id, span_offset, span_length)
+		ON CONFLICT DO NOTHING`
+
+	_, err := q.ExecContext(ctx, query, msg.ID, msg.ChatID, msg.SenderID,
+		pq.Array(userIDs), pq.Array(offsets), pq.Array(lengths), pq.Array(readUserIDs))
+	return err
+}
+
+// replaceMentions swaps the stored mentions of the message for msg.Mentions.
+// Users who had read a mention of the message keep it read.
+func replaceMentions(ctx context.Context, tx *sql.Tx, msg *models.Message) error {
+	rows, err := tx.QueryContext(ctx, `
+		DELETE FROM message_mentions
+		WHERE message_id = $1
+		RETURNING user_id, is_read`, msg.ID)
+	if err != nil {
+		return err
+	}
+	var readUserIDs []int
+	for rows.Next() {
+		var userID int
+		var isRead bool
+		if err := rows.Scan(&userID, &isRead); err != nil {
+			rows.Close()
+			return err
+		}
+		if isRead {
+			readUserIDs = append(readUserIDs, userID)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return saveMentions(ctx, tx, msg, readUserIDs)
+}
+
+// GetMentions returns the mentions of each of the given messages in text
+// order. Messages without mentions are absent from the result.
+func (r *MessageRepository) GetMentions(ctx context.Context, messageIDs []int) (map[int][]models.MentionEntity, error) {
+	mentions := make(map[int][]models.MentionEntity)
+	if len(messageIDs) == 0 {
+		return mentions, nil
+	}
+
+	query := `
+		SELECT message_id, user_id, span_offset, span_length
+		FROM message_mentions
+		WHERE message_id = ANY($1)
+		ORDER BY message_id, span_offset`
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(messageIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int
+		var mention models.MentionEntity
+		if err := rows.Scan(&messageID, &mention.UserID, &mention.Offset, &mention.Length); err != nil {
+			return nil, err
+		}
+		mentions[messageID] = append(mentions[messageID], mention)
+	}
+	return mentions, rows.Err()
+}
+
+// NextUnreadMention marks read the user's oldest unread mention in the chat
+// after afterID and returns the ID of its message. It returns sql.ErrNoRows
+// when none is left. Mentions in deleted, expired or hidden messages are
+// skipped.
+func (r *MessageRepository) NextUnreadMention(ctx context.Context, chatID, userID, afterID int) (int, error) {
+	query := `
+		UPDATE message_mentions
+		SET is_read = true
+		WHERE user_id = $2 AND message_id = (
+			SELECT mm.message_id
+			FROM message_mentions mm
+			JOIN messages m ON m.id = mm.message_id
+			WHERE mm.chat_id = $1 AND mm.user_id = $2 AND mm.is_read = false
+			  AND mm.message_id > $3
+			  AND m.is_deleted = false
+			  AND (m.expires_at IS NULL OR m.expires_at > CURRENT_TIMESTAMP)
+			  AND NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.message_id = m.id AND h.user_id = $2)
+			ORDER BY mm.message_id ASC
+			LIMIT 1
+		)
+		RETURNING message_id`
+
+	var messageID int
+	err := r.db.QueryRowContext(ctx, query, chatID, userID, afterID).Scan(&messageID)
+	return messageID, err
+}
+
+// CountUnreadMentions returns how many messages of the chat mention the user
+// and are still unread
+func (r *MessageRepository) CountUnreadMentions(ctx context.Context, chatID, userID int) (int, error) {
+	query := `
+		SELECT COUNT(DISTINCT mm.message_id)
+		FROM message_mentions mm
+		JOIN messages m ON m.id = mm.message_id
+		WHERE mm.chat_id = $1 AND mm.user_id = $2 AND mm.is_read = false
+		  AND m.is_deleted = false
+		  AND (m.expires_at IS NULL OR m.expires_at > CURRENT_TIMESTAMP)
+		  AND NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.message_id = m.id AND h.user_id = $2)`
+
+	var count int
+	err := r.db.QueryRowContext(ctx, query, chatID, userID).Scan(&count)
+	return count, err
+}
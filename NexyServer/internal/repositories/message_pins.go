@@ -0,0 +1,86 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// PinMessage pins the message in its chat, for every member when forUserID is
+// nil or only for that user otherwise. It reports false if it already was.
+func (r *MessageRepository) PinMessage(ctx context.Context, chatID, messageID, pinnedBy int, forUserID *int) (bool, error) {
+	query := `
+		INSERT INTO pinned_messages (chat_id, message_id, pinned_by, for_user_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING`
+
+	result, err := r.db.ExecContext(ctx, query, chatID, messageID, pinnedBy, forUserID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// UnpinMessage removes the shared pin when forUserID is nil, or that user's
+// own pin otherwise. It reports false if there was no such pin.
+func (r *MessageRepository) UnpinMessage(ctx context.Context, chatID, messageID int, forUserID *int) (bool, error) {
+	query := `
+		DELETE FROM pinned_messages
+		WHERE chat_id = $1 AND message_id = $2 AND for_user_id IS NOT DISTINCT FROM $3`
+
+	result, err := r.db.ExecContext(ctx, query, chatID, messageID, forUserID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// GetPinnedMessages returns the chat's shared pins and the user's own ones,
+// newest first. Pins of deleted or expired messages, or of messages the user
+// deleted for themselves, are left out.
+func (r *MessageRepository) GetPinnedMessages(ctx context.Context, chatID, userID int) ([]*models.PinnedMessage, error) {
+	query := `
+		SELECT m.id, m.message_id, m.chat_id, m.sender_id, m.message_type, m.content, m.media_url, m.media_type,
+			   m.created_at, m.updated_at, p.pinned_by, p.pinned_at, p.for_user_id IS NOT NULL
+		FROM pinned_messages p
+		JOIN messages m ON m.id = p.message_id
+		WHERE p.chat_id = $1
+		  AND (p.for_user_id IS NULL OR p.for_user_id = $2)
+		  AND m.is_deleted = false
+		  AND (m.expires_at IS NULL OR m.expires_at > CURRENT_TIMESTAMP)
+		  AND NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.message_id = m.id AND h.user_id = $2)
+		ORDER BY p.pinned_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pins []*models.PinnedMessage
+	for rows.Next() {
+		msg := &models.Message{}
+		pin := &models.PinnedMessage{Message: msg}
+		var mediaURL, mediaType sql.NullString
+		var pinnedBy sql.NullInt64
+		err := rows.Scan(
+			&msg.ID, &msg.MessageID, &msg.ChatID, &msg.SenderID, &msg.MessageType, &msg.Content, &mediaURL, &mediaType,
+			&msg.CreatedAt, &msg.UpdatedAt, &pinnedBy, &pin.PinnedAt, &pin.ForMe,
+		)
+		if err != nil {
+			return nil, err
+		}
+		msg.MediaURL = mediaURL.String
+		msg.MediaType = mediaType.String
+		if pinnedBy.Valid {
+			id := int(pinnedBy.Int64)
+			pin.PinnedBy = &id
+		}
+		pins = append(pins, pin)
+	}
+
+	return pins, rows.Err()
+}
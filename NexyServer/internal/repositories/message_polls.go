@@ -0,0 +1,254 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// CreatePollMessage creates a poll message together with its poll
+func (r *MessageRepository) CreatePollMessage(ctx context.Context, msg *models.Message, poll *models.NewPoll) error {
+	tx, err := r.db.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := r.insert(ctx, tx, msg); err != nil {
+		return err
+	}
+
+	var pollID int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO polls (message_id, question, multiple_choice, public_voters, quiz, correct_option, close_at)
+		VALUES ($1, $2, $3, $4, $5, $6, to_timestamp($7)::timestamp)
+		RETURNING id`,
+		msg.ID, poll.Question, poll.MultipleChoice, poll.PublicVoters, poll.Quiz, poll.CorrectOption, poll.CloseAt,
+	).Scan(&pollID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO poll_options (poll_id, option_index, text)
+		SELECT $1, o.ordinality - 1, o.text
+		FROM unnest($2::text[]) WITH ORDINALITY AS o(text, ordinality)`,
+		pollID, pq.Array(poll.Options))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetPolls returns the polls of the given messages with their results as
+// userID sees them (0 for nobody in particular). Messages without a poll are
+// absent from the result.
+func (r *MessageRepository) GetPolls(ctx context.Context, messageIDs []int, userID int) (map[int]*models.Poll, error) {
+	polls := make(map[int]*models.Poll)
+	if len(messageIDs) == 0 {
+		return polls, nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT p.id, p.message_id, m.sender_id, p.question, p.multiple_choice, p.public_voters, p.quiz,
+		       p.correct_option, p.close_at, p.closed_at,
+		       p.closed_at IS NOT NULL OR (p.close_at IS NOT NULL AND p.close_at <= CURRENT_TIMESTAMP),
+		       (SELECT COUNT(DISTINCT v.user_id) FROM poll_votes v WHERE v.poll_id = p.id)
+		FROM polls p
+		JOIN messages m ON m.id = p.message_id
+		WHERE p.message_id = ANY($1)`, pq.Array(messageIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int]*models.Poll)
+	var pollIDs []int
+	for rows.Next() {
+		poll := &models.Poll{}
+		var correctOption sql.NullInt64
+		var closeAt, closedAt sql.NullTime
+		err := rows.Scan(&poll.ID, &poll.MessageID, &poll.CreatedBy, &poll.Question, &poll.MultipleChoice,
+			&poll.PublicVoters, &poll.Quiz, &correctOption, &closeAt, &closedAt, &poll.Closed, &poll.TotalVoters)
+		if err != nil {
+			return nil, err
+		}
+		if correctOption.Valid {
+			option := int(correctOption.Int64)
+			poll.CorrectOption = &option
+		}
+		if closeAt.Valid {
+			poll.CloseAt = &closeAt.Time
+		}
+		if closedAt.Valid {
+			poll.ClosedAt = &closedAt.Time
+		}
+		polls[poll.MessageID] = poll
+		byID[poll.ID] = poll
+		pollIDs = append(pollIDs, poll.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(pollIDs) == 0 {
+		return polls, nil
+	}
+
+	if err := r.loadPollOptions(ctx, byID, pollIDs, userID); err != nil {
+		return nil, err
+	}
+
+	// A quiz keeps its answer from whoever could still guess it
+	for _, poll := range polls {
+		if poll.Quiz && !poll.Closed && len(poll.MyVotes) == 0 && poll.CreatedBy != userID {
+			poll.CorrectOption = nil
+		}
+	}
+	return polls, nil
+}
+
+// loadPollOptions fills in the options of the polls with their vote counts,
+// the voters of public polls and the votes of userID
+func (r *MessageRepository) loadPollOptions(ctx context.Context, polls map[int]*models.Poll, pollIDs []int, userID int) error {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT o.poll_id, o.option_index, o.text, COUNT(v.user_id),
+		       COALESCE(array_agg(v.user_id ORDER BY v.voted_at) FILTER (WHERE p.public_voters AND v.user_id IS NOT NULL), '{}'),
+		       COALESCE(bool_or(v.user_id = $2), false)
+		FROM poll_options o
+		JOIN polls p ON p.id = o.poll_id
+		LEFT JOIN poll_votes v ON v.poll_id = o.poll_id AND v.option_index = o.option_index
+		WHERE o.poll_id = ANY($1)
+		GROUP BY o.poll_id, o.option_index, o.text
+		ORDER BY o.poll_id, o.option_index`, pq.Array(pollIDs), userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pollID, index int
+		var option models.PollOption
+		var voterIDs pq.Int64Array
+		var mine bool
+		if err := rows.Scan(&pollID, &index, &option.Text, &option.Voters, &voterIDs, &mine); err != nil {
+			return err
+		}
+		for _, id := range voterIDs {
+			option.VoterIDs = append(option.VoterIDs, int(id))
+		}
+
+		poll := polls[pollID]
+		poll.Options = append(poll.Options, option)
+		if mine {
+			poll.MyVotes = append(poll.MyVotes, index)
+		}
+	}
+	return rows.Err()
+}
+
+// VotePoll replaces the user's votes in an open poll with the given option
+// indexes, or withdraws them when there are none. With final set, a user who
+// already voted cannot vote again, and false is returned. It returns
+// sql.ErrNoRows when the poll is closed.
+func (r *MessageRepository) VotePoll(ctx context.Context, pollID, userID int, options []int, final bool) (bool, error) {
+	tx, err := r.db.BeginTx(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Lock the poll so it cannot close, or take a second answer, meanwhile
+	var id int
+	err = tx.QueryRowContext(ctx, `
+		SELECT id FROM polls
+		WHERE id = $1 AND closed_at IS NULL AND (close_at IS NULL OR close_at > CURRENT_TIMESTAMP)
+		FOR UPDATE`, pollID).Scan(&id)
+	if err != nil {
+		return false, err
+	}
+
+	if final {
+		var voted bool
+		err := tx.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM poll_votes WHERE poll_id = $1 AND user_id = $2)`, pollID, userID).Scan(&voted)
+		if err != nil {
+			return false, err
+		}
+		if voted {
+			return false, nil
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM poll_votes WHERE poll_id = $1 AND user_id = $2`, pollID, userID); err != nil {
+		return false, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO poll_votes (poll_id, option_index, user_id)
+		SELECT $1, option_index, $2 FROM unnest($3::int[]) AS option_index`,
+		pollID, userID, pq.Array(options))
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// ClosePoll stops a poll taking votes. It reports false if it already had.
+func (r *MessageRepository) ClosePoll(ctx context.Context, pollID int) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE polls
+		SET closed_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND closed_at IS NULL AND (close_at IS NULL OR close_at > CURRENT_TIMESTAMP)`, pollID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// CloseDuePolls closes up to limit polls whose close time has passed and
+// returns their messages with the final results, as nobody in particular sees
+// them. Polls another sweeper is closing are skipped.
+func (r *MessageRepository) CloseDuePolls(ctx context.Context, limit int) ([]*models.Message, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE polls p
+		SET closed_at = p.close_at
+		FROM messages m
+		WHERE m.id = p.message_id AND p.id IN (
+			SELECT id FROM polls
+			WHERE closed_at IS NULL AND close_at <= CURRENT_TIMESTAMP
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING m.id, m.message_id, m.chat_id, m.sender_id`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var closed []*models.Message
+	var messageIDs []int
+	for rows.Next() {
+		msg := &models.Message{MessageType: "poll"}
+		if err := rows.Scan(&msg.ID, &msg.MessageID, &msg.ChatID, &msg.SenderID); err != nil {
+			return nil, err
+		}
+		closed = append(closed, msg)
+		messageIDs = append(messageIDs, msg.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	polls, err := r.GetPolls(ctx, messageIDs, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range closed {
+		msg.Poll = polls[msg.ID]
+	}
+	return closed, nil
+}
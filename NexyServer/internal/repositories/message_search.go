@@ -8,7 +8,7 @@ import (
 )
 
 // SearchMessages searches for messages in a chat
-func (r *MessageRepository) SearchMessages(ctx context.Context, chatID int, queryStr string) ([]*models.Message, error) {
+func (r *MessageRepository) SearchMessages(ctx context.Context, chatID, userID int, queryStr string) ([]*models.Message, error) {
 	query := `
 		SELECT m.id, m.message_id, m.chat_id, m.sender_id, m.message_type, m.content, m.media_url, m.media_type,
 			   m.file_size, m.duration, m.reply_to_id, m.is_edited, m.is_deleted, m.created_at, m.updated_at,
@@ -18,10 +18,12 @@ func (r *MessageRepository) SearchMessages(ctx context.Context, chatID int, quer
 			   ) as status
 		FROM messages m
 		WHERE m.chat_id = $1 AND m.is_deleted = false AND m.content ILIKE $2
+		  AND (m.expires_at IS NULL OR m.expires_at > CURRENT_TIMESTAMP)
+		  AND NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.message_id = m.id AND h.user_id = $3)
 		ORDER BY m.created_at DESC
 		LIMIT 50`
 
-	rows, err := r.db.QueryContext(ctx, query, chatID, "%"+queryStr+"%")
+	rows, err := r.db.QueryContext(ctx, query, chatID, "%"+queryStr+"%", userID)
 	if err != nil {
 		return nil, err
 	}
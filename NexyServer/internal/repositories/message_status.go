@@ -18,7 +18,8 @@ func (r *MessageRepository) UpdateStatus(ctx context.Context, status *models.Mes
 }
 
 // MarkMessagesAsRead marks all messages up to a certain point as read
-// Also updates last_read_message_id in chat_members
+// Also updates last_read_message_id in chat_members and reads the mentions
+// up to that point
 func (r *MessageRepository) MarkMessagesAsRead(ctx context.Context, chatID, userID, lastMessageID int) error {
 	// Update message_status for backward compatibility
 	query := `
@@ -42,7 +43,17 @@ func (r *MessageRepository) MarkMessagesAsRead(ctx context.Context, chatID, user
 		SET last_read_message_id = GREATEST(COALESCE(last_read_message_id, 0), $3)
 		WHERE chat_id = $1 AND user_id = $2`
 
-	_, err := r.db.ExecContext(ctx, updateQuery, chatID, userID, lastMessageID)
+	if _, err := r.db.ExecContext(ctx, updateQuery, chatID, userID, lastMessageID); err != nil {
+		return err
+	}
+
+	// Mentions the user has read past no longer count as unread
+	mentionsQuery := `
+		UPDATE message_mentions
+		SET is_read = true
+		WHERE chat_id = $1 AND user_id = $2 AND message_id <= $3 AND is_read = false`
+
+	_, err := r.db.ExecContext(ctx, mentionsQuery, chatID, userID, lastMessageID)
 	return err
 }
 
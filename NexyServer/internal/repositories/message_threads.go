@@ -0,0 +1,135 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// GetThreadInfo summarizes the replies to each of the given messages of the
+// chat as userID sees them, leaving out replies they deleted for themselves.
+// With userID 0 the summary is the one shared by all members, without unread
+// counts. Messages without replies or of another chat are absent from the
+// result. Replies posted to another chat are never counted, whatever their
+// reply_to_id says.
+func (r *MessageRepository) GetThreadInfo(ctx context.Context, chatID int, parentIDs []int, userID int) (map[int]*models.ThreadInfo, error) {
+	threads := make(map[int]*models.ThreadInfo)
+	if len(parentIDs) == 0 {
+		return threads, nil
+	}
+
+	query := `
+		SELECT p.id, s.reply_count, s.unread_count, l.id, l.sender_id, l.created_at
+		FROM unnest($2::int[]) AS p(id)
+		JOIN messages pm ON pm.id = p.id AND pm.chat_id = $1
+		CROSS JOIN LATERAL (
+			SELECT COUNT(*) AS reply_count,
+			       COUNT(*) FILTER (WHERE $3 <> 0 AND r.sender_id <> $3 AND r.id > COALESCE(
+			           (SELECT last_read_reply_id FROM thread_read_state WHERE user_id = $3 AND message_id = p.id), 0)
+			       ) AS unread_count
+			FROM messages r
+			WHERE r.reply_to_id = p.id AND r.chat_id = $1
+			  AND r.is_deleted = false
+			  AND (r.expires_at IS NULL OR r.expires_at > CURRENT_TIMESTAMP)
+			  AND NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.message_id = r.id AND h.user_id = $3)
+		) s
+		JOIN LATERAL (
+			SELECT r.id, r.sender_id, r.created_at
+			FROM messages r
+			WHERE r.reply_to_id = p.id AND r.chat_id = $1
+			  AND r.is_deleted = false
+			  AND (r.expires_at IS NULL OR r.expires_at > CURRENT_TIMESTAMP)
+			  AND NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.message_id = r.id AND h.user_id = $3)
+			ORDER BY r.id DESC
+			LIMIT 1
+		) l ON true`
+
+	rows, err := r.db.QueryContext(ctx, query, chatID, pq.Array(parentIDs), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var parentID int
+		thread := &models.ThreadInfo{}
+		if err := rows.Scan(&parentID, &thread.ReplyCount, &thread.UnreadCount,
+			&thread.LastReplyID, &thread.LastReplySenderID, &thread.LastReplyAt); err != nil {
+			return nil, err
+		}
+		threads[parentID] = thread
+	}
+
+	return threads, rows.Err()
+}
+
+// GetReplies returns the replies to a message of the chat, oldest first,
+// without those userID deleted for themselves
+func (r *MessageRepository) GetReplies(ctx context.Context, chatID, parentID, userID, limit, offset int) ([]*models.Message, error) {
+	query := `
+		SELECT id, message_id, chat_id, sender_id, message_type, content, media_url, media_type,
+			   file_size, duration, reply_to_id, is_edited, expires_at, created_at, updated_at
+		FROM messages m
+		WHERE reply_to_id = $1 AND chat_id = $2
+		  AND is_deleted = false
+		  AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+		  AND NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.message_id = m.id AND h.user_id = $3)
+		ORDER BY id ASC
+		LIMIT $4 OFFSET $5`
+
+	rows, err := r.db.QueryContext(ctx, query, parentID, chatID, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*models.Message
+	for rows.Next() {
+		msg := &models.Message{}
+		var mediaURL, mediaType sql.NullString
+		var fileSize, duration, replyToID sql.NullInt64
+		var expiresAt sql.NullTime
+		err := rows.Scan(
+			&msg.ID, &msg.MessageID, &msg.ChatID, &msg.SenderID, &msg.MessageType, &msg.Content, &mediaURL, &mediaType,
+			&fileSize, &duration, &replyToID, &msg.IsEdited, &expiresAt, &msg.CreatedAt, &msg.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		msg.MediaURL = mediaURL.String
+		msg.MediaType = mediaType.String
+		if fileSize.Valid {
+			msg.FileSize = &fileSize.Int64
+		}
+		if duration.Valid {
+			d := int(duration.Int64)
+			msg.Duration = &d
+		}
+		if replyToID.Valid {
+			id := int(replyToID.Int64)
+			msg.ReplyToID = &id
+		}
+		if expiresAt.Valid {
+			msg.ExpiresAt = &expiresAt.Time
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// MarkThreadRead records that the user has seen the thread up to replyID.
+// The read position never moves back.
+func (r *MessageRepository) MarkThreadRead(ctx context.Context, userID, parentID, replyID int) error {
+	query := `
+		INSERT INTO thread_read_state (user_id, message_id, last_read_reply_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, message_id) DO UPDATE
+		SET last_read_reply_id = GREATEST(thread_read_state.last_read_reply_id, EXCLUDED.last_read_reply_id),
+		    updated_at = CURRENT_TIMESTAMP`
+
+	_, err := r.db.ExecContext(ctx, query, userID, parentID, replyID)
+	return err
+}
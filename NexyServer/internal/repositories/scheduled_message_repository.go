@@ -0,0 +1,201 @@
+/*
+ * © 2025 Murr | https://github.com/vtstv
+ */
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/vtstv/nexy/internal/models"
+)
+
+type ScheduledMessageRepository struct {
+	db *sql.DB
+}
+
+func NewScheduledMessageRepository(db *sql.DB) *ScheduledMessageRepository {
+	return &ScheduledMessageRepository{db: db}
+}
+
+const scheduledMessageColumns = `id, message_id, chat_id, sender_id, body, send_at, status, attempts,
+		COALESCE(last_error, ''), sent_at, created_at, updated_at`
+
+func (r *ScheduledMessageRepository) Create(ctx context.Context, msg *models.ScheduledMessage) error {
+	query := `
+		INSERT INTO scheduled_messages (message_id, chat_id, sender_id, body, send_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, status, created_at, updated_at`
+
+	return r.db.QueryRowContext(ctx, query,
+		msg.MessageID,
+		msg.ChatID,
+		msg.SenderID,
+		[]byte(msg.Body),
+		msg.SendAt,
+	).Scan(&msg.ID, &msg.Status, &msg.CreatedAt, &msg.UpdatedAt)
+}
+
+func (r *ScheduledMessageRepository) GetByID(ctx context.Context, id int) (*models.ScheduledMessage, error) {
+	query := `SELECT ` + scheduledMessageColumns + ` FROM scheduled_messages WHERE id = $1`
+
+	msg, err := scanScheduledMessage(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return msg, err
+}
+
+// GetPending lists the user's messages still waiting to be sent, soonest
+// first. A zero chatID lists them across all chats.
+func (r *ScheduledMessageRepository) GetPending(ctx context.Context, senderID, chatID int) ([]*models.ScheduledMessage, error) {
+	query := `
+		SELECT ` + scheduledMessageColumns + `
+		FROM scheduled_messages
+		WHERE sender_id = $1 AND status = 'pending' AND ($2 = 0 OR chat_id = $2)
+		ORDER BY send_at ASC`
+
+	rows, err := r.db.QueryContext(ctx, query, senderID, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*models.ScheduledMessage
+	for rows.Next() {
+		msg, err := scanScheduledMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// Update replaces the body and send time of a pending message. It reports
+// false once the message has been claimed for sending or cancelled.
+func (r *ScheduledMessageRepository) Update(ctx context.Context, msg *models.ScheduledMessage) (bool, error) {
+	query := `
+		UPDATE scheduled_messages
+		SET body = $1, send_at = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND sender_id = $4 AND status = 'pending'
+		RETURNING updated_at`
+
+	err := r.db.QueryRowContext(ctx, query, []byte(msg.Body), msg.SendAt, msg.ID, msg.SenderID).Scan(&msg.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Cancel stops a pending message from being sent, reporting false if it was
+// no longer pending
+func (r *ScheduledMessageRepository) Cancel(ctx context.Context, id, senderID int) (bool, error) {
+	query := `
+		UPDATE scheduled_messages
+		SET status = 'cancelled', updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND sender_id = $2 AND status = 'pending'`
+
+	result, err := r.db.ExecContext(ctx, query, id, senderID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// ClaimDue marks up to limit due messages as sending and returns them. Rows
+// locked by another instance are skipped, so each message is claimed by one
+// dispatcher at a time. Claims older than lease are taken over, covering an
+// instance that died mid-send.
+func (r *ScheduledMessageRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*models.ScheduledMessage, error) {
+	query := `
+		UPDATE scheduled_messages
+		SET status = 'sending', claimed_at = CURRENT_TIMESTAMP, attempts = attempts + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id IN (
+			SELECT id FROM scheduled_messages
+			WHERE send_at <= CURRENT_TIMESTAMP
+			  AND (status = 'pending'
+			       OR (status = 'sending' AND claimed_at < CURRENT_TIMESTAMP - INTERVAL '1 second' * $2))
+			ORDER BY send_at ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + scheduledMessageColumns
+
+	rows, err := r.db.QueryContext(ctx, query, limit, int(lease.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*models.ScheduledMessage
+	for rows.Next() {
+		msg, err := scanScheduledMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+func (r *ScheduledMessageRepository) MarkSent(ctx context.Context, id int) error {
+	query := `
+		UPDATE scheduled_messages
+		SET status = 'sent', sent_at = CURRENT_TIMESTAMP, last_error = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+func (r *ScheduledMessageRepository) MarkFailed(ctx context.Context, id int, reason string) error {
+	query := `
+		UPDATE scheduled_messages
+		SET status = 'failed', last_error = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, reason)
+	return err
+}
+
+// Release hands a claimed message back to the queue for another attempt
+func (r *ScheduledMessageRepository) Release(ctx context.Context, id int, reason string) error {
+	query := `
+		UPDATE scheduled_messages
+		SET status = 'pending', claimed_at = NULL, last_error = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'sending'`
+	_, err := r.db.ExecContext(ctx, query, id, reason)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanScheduledMessage(row rowScanner) (*models.ScheduledMessage, error) {
+	msg := &models.ScheduledMessage{}
+	var body []byte
+	var sentAt sql.NullTime
+	if err := row.Scan(
+		&msg.ID,
+		&msg.MessageID,
+		&msg.ChatID,
+		&msg.SenderID,
+		&body,
+		&msg.SendAt,
+		&msg.Status,
+		&msg.Attempts,
+		&msg.LastError,
+		&sentAt,
+		&msg.CreatedAt,
+		&msg.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	msg.Body = body
+	if sentAt.Valid {
+		msg.SentAt = &sentAt.Time
+	}
+	return msg, nil
+}
@@ -75,7 +75,11 @@ func (r *SyncRepository) UpdateChannelSyncState(ctx context.Context, userID, cha
 
 // GetCurrentPts returns the current maximum pts value
 func (r *SyncRepository) GetCurrentPts(ctx context.Context) (int, error) {
-	query := `SELECT COALESCE(MAX(pts), 0) FROM messages`
+	// Deletions logged by the expiry sweeper take pts from the same sequence
+	query := `
+		SELECT GREATEST(
+			(SELECT COALESCE(MAX(pts), 0) FROM messages),
+			(SELECT COALESCE(MAX(pts), 0) FROM updates_log))`
 	var pts int
 	err := r.db.QueryRowContext(ctx, query).Scan(&pts)
 	return pts, err
@@ -108,16 +112,19 @@ func (r *SyncRepository) GetDifference(ctx context.Context, userID int, fromPts
 		SELECT m.id, m.message_id, m.chat_id, m.sender_id, m.message_type, 
 		       m.content, m.media_url, m.media_type, m.file_size, m.reply_to_id,
 		       m.is_edited, m.is_deleted, COALESCE(m.pts, m.id), m.created_at, m.updated_at,
+		       m.forwarded_from_user_id, m.forwarded_from_chat_id, m.forwarded_date,
 		       u.id, u.username, u.email, u.display_name, u.avatar_url, u.bio
 		FROM messages m
 		LEFT JOIN users u ON m.sender_id = u.id
 		WHERE COALESCE(m.pts, m.id) > $1
 		  AND m.chat_id = ANY($2)
 		  AND m.is_deleted = false
+		  AND (m.expires_at IS NULL OR m.expires_at > CURRENT_TIMESTAMP)
+		  AND NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.message_id = m.id AND h.user_id = $4)
 		ORDER BY m.pts ASC
 		LIMIT $3`
 
-	rows, err := r.db.QueryContext(ctx, query, fromPts, pq.Array(chatIDs), limit)
+	rows, err := r.db.QueryContext(ctx, query, fromPts, pq.Array(chatIDs), limit, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -132,11 +139,14 @@ func (r *SyncRepository) GetDifference(ctx context.Context, userID int, fromPts
 		var fileSize sql.NullInt64
 		var replyToID sql.NullInt64
 		var mediaURL, mediaType, content sql.NullString
+		var fromUserID, fromChatID sql.NullInt64
+		var forwardedDate sql.NullTime
 
 		err := rows.Scan(
 			&msg.ID, &msg.MessageID, &msg.ChatID, &msg.SenderID, &msg.MessageType,
 			&content, &mediaURL, &mediaType, &fileSize, &replyToID,
 			&msg.IsEdited, &msg.IsDeleted, &msg.Pts, &msg.CreatedAt, &msg.UpdatedAt,
+			&fromUserID, &fromChatID, &forwardedDate,
 			&sender.ID, &sender.Username, &sender.Email, &sender.DisplayName, &sender.AvatarURL, &sender.Bio,
 		)
 		if err != nil {
@@ -161,6 +171,7 @@ func (r *SyncRepository) GetDifference(ctx context.Context, userID int, fromPts
 			msg.ReplyToID = &id
 		}
 
+		msg.Forward = forwardInfo(fromUserID, fromChatID, forwardedDate)
 		msg.Sender = &sender
 		messages = append(messages, &msg)
 
@@ -169,8 +180,22 @@ func (r *SyncRepository) GetDifference(ctx context.Context, userID int, fromPts
 		}
 	}
 
+	// A full page may stop short of later messages, so only report deletions
+	// up to the last message returned
+	upTo := 0
+	if len(messages) == limit {
+		upTo = maxPts
+	}
+	deleted, deletedPts, err := r.getDeletedMessages(ctx, userID, chatIDs, fromPts, upTo)
+	if err != nil {
+		return nil, err
+	}
+	if deletedPts > maxPts {
+		maxPts = deletedPts
+	}
+
 	// Get current pts if no messages found
-	if len(messages) == 0 {
+	if len(messages) == 0 && len(deleted) == 0 {
 		currentPts, _ := r.GetCurrentPts(ctx)
 		if currentPts > maxPts {
 			maxPts = currentPts
@@ -178,8 +203,9 @@ func (r *SyncRepository) GetDifference(ctx context.Context, userID int, fromPts
 	}
 
 	return &models.UpdatesDifference{
-		NewMessages: messages,
-		State:       models.SyncState{Pts: maxPts, Date: time.Now()},
+		NewMessages:     messages,
+		DeletedMessages: deleted,
+		State:           models.SyncState{Pts: maxPts, Date: time.Now()},
 	}, nil
 }
 
@@ -196,16 +222,19 @@ func (r *SyncRepository) GetChannelDifference(ctx context.Context, userID, chatI
 		SELECT m.id, m.message_id, m.chat_id, m.sender_id, m.message_type,
 		       m.content, m.media_url, m.media_type, m.file_size, m.reply_to_id,
 		       m.is_edited, m.is_deleted, COALESCE(m.pts, m.id), m.created_at, m.updated_at,
+		       m.forwarded_from_user_id, m.forwarded_from_chat_id, m.forwarded_date,
 		       u.id, u.username, u.email, u.display_name, u.avatar_url, u.bio
 		FROM messages m
 		LEFT JOIN users u ON m.sender_id = u.id
 		WHERE m.chat_id = $1
 		  AND COALESCE(m.pts, m.id) > $2
 		  AND m.is_deleted = false
+		  AND (m.expires_at IS NULL OR m.expires_at > CURRENT_TIMESTAMP)
+		  AND NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.message_id = m.id AND h.user_id = $4)
 		ORDER BY m.pts ASC
 		LIMIT $3`
 
-	rows, err := r.db.QueryContext(ctx, query, chatID, fromPts, limit+1) // +1 to check if more exists
+	rows, err := r.db.QueryContext(ctx, query, chatID, fromPts, limit+1, userID) // +1 to check if more exists
 	if err != nil {
 		return nil, err
 	}
@@ -227,11 +256,14 @@ func (r *SyncRepository) GetChannelDifference(ctx context.Context, userID, chatI
 		var fileSize sql.NullInt64
 		var replyToID sql.NullInt64
 		var mediaURL, mediaType, content sql.NullString
+		var fromUserID, fromChatID sql.NullInt64
+		var forwardedDate sql.NullTime
 
 		err := rows.Scan(
 			&msg.ID, &msg.MessageID, &msg.ChatID, &msg.SenderID, &msg.MessageType,
 			&content, &mediaURL, &mediaType, &fileSize, &replyToID,
 			&msg.IsEdited, &msg.IsDeleted, &msg.Pts, &msg.CreatedAt, &msg.UpdatedAt,
+			&fromUserID, &fromChatID, &forwardedDate,
 			&sender.ID, &sender.Username, &sender.Email, &sender.DisplayName, &sender.AvatarURL, &sender.Bio,
 		)
 		if err != nil {
@@ -256,6 +288,7 @@ func (r *SyncRepository) GetChannelDifference(ctx context.Context, userID, chatI
 			msg.ReplyToID = &id
 		}
 
+		msg.Forward = forwardInfo(fromUserID, fromChatID, forwardedDate)
 		msg.Sender = &sender
 		messages = append(messages, &msg)
 
@@ -264,13 +297,62 @@ func (r *SyncRepository) GetChannelDifference(ctx context.Context, userID, chatI
 		}
 	}
 
+	upTo := 0
+	if count > limit {
+		upTo = maxPts
+	}
+	deleted, deletedPts, err := r.getDeletedMessages(ctx, userID, []int{chatID}, fromPts, upTo)
+	if err != nil {
+		return nil, err
+	}
+	if deletedPts > maxPts {
+		maxPts = deletedPts
+	}
+
 	return &models.ChannelDifference{
-		Final:       count <= limit,
-		NewMessages: messages,
-		Pts:         maxPts,
+		Final:           count <= limit,
+		NewMessages:     messages,
+		DeletedMessages: deleted,
+		Pts:             maxPts,
 	}, nil
 }
 
+// getDeletedMessages returns the message IDs of messages deleted, or hidden
+// by the user, after fromPts (and up to upTo, if set) and the highest pts
+// among them
+func (r *SyncRepository) getDeletedMessages(ctx context.Context, userID int, chatIDs []int, fromPts, upTo int) ([]string, int, error) {
+	query := `
+		SELECT pts, update_data->>'message_id'
+		FROM updates_log
+		WHERE (update_type = $1 OR (update_type = $5 AND (update_data->>'user_id')::int = $6))
+		  AND chat_id = ANY($2)
+		  AND pts > $3
+		  AND ($4 = 0 OR pts <= $4)
+		ORDER BY pts ASC`
+
+	rows, err := r.db.QueryContext(ctx, query, models.UpdateDeleteMessage, pq.Array(chatIDs), fromPts, upTo,
+		models.UpdateHideMessage, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var deleted []string
+	maxPts := 0
+	for rows.Next() {
+		var pts int
+		var messageID string
+		if err := rows.Scan(&pts, &messageID); err != nil {
+			return nil, 0, err
+		}
+		deleted = append(deleted, messageID)
+		if pts > maxPts {
+			maxPts = pts
+		}
+	}
+	return deleted, maxPts, rows.Err()
+}
+
 // LogUpdate logs an update for future getDifference calls
 func (r *SyncRepository) LogUpdate(ctx context.Context, pts int, chatID int, updateType string, data interface{}) error {
 	jsonData, err := json.Marshal(data)
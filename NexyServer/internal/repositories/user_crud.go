@@ -73,6 +73,7 @@ func (r *UserRepository) GetByID(ctx context.Context, id int) (*models.User, err
 		SELECT id, username, email, password_hash, display_name, avatar_url, bio, 
 		       phone_number, phone_privacy, allow_phone_discovery,
 		       read_receipts_enabled, typing_indicators_enabled, voice_messages_enabled, show_online_status, last_seen, 
+		       presence_state, custom_status_text, custom_status_emoji, custom_status_expires_at,
 		       created_at, updated_at
 		FROM users
 		WHERE id = $1`
@@ -82,6 +83,8 @@ func (r *UserRepository) GetByID(ctx context.Context, id int) (*models.User, err
 	var phoneNumber sql.NullString
 	var phonePrivacy sql.NullString
 	var lastSeen sql.NullTime
+	var statusText, statusEmoji sql.NullString
+	var statusExpiresAt sql.NullTime
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&user.ID,
 		&user.Username,
@@ -98,6 +101,10 @@ func (r *UserRepository) GetByID(ctx context.Context, id int) (*models.User, err
 		&user.VoiceMessagesEnabled,
 		&user.ShowOnlineStatus,
 		&lastSeen,
+		&user.PresenceState,
+		&statusText,
+		&statusEmoji,
+		&statusExpiresAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -121,6 +128,7 @@ func (r *UserRepository) GetByID(ctx context.Context, id int) (*models.User, err
 	if lastSeen.Valid {
 		user.LastSeen = &lastSeen.Time
 	}
+	user.CustomStatus = scanCustomStatus(statusText, statusEmoji, statusExpiresAt)
 	return user, err
 }
 
@@ -151,9 +159,14 @@ func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 	).Scan(&user.UpdatedAt)
 }
 
-// UpdateLastSeen updates user's last seen timestamp
+// UpdateLastSeen updates user's last seen timestamp when the last connection
+// closes. Idle is reported per session, so an away state is reset here too.
 func (r *UserRepository) UpdateLastSeen(ctx context.Context, userID int) error {
-	query := `UPDATE users SET last_seen = CURRENT_TIMESTAMP WHERE id = $1`
+	query := `
+		UPDATE users
+		SET last_seen = CURRENT_TIMESTAMP,
+		    presence_state = CASE WHEN presence_state = 'away' THEN 'online' ELSE presence_state END
+		WHERE id = $1`
 	_, err := r.db.ExecContext(ctx, query, userID)
 	return err
 }
@@ -0,0 +1,134 @@
+/*
+ * © 2025 Murr | https://github.com/vtstv
+ */
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// GetPresenceAudience returns the users who may follow userID's presence:
+// accepted contacts in either direction and members of shared private chats
+// or of groups with at most maxGroupSize members. Users who hide their own
+// online status, or who are blocked by or have blocked userID, are left out.
+func (r *UserRepository) GetPresenceAudience(ctx context.Context, userID, maxGroupSize int) ([]int, error) {
+	query := `
+		WITH peers AS (
+			SELECT contact_user_id AS id FROM contacts WHERE user_id = $1 AND status = 'accepted'
+			UNION
+			SELECT user_id FROM contacts WHERE contact_user_id = $1 AND status = 'accepted'
+			UNION
+			SELECT other.user_id
+			FROM chat_members mine
+			JOIN chat_members other ON other.chat_id = mine.chat_id AND other.user_id != mine.user_id
+			JOIN chats c ON c.id = mine.chat_id
+			WHERE mine.user_id = $1
+			  AND (c.type = 'private' OR (SELECT COUNT(*) FROM chat_members m WHERE m.chat_id = c.id) <= $2)
+		)
+		SELECT u.id
+		FROM peers p
+		JOIN users u ON u.id = p.id
+		WHERE ` + presenceViewerFilter
+
+	rows, err := r.db.QueryContext(ctx, query, userID, maxGroupSize)
+	if err != nil {
+		return nil, err
+	}
+	return scanUserIDs(rows)
+}
+
+// FilterPresenceViewers keeps the viewerIDs that may see userID's presence
+// under the same rules as GetPresenceAudience, for viewers who asked for it
+// explicitly rather than sharing a chat
+func (r *UserRepository) FilterPresenceViewers(ctx context.Context, userID int, viewerIDs []int) ([]int, error) {
+	if len(viewerIDs) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		SELECT u.id
+		FROM users u
+		WHERE u.id = ANY($2) AND ` + presenceViewerFilter
+
+	rows, err := r.db.QueryContext(ctx, query, userID, pq.Array(viewerIDs))
+	if err != nil {
+		return nil, err
+	}
+	return scanUserIDs(rows)
+}
+
+// presenceViewerFilter leaves out viewers u who hide their own online status,
+// or who are blocked by or have blocked the user $1
+const presenceViewerFilter = `u.show_online_status = true
+		  AND NOT EXISTS (
+			SELECT 1 FROM contacts b
+			WHERE b.status = 'blocked'
+			  AND ((b.user_id = $1 AND b.contact_user_id = u.id) OR (b.user_id = u.id AND b.contact_user_id = $1))
+		  )`
+
+func scanUserIDs(rows *sql.Rows) ([]int, error) {
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, id)
+	}
+	return userIDs, rows.Err()
+}
+
+// UpdatePresenceState stores the user's chosen presence state
+func (r *UserRepository) UpdatePresenceState(ctx context.Context, userID int, state string) error {
+	query := `UPDATE users SET presence_state = $1 WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, state, userID)
+	return err
+}
+
+// GetPresenceState returns only the stored presence state, for hot paths like push delivery
+func (r *UserRepository) GetPresenceState(ctx context.Context, userID int) (string, error) {
+	var state string
+	query := `SELECT presence_state FROM users WHERE id = $1`
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&state)
+	return state, err
+}
+
+// UpdateCustomStatus sets or, with a nil status, clears the custom status
+func (r *UserRepository) UpdateCustomStatus(ctx context.Context, userID int, status *models.CustomStatus) error {
+	query := `
+		UPDATE users
+		SET custom_status_text = NULLIF($1, ''), custom_status_emoji = NULLIF($2, ''), custom_status_expires_at = $3
+		WHERE id = $4`
+
+	var text, emoji string
+	var expiresAt *time.Time
+	if status != nil {
+		text, emoji, expiresAt = status.Text, status.Emoji, status.ExpiresAt
+	}
+
+	_, err := r.db.ExecContext(ctx, query, text, emoji, expiresAt, userID)
+	return err
+}
+
+// scanCustomStatus builds a custom status from nullable columns, dropping it once expired
+func scanCustomStatus(text, emoji sql.NullString, expiresAt sql.NullTime) *models.CustomStatus {
+	if !text.Valid && !emoji.Valid {
+		return nil
+	}
+	if expiresAt.Valid && expiresAt.Time.Before(time.Now()) {
+		return nil
+	}
+
+	status := &models.CustomStatus{Text: text.String, Emoji: emoji.String}
+	if expiresAt.Valid {
+		status.ExpiresAt = &expiresAt.Time
+	}
+	return status
+}
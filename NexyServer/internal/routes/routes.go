@@ -24,6 +24,9 @@ type Router struct {
 	syncController     *controllers.SyncController
 	fcmController      *controllers.FcmController
 	reactionController *controllers.ReactionController
+	callController     *controllers.CallController
+	scheduleController *controllers.ScheduledMessageController
+	expiryController   *controllers.MessageExpiryController
 	authMiddleware     *middleware.AuthMiddleware
 	corsMiddleware     *middleware.CORSMiddleware
 	rateLimiter        *middleware.RateLimiter
@@ -45,6 +48,9 @@ func NewRouter(
 	syncController *controllers.SyncController,
 	fcmController *controllers.FcmController,
 	reactionController *controllers.ReactionController,
+	callController *controllers.CallController,
+	scheduleController *controllers.ScheduledMessageController,
+	expiryController *controllers.MessageExpiryController,
 	authMiddleware *middleware.AuthMiddleware,
 	corsMiddleware *middleware.CORSMiddleware,
 	rateLimiter *middleware.RateLimiter,
@@ -65,6 +71,9 @@ func NewRouter(
 		syncController:     syncController,
 		fcmController:      fcmController,
 		reactionController: reactionController,
+		callController:     callController,
+		scheduleController: scheduleController,
+		expiryController:   expiryController,
 		authMiddleware:     authMiddleware,
 		corsMiddleware:     corsMiddleware,
 		rateLimiter:        rateLimiter,
@@ -96,6 +105,7 @@ func (rt *Router) Setup() *mux.Router {
 	users.Use(rt.authMiddleware.Authenticate)
 	users.HandleFunc("/me", rt.userController.GetMe).Methods("GET")
 	users.HandleFunc("/me", rt.userController.UpdateProfile).Methods("PUT")
+	users.HandleFunc("/me/presence", rt.userController.UpdatePresence).Methods("PUT")
 	users.HandleFunc("/me/qr", rt.userController.GetMyQRCode).Methods("GET")
 	users.HandleFunc("/search", rt.userController.SearchUsers).Methods("GET")
 	users.HandleFunc("/search/phone", rt.userController.SearchByPhone).Methods("GET")
@@ -115,6 +125,10 @@ func (rt *Router) Setup() *mux.Router {
 	chats.HandleFunc("/{id:[0-9]+}/unmute", rt.userController.UnmuteChat).Methods("POST")
 	chats.HandleFunc("/{id:[0-9]+}/pin", rt.userController.PinChat).Methods("POST")
 	chats.HandleFunc("/{id:[0-9]+}/unpin", rt.userController.UnpinChat).Methods("POST")
+	chats.HandleFunc("/{id:[0-9]+}/ttl", rt.expiryController.SetChatTTL).Methods("PUT")
+	chats.HandleFunc("/{id:[0-9]+}/pinned-messages", rt.messageController.PinMessage).Methods("POST")
+	chats.HandleFunc("/{id:[0-9]+}/pinned-messages/{messageId}", rt.messageController.UnpinMessage).Methods("DELETE")
+	chats.HandleFunc("/{id:[0-9]+}/mentions/next", rt.messageController.NextUnreadMention).Methods("POST")
 	chats.HandleFunc("/{id:[0-9]+}/messages/search", rt.messageController.SearchMessages).Methods("GET")
 	chats.HandleFunc("/create", rt.userController.CreatePrivateChat).Methods("POST")
 
@@ -156,7 +170,15 @@ func (rt *Router) Setup() *mux.Router {
 	messages.HandleFunc("/history", rt.messageController.GetChatHistory).Methods("GET")
 	messages.HandleFunc("/search", rt.messageController.SearchMessages).Methods("GET")
 	messages.HandleFunc("/delete", rt.messageController.DeleteMessage).Methods("POST")
+	messages.HandleFunc("/forward", rt.messageController.ForwardMessages).Methods("POST")
 	messages.HandleFunc("/{messageId}/info", rt.messageController.GetMessageByID).Methods("GET")
+	messages.HandleFunc("/{messageId}/replies", rt.messageController.GetReplies).Methods("GET")
+	messages.HandleFunc("/{messageId}/replies/read", rt.messageController.MarkThreadRead).Methods("POST")
+	messages.HandleFunc("/{messageId}/edits", rt.messageController.GetEditHistory).Methods("GET")
+	messages.HandleFunc("/{messageId}/poll/votes", rt.messageController.VotePoll).Methods("POST")
+	messages.HandleFunc("/{messageId}/poll/close", rt.messageController.ClosePoll).Methods("POST")
+	messages.HandleFunc("/{messageId}/location", rt.messageController.UpdateLiveLocation).Methods("PUT")
+	messages.HandleFunc("/{messageId}/location/stop", rt.messageController.StopLiveLocation).Methods("POST")
 	messages.HandleFunc("/{messageId:[0-9]+}/reactions", rt.reactionController.GetReactions).Methods("GET")
 	messages.HandleFunc("/reactions", rt.reactionController.AddReaction).Methods("POST")
 	messages.HandleFunc("/reactions", rt.reactionController.RemoveReaction).Methods("DELETE")
@@ -193,6 +215,20 @@ func (rt *Router) Setup() *mux.Router {
 	turn.Use(rt.authMiddleware.Authenticate)
 	turn.HandleFunc("/ice-servers", rt.turnController.GetICEServers).Methods("GET")
 
+	// Call history
+	calls := api.PathPrefix("/calls").Subrouter()
+	calls.Use(rt.authMiddleware.Authenticate)
+	calls.HandleFunc("", rt.callController.GetCallHistory).Methods("GET")
+	calls.HandleFunc("/{callId}/quality", rt.callController.ReportQuality).Methods("POST")
+
+	// Scheduled messages, posted by the server at send_at
+	scheduled := api.PathPrefix("/scheduled-messages").Subrouter()
+	scheduled.Use(rt.authMiddleware.Authenticate)
+	scheduled.HandleFunc("", rt.scheduleController.GetScheduled).Methods("GET")
+	scheduled.HandleFunc("", rt.scheduleController.Schedule).Methods("POST")
+	scheduled.HandleFunc("/{id:[0-9]+}", rt.scheduleController.UpdateScheduled).Methods("PUT")
+	scheduled.HandleFunc("/{id:[0-9]+}", rt.scheduleController.CancelScheduled).Methods("DELETE")
+
 	// Sessions endpoints (device management)
 	sessions := api.PathPrefix("/sessions").Subrouter()
 	sessions.Use(rt.authMiddleware.Authenticate)
@@ -0,0 +1,137 @@
+/*
+ * © 2025 Murr | https://github.com/vtstv
+ */
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/vtstv/nexy/internal/models"
+	"github.com/vtstv/nexy/internal/repositories"
+)
+
+// SystemMessagePublisher delivers server-generated chat messages live
+type SystemMessagePublisher interface {
+	BroadcastSystemMessage(msg *models.Message)
+}
+
+type CallService struct {
+	callRepo    *repositories.CallRepository
+	chatRepo    *repositories.ChatRepository
+	messageRepo *repositories.MessageRepository
+	publisher   SystemMessagePublisher
+}
+
+func NewCallService(callRepo *repositories.CallRepository, chatRepo *repositories.ChatRepository, messageRepo *repositories.MessageRepository) *CallService {
+	return &CallService{
+		callRepo:    callRepo,
+		chatRepo:    chatRepo,
+		messageRepo: messageRepo,
+	}
+}
+
+func (s *CallService) SetPublisher(publisher SystemMessagePublisher) {
+	s.publisher = publisher
+}
+
+// RecordCall stores a finished call and, if the callee never picked up,
+// leaves a system message in the private chat so it shows up in the
+// conversation and in sync
+func (s *CallService) RecordCall(ctx context.Context, call *models.Call) error {
+	if call.ChatID == nil && call.CalleeID != nil {
+		chat, err := s.chatRepo.GetPrivateChatBetween(ctx, call.CallerID, *call.CalleeID)
+		if err != nil {
+			log.Printf("Error finding chat for call %s: %v", call.CallID, err)
+		} else if chat != nil {
+			call.ChatID = &chat.ID
+		}
+	}
+
+	created, err := s.callRepo.Create(ctx, call)
+	if err != nil || !created {
+		return err
+	}
+
+	content := callSystemText(call)
+	if content == "" || call.ChatID == nil {
+		return nil
+	}
+
+	// Call IDs come from clients and can be as long as message IDs, so the
+	// message gets its own; the call row already keeps it from being posted twice
+	msg := &models.Message{
+		MessageID:   uuid.New().String(),
+		ChatID:      *call.ChatID,
+		SenderID:    call.CallerID,
+		MessageType: "system",
+		Content:     content,
+	}
+	if err := s.messageRepo.Create(ctx, msg); err != nil {
+		return fmt.Errorf("failed to create call message: %w", err)
+	}
+
+	if s.publisher != nil {
+		s.publisher.BroadcastSystemMessage(msg)
+	}
+	return nil
+}
+
+func (s *CallService) GetCallHistory(ctx context.Context, userID, limit, offset int) ([]*models.Call, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.callRepo.GetUserHistory(ctx, userID, limit, offset)
+}
+
+// RecordQuality stores the user's stats summary for a call they took part in.
+// Reports are posted after hangup, so the call must already be recorded.
+func (s *CallService) RecordQuality(ctx context.Context, report *models.CallQualityReport) error {
+	switch report.CandidateType {
+	case models.CandidateHost, models.CandidateSrflx, models.CandidatePrflx, models.CandidateRelay:
+	default:
+		return errors.New("invalid candidate type")
+	}
+	if negative(report.RTTMs) || negative(report.JitterMs) || negative(report.BitrateKbps) {
+		return errors.New("invalid stats")
+	}
+	if report.PacketLoss != nil && (*report.PacketLoss < 0 || *report.PacketLoss > 100) {
+		return errors.New("invalid stats")
+	}
+
+	participant, err := s.callRepo.IsParticipant(ctx, report.CallID, report.UserID)
+	if err != nil {
+		return err
+	}
+	if !participant {
+		return errors.New("call not found")
+	}
+
+	return s.callRepo.SaveQuality(ctx, report)
+}
+
+func negative(value *int) bool {
+	return value != nil && *value < 0
+}
+
+// callSystemText describes calls that were not picked up, or "" for the rest
+func callSystemText(call *models.Call) string {
+	kind := "voice"
+	if call.IsVideo {
+		kind = "video"
+	}
+
+	switch {
+	case call.Status == models.CallStatusMissed, call.Status == models.CallStatusTimeout:
+		return fmt.Sprintf("Missed %s call", kind)
+	case call.Status == models.CallStatusEnded && call.EndReason == "declined":
+		return fmt.Sprintf("Declined %s call", kind)
+	}
+	return ""
+}
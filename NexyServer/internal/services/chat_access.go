@@ -0,0 +1,137 @@
+/*
+ * © 2025 Murr | https://github.com/vtstv
+ */
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/vtstv/nexy/internal/models"
+	"github.com/vtstv/nexy/internal/repositories"
+)
+
+// Error codes reported to clients when a chat action is refused
+const (
+	AccessChatNotFound     = "chat_not_found"
+	AccessNotMember        = "not_member"
+	AccessBanned           = "banned"
+	AccessPermissionDenied = "permission_denied"
+)
+
+// AccessError is returned when a user may not perform an action in a chat
+type AccessError struct {
+	Code    string
+	Message string
+}
+
+func (e *AccessError) Error() string {
+	return e.Message
+}
+
+// ErrorCode lets callers outside this package read the code without importing it
+func (e *AccessError) ErrorCode() string {
+	return e.Code
+}
+
+// ChatAccessService holds the single set of rules deciding who may do what in
+// a chat. Both the WebSocket hub and the REST services go through it.
+type ChatAccessService struct {
+	chatRepo *repositories.ChatRepository
+}
+
+func NewChatAccessService(chatRepo *repositories.ChatRepository) *ChatAccessService {
+	return &ChatAccessService{chatRepo: chatRepo}
+}
+
+// Authorize returns nil if the user may perform the action, or an *AccessError
+func (s *ChatAccessService) Authorize(ctx context.Context, chatID, userID int, action models.ChatAction) error {
+	chat, err := s.chatRepo.GetByID(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	if chat == nil {
+		return &AccessError{Code: AccessChatNotFound, Message: "chat not found"}
+	}
+
+	if chat.Type != "private" {
+		banned, err := s.chatRepo.IsBanned(ctx, chatID, userID)
+		if err != nil {
+			return err
+		}
+		if banned {
+			return &AccessError{Code: AccessBanned, Message: "you are banned from this chat"}
+		}
+	}
+
+	member, err := s.chatRepo.GetChatMember(ctx, chatID, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if member == nil {
+		if action == models.ChatActionView && chat.GroupType == "public_group" {
+			return nil
+		}
+		return &AccessError{Code: AccessNotMember, Message: "not a member of this chat"}
+	}
+
+	if action == models.ChatActionView || action == models.ChatActionParticipate {
+		return nil
+	}
+
+	// Moderation is reserved to owners and to admins holding the right
+	if action == models.ChatActionDeleteOthers {
+		if chat.Type == "private" || member.Role == "member" {
+			return &AccessError{Code: AccessPermissionDenied, Message: "deleting others' messages is not allowed in this chat"}
+		}
+		if member.Role == "admin" && member.Permissions != nil && !member.Permissions.DeleteMessages {
+			return &AccessError{Code: AccessPermissionDenied, Message: "deleting others' messages is not allowed in this chat"}
+		}
+		return nil
+	}
+
+	if action == models.ChatActionClosePolls {
+		if chat.Type == "private" || member.Role == "member" {
+			return &AccessError{Code: AccessPermissionDenied, Message: "closing others' polls is not allowed in this chat"}
+		}
+		return nil
+	}
+
+	// Private chats have no per-member permissions
+	if chat.Type == "private" || member.Role == "owner" || member.Role == "admin" {
+		return nil
+	}
+
+	perms := member.Permissions
+	if perms == nil {
+		perms = chat.DefaultPermissions
+	}
+	if perms == nil {
+		return nil
+	}
+
+	if action == models.ChatActionChangeInfo {
+		if !perms.ChangeInfo {
+			return &AccessError{Code: AccessPermissionDenied, Message: "changing chat settings is not allowed in this chat"}
+		}
+		return nil
+	}
+
+	if action == models.ChatActionPinMessages {
+		if !perms.PinMessages {
+			return &AccessError{Code: AccessPermissionDenied, Message: "pinning messages is not allowed in this chat"}
+		}
+		return nil
+	}
+
+	if !perms.SendMessages {
+		return &AccessError{Code: AccessPermissionDenied, Message: "sending messages is not allowed in this chat"}
+	}
+	if action == models.ChatActionSendMedia && !perms.SendMedia {
+		return &AccessError{Code: AccessPermissionDenied, Message: "sending media is not allowed in this chat"}
+	}
+
+	return nil
+}
@@ -80,23 +80,24 @@ func (s *ContactService) GetContacts(userID int) ([]models.ContactWithUser, erro
 		return nil, err
 	}
 
-	// Apply online status with privacy rules
+	// Apply online status with privacy rules, or show none without them
+	var requestingUser *models.User
 	if s.onlineStatusService != nil && s.userRepo != nil {
-		requestingUser, err := s.userRepo.GetByID(context.Background(), userID)
-		if err == nil {
-			for i := range contacts {
-				isOnline := false
-				if s.onlineChecker != nil {
-					isOnline = s.onlineChecker.IsUserOnline(contacts[i].ContactUser.ID)
-				}
-				contacts[i].ContactUser.OnlineStatus = s.onlineStatusService.ApplyPrivacyFilter(
-					requestingUser,
-					&contacts[i].ContactUser,
-					isOnline,
-				)
-			}
+		if user, err := s.userRepo.GetByID(context.Background(), userID); err == nil {
+			requestingUser = user
 		}
 	}
+	for i := range contacts {
+		if requestingUser == nil {
+			HidePresence(&contacts[i].ContactUser)
+			continue
+		}
+		isOnline := false
+		if s.onlineChecker != nil {
+			isOnline = s.onlineChecker.IsUserOnline(contacts[i].ContactUser.ID)
+		}
+		s.onlineStatusService.ApplyPresence(requestingUser, &contacts[i].ContactUser, isOnline)
+	}
 
 	return contacts, nil
 }
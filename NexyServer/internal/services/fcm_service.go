@@ -7,10 +7,13 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strconv"
+	"time"
 
 	firebase "firebase.google.com/go/v4"
 	"firebase.google.com/go/v4/messaging"
 	"github.com/vtstv/nexy/internal/config"
+	"github.com/vtstv/nexy/internal/models"
 	"github.com/vtstv/nexy/internal/repositories"
 	"google.golang.org/api/option"
 )
@@ -75,6 +78,10 @@ func (s *FcmService) SendNotification(ctx context.Context, userID int, title, bo
 		return nil
 	}
 
+	if s.inDoNotDisturb(ctx, userID) {
+		return nil
+	}
+
 	// Get user's FCM token
 	fcmToken, err := s.userRepo.GetFcmToken(ctx, userID)
 	if err != nil {
@@ -113,3 +120,76 @@ func (s *FcmService) SendNotification(ctx context.Context, userID int, title, bo
 	log.Printf("Successfully sent FCM notification to user %d: %s\n", userID, response)
 	return nil
 }
+
+// SendIncomingCall wakes the callee's device with a high-priority, data-only
+// push so the app can show its own call screen. The push expires with the ring.
+func (s *FcmService) SendIncomingCall(ctx context.Context, calleeID, callerID int, callID string, video bool, ttl time.Duration) error {
+	callerName := ""
+	if caller, err := s.userRepo.GetByID(ctx, callerID); err == nil {
+		callerName = caller.DisplayName
+		if callerName == "" {
+			callerName = caller.Username
+		}
+	}
+
+	return s.sendData(ctx, calleeID, map[string]string{
+		"type":        "incoming_call",
+		"call_id":     callID,
+		"caller_id":   strconv.Itoa(callerID),
+		"caller_name": callerName,
+		"video":       strconv.FormatBool(video),
+	}, ttl)
+}
+
+// SendCallCancelled dismisses an incoming call shown from a push
+func (s *FcmService) SendCallCancelled(ctx context.Context, calleeID int, callID, reason string, ttl time.Duration) error {
+	return s.sendData(ctx, calleeID, map[string]string{
+		"type":    "call_cancelled",
+		"call_id": callID,
+		"reason":  reason,
+	}, ttl)
+}
+
+func (s *FcmService) sendData(ctx context.Context, userID int, data map[string]string, ttl time.Duration) error {
+	if !s.enabled || s.messagingClient == nil {
+		return nil
+	}
+
+	if s.inDoNotDisturb(ctx, userID) {
+		return nil
+	}
+
+	fcmToken, err := s.userRepo.GetFcmToken(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get FCM token: %w", err)
+	}
+	if fcmToken == "" {
+		return nil
+	}
+
+	message := &messaging.Message{
+		Token: fcmToken,
+		Data:  data,
+		Android: &messaging.AndroidConfig{
+			Priority: "high",
+			TTL:      &ttl,
+		},
+	}
+
+	response, err := s.messagingClient.Send(ctx, message)
+	if err != nil {
+		return fmt.Errorf("failed to send FCM data message: %w", err)
+	}
+
+	log.Printf("Successfully sent FCM %s to user %d: %s\n", data["type"], userID, response)
+	return nil
+}
+
+// inDoNotDisturb reports whether pushes to the user are silenced
+func (s *FcmService) inDoNotDisturb(ctx context.Context, userID int) bool {
+	if state, err := s.userRepo.GetPresenceState(ctx, userID); err == nil && state == models.PresenceDND {
+		log.Printf("User %d is in do not disturb, skipping notification", userID)
+		return true
+	}
+	return false
+}
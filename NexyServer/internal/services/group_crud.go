@@ -57,11 +57,12 @@ func (s *GroupService) CreateGroup(ctx context.Context, name, description, group
 		UserID: creatorID,
 		Role:   "owner",
 		Permissions: &models.ChatPermissions{
-			SendMessages: true,
-			SendMedia:    true,
-			AddUsers:     true,
-			PinMessages:  true,
-			ChangeInfo:   true,
+			SendMessages:   true,
+			SendMedia:      true,
+			AddUsers:       true,
+			PinMessages:    true,
+			ChangeInfo:     true,
+			DeleteMessages: true,
 		},
 	}
 	s.chatRepo.AddMember(ctx, owner)
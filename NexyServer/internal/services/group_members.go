@@ -53,11 +53,9 @@ func (s *GroupService) GetGroupMembers(ctx context.Context, groupID, userID int,
 				if s.onlineChecker != nil {
 					isOnline = s.onlineChecker.IsUserOnline(member.UserID)
 				}
-				member.User.OnlineStatus = s.onlineStatusService.ApplyPrivacyFilter(
-					requestingUser,
-					member.User,
-					isOnline,
-				)
+				s.onlineStatusService.ApplyPresence(requestingUser, member.User, isOnline)
+			} else {
+				HidePresence(member.User)
 			}
 		}
 	}
@@ -241,11 +239,13 @@ func (s *GroupService) GetBannedMembers(ctx context.Context, groupID, requestorI
 
 		// Get banned user info
 		if user, err := s.userRepo.GetByID(ctx, ban.UserID); err == nil && user != nil {
+			HidePresence(user)
 			banWithUser.User = user
 		}
 
 		// Get banner user info
 		if user, err := s.userRepo.GetByID(ctx, ban.BannedBy); err == nil && user != nil {
+			HidePresence(user)
 			banWithUser.BannedByUser = user
 		}
 
@@ -271,7 +271,20 @@ func (s *GroupService) UpdateMemberRole(ctx context.Context, groupID, requestorI
 		return errors.New("permission denied")
 	}
 
-	return s.chatRepo.UpdateMemberRole(ctx, groupID, targetUserID, role)
+	if err := s.chatRepo.UpdateMemberRole(ctx, groupID, targetUserID, role); err != nil {
+		return err
+	}
+
+	// Admins are promoted with the right to delete others' messages and
+	// demoted members lose it. Members without their own permission set
+	// follow the chat defaults, where an admin has the right anyway.
+	target, err := s.chatRepo.GetChatMember(ctx, groupID, targetUserID)
+	if err != nil || target == nil || target.Permissions == nil {
+		return err
+	}
+	perms := *target.Permissions
+	perms.DeleteMessages = role == "admin"
+	return s.chatRepo.UpdateMemberPermissions(ctx, groupID, targetUserID, &perms)
 }
 
 // TransferOwnership transfers group ownership to another member
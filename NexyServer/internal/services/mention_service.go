@@ -0,0 +1,161 @@
+/*
+ * © 2025 Murr | https://github.com/vtstv
+ */
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/vtstv/nexy/internal/models"
+	"github.com/vtstv/nexy/internal/repositories"
+)
+
+// Error codes reported to clients when a message's mentions are refused
+const (
+	MentionInvalid   = "invalid_mention"
+	MentionTooMany   = "too_many_mentions"
+	MentionNotMember = "mention_not_member"
+	MentionBlocked   = "mention_blocked"
+)
+
+// MentionError is returned when a message mentions someone it may not
+type MentionError struct {
+	Code    string
+	Message string
+}
+
+func (e *MentionError) Error() string {
+	return e.Message
+}
+
+// ErrorCode lets callers outside this package read the code without importing it
+func (e *MentionError) ErrorCode() string {
+	return e.Code
+}
+
+var (
+	errInvalidMention   = &MentionError{Code: MentionInvalid, Message: "mention does not fit the message text"}
+	errTooManyMentions  = &MentionError{Code: MentionTooMany, Message: fmt.Sprintf("a message can mention at most %d users", models.MaxMentions)}
+	errMentionNotMember = &MentionError{Code: MentionNotMember, Message: "mentioned user is not a member of this chat"}
+	errMentionBlocked   = &MentionError{Code: MentionBlocked, Message: "mentioned user cannot be mentioned by you"}
+)
+
+// mentionPattern matches @username at the start of a word, so addresses like
+// name@example.com are left alone
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@.])@(\w+)`)
+
+// MentionService holds the rules deciding whom a message mentions. Messages
+// sent over the WebSocket hub and edits go through it.
+type MentionService struct {
+	messageRepo *repositories.MessageRepository
+}
+
+func NewMentionService(messageRepo *repositories.MessageRepository) *MentionService {
+	return &MentionService{messageRepo: messageRepo}
+}
+
+// ResolveMentions works out whom a message's text mentions: the users of its
+// explicit mention entities plus those named with @username in it. Unknown
+// usernames stay plain text, but mentioning someone outside the chat, or with
+// a block between them and the sender, refuses the message with a
+// *MentionError. Encrypted content cannot be searched or checked against the
+// spans.
+func (s *MentionService) ResolveMentions(ctx context.Context, chatID, senderID int, content string, explicit []models.MentionEntity, encrypted bool) ([]models.MentionEntity, error) {
+	contentLength := utf8.RuneCountInString(content)
+
+	var userIDs []int
+	for _, mention := range explicit {
+		if mention.UserID <= 0 || mention.Offset < 0 || mention.Length <= 0 {
+			return nil, errInvalidMention
+		}
+		if !encrypted && mention.Offset+mention.Length > contentLength {
+			return nil, errInvalidMention
+		}
+		userIDs = append(userIDs, mention.UserID)
+	}
+
+	var named []models.MentionEntity
+	var usernames []string
+	if !encrypted {
+		for _, match := range mentionPattern.FindAllStringSubmatchIndex(content, -1) {
+			at := match[2] - 1
+			mention := models.MentionEntity{
+				Offset: utf8.RuneCountInString(content[:at]),
+				Length: utf8.RuneCountInString(content[at:match[3]]),
+			}
+			// An explicit entity over the same text wins
+			if mentionCovered(explicit, mention.Offset) {
+				continue
+			}
+			named = append(named, mention)
+			usernames = append(usernames, content[match[2]:match[3]])
+		}
+	}
+
+	if len(userIDs) == 0 && len(usernames) == 0 {
+		return nil, nil
+	}
+	if len(explicit)+len(named) > models.MaxMentions {
+		return nil, errTooManyMentions
+	}
+
+	targets, err := s.messageRepo.GetMentionTargets(ctx, chatID, senderID, usernames, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up mentioned users: %w", err)
+	}
+	byID := make(map[int]models.MentionTarget, len(targets))
+	byUsername := make(map[string]models.MentionTarget, len(targets))
+	for _, target := range targets {
+		byID[target.UserID] = target
+		byUsername[target.Username] = target
+	}
+
+	mentions := make([]models.MentionEntity, 0, len(explicit)+len(named))
+	for _, mention := range explicit {
+		target, ok := byID[mention.UserID]
+		if err := checkMentionTarget(target, ok); err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, mention)
+	}
+	for i, mention := range named {
+		target, ok := byUsername[usernames[i]]
+		if !ok {
+			continue
+		}
+		if err := checkMentionTarget(target, true); err != nil {
+			return nil, err
+		}
+		mention.UserID = target.UserID
+		mentions = append(mentions, mention)
+	}
+
+	sort.Slice(mentions, func(i, j int) bool { return mentions[i].Offset < mentions[j].Offset })
+	return mentions, nil
+}
+
+// checkMentionTarget refuses mentions of unknown users, non-members and users
+// with a block between them and the sender
+func checkMentionTarget(target models.MentionTarget, found bool) error {
+	if !found || !target.IsMember {
+		return errMentionNotMember
+	}
+	if target.Blocked {
+		return errMentionBlocked
+	}
+	return nil
+}
+
+// mentionCovered reports whether one of the mentions spans the offset
+func mentionCovered(mentions []models.MentionEntity, offset int) bool {
+	for _, mention := range mentions {
+		if offset >= mention.Offset && offset < mention.Offset+mention.Length {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,20 @@
+/*
+ * © 2025 Murr | https://github.com/vtstv
+ */
+package services
+
+import (
+	"context"
+
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// GetEditHistory returns the earlier versions of a message, oldest first, to
+// anyone who can read its chat
+func (s *MessageService) GetEditHistory(ctx context.Context, messageID string, userID int) ([]*models.MessageEdit, error) {
+	msg, err := s.visibleMessage(ctx, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.messageRepo.GetEditHistory(ctx, msg.ID)
+}
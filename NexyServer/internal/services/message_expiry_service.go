@@ -0,0 +1,213 @@
+/*
+ * © 2025 Murr | https://github.com/vtstv
+ */
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vtstv/nexy/internal/models"
+	"github.com/vtstv/nexy/internal/repositories"
+)
+
+const (
+	expirySweepInterval = 10 * time.Second
+	expirySweepBatch    = 200
+)
+
+// ExpiryPublisher announces timer changes, expired messages, ended live
+// locations and closed polls live
+type ExpiryPublisher interface {
+	BroadcastSystemMessage(msg *models.Message)
+	BroadcastDelete(msg *models.Message)
+	BroadcastLocation(msg *models.Message)
+	BroadcastPollUpdate(msg *models.Message, userID int)
+}
+
+// MessageExpiryService runs disappearing messages: the per-chat auto-delete
+// timer and the sweeper that removes messages once they expire. The sweeper
+// also ends live locations whose period ran out and closes polls whose close
+// time passed.
+type MessageExpiryService struct {
+	messageRepo *repositories.MessageRepository
+	chatRepo    *repositories.ChatRepository
+	userRepo    *repositories.UserRepository
+	fileService *FileService
+	access      *ChatAccessService
+	publisher   ExpiryPublisher
+}
+
+func NewMessageExpiryService(messageRepo *repositories.MessageRepository, chatRepo *repositories.ChatRepository, userRepo *repositories.UserRepository, fileService *FileService) *MessageExpiryService {
+	return &MessageExpiryService{
+		messageRepo: messageRepo,
+		chatRepo:    chatRepo,
+		userRepo:    userRepo,
+		fileService: fileService,
+		access:      NewChatAccessService(chatRepo),
+	}
+}
+
+func (s *MessageExpiryService) SetPublisher(publisher ExpiryPublisher) {
+	s.publisher = publisher
+}
+
+// SetChatTTL sets the chat's auto-delete timer, 0 turning it off, and posts
+// a system message announcing the change
+func (s *MessageExpiryService) SetChatTTL(ctx context.Context, chatID, userID, ttl int) (*models.Message, error) {
+	switch ttl {
+	case 0, models.ChatTTLDay, models.ChatTTLWeek, models.ChatTTLMonth:
+	default:
+		return nil, errors.New("invalid ttl")
+	}
+
+	if err := s.access.Authorize(ctx, chatID, userID, models.ChatActionChangeInfo); err != nil {
+		return nil, err
+	}
+
+	var value *int
+	if ttl > 0 {
+		value = &ttl
+	}
+	if err := s.chatRepo.SetMessageTTL(ctx, chatID, value); err != nil {
+		return nil, err
+	}
+
+	msg := &models.Message{
+		MessageID:   uuid.New().String(),
+		ChatID:      chatID,
+		SenderID:    userID,
+		MessageType: "system",
+		Content:     ttlSystemText(actorName(ctx, s.userRepo, userID), ttl),
+	}
+	if err := s.messageRepo.Create(ctx, msg); err != nil {
+		return nil, fmt.Errorf("failed to create timer message: %w", err)
+	}
+
+	if s.publisher != nil {
+		s.publisher.BroadcastSystemMessage(msg)
+	}
+	return msg, nil
+}
+
+func ttlSystemText(name string, ttl int) string {
+	switch ttl {
+	case models.ChatTTLDay:
+		return name + " set messages to disappear after 1 day"
+	case models.ChatTTLWeek:
+		return name + " set messages to disappear after 1 week"
+	case models.ChatTTLMonth:
+		return name + " set messages to disappear after 1 month"
+	}
+	return name + " turned off disappearing messages"
+}
+
+// RunSweeper deletes expired messages, ends expired live locations and
+// closes due polls until ctx is done. Every instance may run one; each step
+// skips rows another sweeper holds.
+func (s *MessageExpiryService) RunSweeper(ctx context.Context) {
+	ticker := time.NewTicker(expirySweepInterval)
+	defer ticker.Stop()
+
+	for {
+		s.sweep(ctx)
+		s.endLiveLocations(ctx)
+		s.closeDuePolls(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *MessageExpiryService) sweep(ctx context.Context) {
+	for {
+		expired, err := s.messageRepo.DeleteExpired(ctx, expirySweepBatch)
+		if err != nil {
+			log.Printf("Error deleting expired messages: %v", err)
+			return
+		}
+
+		for _, msg := range expired {
+			if s.publisher != nil {
+				// A zero sender reaches every member, the sender's devices included
+				s.publisher.BroadcastDelete(&models.Message{MessageID: msg.MessageID, ChatID: msg.ChatID})
+			}
+			if msg.MediaURL != "" {
+				s.deleteMedia(ctx, msg.MediaURL)
+			}
+		}
+
+		if len(expired) > 0 {
+			log.Printf("Deleted %d expired messages", len(expired))
+		}
+		if len(expired) < expirySweepBatch {
+			return
+		}
+	}
+}
+
+func (s *MessageExpiryService) endLiveLocations(ctx context.Context) {
+	for {
+		ended, err := s.messageRepo.EndExpiredLiveLocations(ctx, expirySweepBatch)
+		if err != nil {
+			log.Printf("Error ending expired live locations: %v", err)
+			return
+		}
+
+		if s.publisher != nil {
+			for _, msg := range ended {
+				s.publisher.BroadcastLocation(msg)
+			}
+		}
+		if len(ended) < expirySweepBatch {
+			return
+		}
+	}
+}
+
+func (s *MessageExpiryService) closeDuePolls(ctx context.Context) {
+	for {
+		closed, err := s.messageRepo.CloseDuePolls(ctx, expirySweepBatch)
+		if err != nil {
+			log.Printf("Error closing due polls: %v", err)
+			return
+		}
+
+		if s.publisher != nil {
+			for _, msg := range closed {
+				// No user in particular, so every member gets the shared results
+				s.publisher.BroadcastPollUpdate(msg, 0)
+			}
+		}
+		if len(closed) < expirySweepBatch {
+			return
+		}
+	}
+}
+
+// deleteMedia removes an uploaded file once no message refers to it any more
+func (s *MessageExpiryService) deleteMedia(ctx context.Context, mediaURL string) {
+	if !strings.Contains(mediaURL, "/files/") {
+		return
+	}
+
+	referenced, err := s.messageRepo.IsMediaReferenced(ctx, mediaURL)
+	if err != nil || referenced {
+		return
+	}
+
+	fileID := path.Base(mediaURL)
+	if err := s.fileService.DeleteFile(ctx, fileID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error deleting file %s of an expired message: %v", fileID, err)
+	}
+}
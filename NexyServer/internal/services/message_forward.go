@@ -0,0 +1,148 @@
+/*
+ * © 2025 Murr | https://github.com/vtstv
+ */
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/vtstv/nexy/internal/models"
+	"github.com/vtstv/nexy/internal/repositories"
+)
+
+const (
+	maxForwardMessages = 100
+	maxForwardTargets  = 10
+)
+
+// ForwardMessages copies the messages, in the order given, into each target
+// chat as new messages from userID that keep their original attribution. The
+// user must be able to read every source chat and to post to every target;
+// nothing is forwarded unless all of these checks pass, and either every copy
+// is made or none is.
+func (s *MessageService) ForwardMessages(ctx context.Context, userID int, messageIDs []string, chatIDs []int) ([]*models.Message, error) {
+	if len(messageIDs) == 0 {
+		return nil, errors.New("no messages to forward")
+	}
+	if len(messageIDs) > maxForwardMessages {
+		return nil, errors.New("too many messages to forward")
+	}
+
+	targets := make([]int, 0, len(chatIDs))
+	seen := make(map[int]bool)
+	for _, chatID := range chatIDs {
+		if !seen[chatID] {
+			seen[chatID] = true
+			targets = append(targets, chatID)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("no target chats")
+	}
+	if len(targets) > maxForwardTargets {
+		return nil, errors.New("too many target chats")
+	}
+
+	sources := make([]*models.Message, 0, len(messageIDs))
+	readable := make(map[int]bool)
+	hasMedia, hasVoice := false, false
+	for _, messageID := range messageIDs {
+		msg, err := s.messageRepo.GetByUUID(ctx, messageID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, errors.New("message not found")
+			}
+			return nil, err
+		}
+		if msg.IsDeleted {
+			return nil, errors.New("message not found")
+		}
+		if msg.MessageType == "system" {
+			return nil, errors.New("system messages cannot be forwarded")
+		}
+		if msg.MessageType == "poll" {
+			return nil, errors.New("polls cannot be forwarded")
+		}
+		if msg.MessageType == "location" {
+			return nil, errors.New("locations cannot be forwarded")
+		}
+
+		if !readable[msg.ChatID] {
+			if err := s.access.Authorize(ctx, msg.ChatID, userID, models.ChatActionView); err != nil {
+				return nil, err
+			}
+			readable[msg.ChatID] = true
+		}
+
+		if spec, ok := models.LookupMessageType(msg.MessageType); ok && spec.Action == models.ChatActionSendMedia {
+			hasMedia = true
+		}
+		if msg.MessageType == "voice" {
+			hasVoice = true
+		}
+		sources = append(sources, msg)
+	}
+
+	for _, chatID := range targets {
+		if err := s.access.Authorize(ctx, chatID, userID, models.ChatActionSendMessages); err != nil {
+			return nil, err
+		}
+		if hasMedia {
+			if err := s.access.Authorize(ctx, chatID, userID, models.ChatActionSendMedia); err != nil {
+				return nil, err
+			}
+		}
+		if hasVoice {
+			if err := s.checkVoiceAccepted(ctx, chatID, userID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	copies := make([]repositories.ForwardCopy, 0, len(sources)*len(targets))
+	for _, chatID := range targets {
+		for _, source := range sources {
+			copies = append(copies, repositories.ForwardCopy{
+				MessageID: uuid.New().String(),
+				SourceID:  source.ID,
+				ChatID:    chatID,
+			})
+		}
+	}
+
+	forwarded, err := s.messageRepo.CreateForwarded(ctx, userID, copies)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("message cannot be forwarded")
+		}
+		return nil, err
+	}
+	return forwarded, nil
+}
+
+// checkVoiceAccepted refuses voice messages to a private chat whose other
+// member has turned them off, like a voice chat_message frame would be
+func (s *MessageService) checkVoiceAccepted(ctx context.Context, chatID, userID int) error {
+	chat, err := s.chatRepo.GetByID(ctx, chatID)
+	if err != nil || chat == nil || chat.Type != "private" {
+		return nil
+	}
+
+	members, err := s.chatRepo.GetChatMembers(ctx, chatID)
+	if err != nil {
+		return nil
+	}
+	for _, memberID := range members {
+		if memberID == userID {
+			continue
+		}
+		user, err := s.userRepo.GetByID(ctx, memberID)
+		if err == nil && user != nil && !user.VoiceMessagesEnabled {
+			return errors.New("recipient has disabled voice messages")
+		}
+	}
+	return nil
+}
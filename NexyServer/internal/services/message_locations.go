@@ -0,0 +1,71 @@
+/*
+ * © 2025 Murr | https://github.com/vtstv
+ */
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// UpdateLiveLocation moves the sender's live location in place and returns
+// the message with the new position
+func (s *MessageService) UpdateLiveLocation(ctx context.Context, messageID string, userID int, latitude, longitude float64, accuracy *float64) (*models.Message, error) {
+	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 || (accuracy != nil && *accuracy < 0) {
+		return nil, errors.New("invalid coordinates")
+	}
+
+	msg, err := s.liveLocationMessage(ctx, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := s.messageRepo.UpdateLiveLocation(ctx, msg.ID, latitude, longitude, accuracy)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("live location has ended")
+		}
+		return nil, err
+	}
+	msg.Location = loc
+	return msg, nil
+}
+
+// StopLiveLocation ends the sender's live location before its period runs out
+func (s *MessageService) StopLiveLocation(ctx context.Context, messageID string, userID int) (*models.Message, error) {
+	msg, err := s.liveLocationMessage(ctx, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := s.messageRepo.StopLiveLocation(ctx, msg.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("live location has ended")
+		}
+		return nil, err
+	}
+	msg.Location = loc
+	return msg, nil
+}
+
+// liveLocationMessage loads a location message the user sent. Sharing it was
+// checked against the chat when it was sent, and the position is the
+// sender's own, so moving or stopping it skips the chat access checks that
+// would otherwise run on every update.
+func (s *MessageService) liveLocationMessage(ctx context.Context, messageID string, userID int) (*models.Message, error) {
+	msg, err := s.findMessage(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.MessageType != "location" {
+		return nil, errors.New("message is not a location")
+	}
+	if msg.SenderID != userID {
+		return nil, errors.New("only the sender can share their location")
+	}
+	return msg, nil
+}
@@ -0,0 +1,46 @@
+/*
+ * © 2025 Murr | https://github.com/vtstv
+ */
+package services
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// NextUnreadMention returns the user's oldest unread mention in the chat after
+// the message with server ID afterID, marking it read, along with how many
+// unread mentions remain. The message is nil once there are none left.
+func (s *MessageService) NextUnreadMention(ctx context.Context, chatID, userID, afterID int) (*models.Message, int, error) {
+	if err := s.access.Authorize(ctx, chatID, userID, models.ChatActionView); err != nil {
+		return nil, 0, err
+	}
+
+	var msg *models.Message
+	messageID, err := s.messageRepo.NextUnreadMention(ctx, chatID, userID, afterID)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return nil, 0, err
+	default:
+		msg, err = s.messageRepo.GetByID(ctx, messageID)
+		if err != nil {
+			return nil, 0, err
+		}
+		if msg.SenderID > 0 {
+			msg.Sender = s.loadSender(ctx, msg.SenderID)
+		}
+		if mentions, err := s.messageRepo.GetMentions(ctx, []int{msg.ID}); err == nil {
+			msg.Mentions = mentions[msg.ID]
+		}
+		attachPayloads(ctx, s.messageRepo, []*models.Message{msg}, userID)
+	}
+
+	remaining, err := s.messageRepo.CountUnreadMentions(ctx, chatID, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	return msg, remaining, nil
+}
@@ -0,0 +1,146 @@
+/*
+ * © 2025 Murr | https://github.com/vtstv
+ */
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vtstv/nexy/internal/models"
+	"github.com/vtstv/nexy/internal/repositories"
+)
+
+const pinSnippetLength = 50
+
+// PinMessage pins a message of the chat. A shared pin needs the PinMessages
+// right and is announced with a system message, returned alongside the pin.
+// With forMe set, which only private chats allow, the pin is visible to the
+// user alone and nothing is announced.
+func (s *MessageService) PinMessage(ctx context.Context, chatID, userID int, messageID string, forMe bool) (*models.PinnedMessage, *models.Message, error) {
+	msg, err := s.pinTarget(ctx, chatID, userID, messageID, forMe)
+	if err != nil {
+		return nil, nil, err
+	}
+	if msg.MessageType == "system" {
+		return nil, nil, errors.New("system messages cannot be pinned")
+	}
+
+	var forUserID *int
+	if forMe {
+		forUserID = &userID
+	}
+	pinned, err := s.messageRepo.PinMessage(ctx, chatID, msg.ID, userID, forUserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !pinned {
+		return nil, nil, errors.New("message already pinned")
+	}
+
+	attachPayloads(ctx, s.messageRepo, []*models.Message{msg}, userID)
+	pin := &models.PinnedMessage{
+		Message:  msg,
+		PinnedBy: &userID,
+		PinnedAt: time.Now(),
+		ForMe:    forMe,
+	}
+	if forMe {
+		return pin, nil, nil
+	}
+
+	system := &models.Message{
+		MessageID:   uuid.New().String(),
+		ChatID:      chatID,
+		SenderID:    userID,
+		MessageType: "system",
+		Content:     actorName(ctx, s.userRepo, userID) + " pinned " + pinSnippet(msg),
+		ReplyToID:   &msg.ID,
+	}
+	if err := s.messageRepo.Create(ctx, system); err != nil {
+		return pin, nil, fmt.Errorf("failed to create pin message: %w", err)
+	}
+	return pin, system, nil
+}
+
+// UnpinMessage removes the shared pin, or with forMe the user's own one, and
+// returns the message that was pinned
+func (s *MessageService) UnpinMessage(ctx context.Context, chatID, userID int, messageID string, forMe bool) (*models.Message, error) {
+	msg, err := s.pinTarget(ctx, chatID, userID, messageID, forMe)
+	if err != nil {
+		return nil, err
+	}
+
+	var forUserID *int
+	if forMe {
+		forUserID = &userID
+	}
+	unpinned, err := s.messageRepo.UnpinMessage(ctx, chatID, msg.ID, forUserID)
+	if err != nil {
+		return nil, err
+	}
+	if !unpinned {
+		return nil, errors.New("message not pinned")
+	}
+	return msg, nil
+}
+
+// pinTarget loads a message of the chat and checks the user may change its
+// shared pin, or for forMe keep a pin of their own
+func (s *MessageService) pinTarget(ctx context.Context, chatID, userID int, messageID string, forMe bool) (*models.Message, error) {
+	action := models.ChatActionPinMessages
+	if forMe {
+		chat, err := s.chatRepo.GetByID(ctx, chatID)
+		if err != nil {
+			return nil, err
+		}
+		if chat != nil && chat.Type != "private" {
+			return nil, errors.New("pins for one side are only available in private chats")
+		}
+		action = models.ChatActionParticipate
+	}
+	if err := s.access.Authorize(ctx, chatID, userID, action); err != nil {
+		return nil, err
+	}
+
+	msg, err := s.messageRepo.GetByUUID(ctx, messageID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("message not found")
+		}
+		return nil, err
+	}
+	if msg.ChatID != chatID || msg.IsDeleted {
+		return nil, errors.New("message not found")
+	}
+	return msg, nil
+}
+
+// pinSnippet describes the pinned message in the system message
+func pinSnippet(msg *models.Message) string {
+	if spec, ok := models.LookupMessageType(msg.MessageType); ok && spec.Media {
+		return "a " + msg.MessageType
+	}
+
+	content := []rune(msg.Content)
+	if len(content) > pinSnippetLength {
+		return "\"" + string(content[:pinSnippetLength]) + "...\""
+	}
+	return "\"" + string(content) + "\""
+}
+
+// actorName is how system messages refer to the user who acted
+func actorName(ctx context.Context, userRepo *repositories.UserRepository, userID int) string {
+	user, err := userRepo.GetByID(ctx, userID)
+	if err != nil || user == nil {
+		return "Someone"
+	}
+	if user.DisplayName != "" {
+		return user.DisplayName
+	}
+	return user.Username
+}
@@ -0,0 +1,141 @@
+/*
+ * © 2025 Murr | https://github.com/vtstv
+ */
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/vtstv/nexy/internal/models"
+	"github.com/vtstv/nexy/internal/repositories"
+)
+
+// VotePoll replaces the user's votes in a poll with the given options, or
+// withdraws them when there are none, and returns the poll message with the
+// updated results. Quiz answers are final.
+func (s *MessageService) VotePoll(ctx context.Context, messageID string, userID int, options []int) (*models.Message, error) {
+	msg, poll, err := s.pollMessage(ctx, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.access.Authorize(ctx, msg.ChatID, userID, models.ChatActionParticipate); err != nil {
+		return nil, err
+	}
+
+	if poll.Closed {
+		return nil, errors.New("poll is closed")
+	}
+	if len(options) == 0 && poll.Quiz {
+		return nil, errors.New("quiz answers cannot be withdrawn")
+	}
+	if len(options) > 1 && !poll.MultipleChoice {
+		return nil, errors.New("only one option can be chosen")
+	}
+	chosen := make(map[int]bool, len(options))
+	for _, option := range options {
+		if option < 0 || option >= len(poll.Options) || chosen[option] {
+			return nil, errors.New("invalid poll option")
+		}
+		chosen[option] = true
+	}
+
+	applied, err := s.messageRepo.VotePoll(ctx, poll.ID, userID, options, poll.Quiz)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("poll is closed")
+		}
+		return nil, err
+	}
+	if !applied {
+		return nil, errors.New("quiz already answered")
+	}
+
+	return s.withPoll(ctx, msg, userID)
+}
+
+// ClosePoll stops a poll taking votes. Its creator can close it, and so can
+// whoever may close others' polls in the chat.
+func (s *MessageService) ClosePoll(ctx context.Context, messageID string, userID int) (*models.Message, error) {
+	msg, poll, err := s.pollMessage(ctx, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.SenderID != userID {
+		if err := s.access.Authorize(ctx, msg.ChatID, userID, models.ChatActionClosePolls); err != nil {
+			return nil, err
+		}
+	}
+
+	closed, err := s.messageRepo.ClosePoll(ctx, poll.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !closed {
+		return nil, errors.New("poll is closed")
+	}
+
+	return s.withPoll(ctx, msg, userID)
+}
+
+// pollMessage loads a poll message the user can read, with its poll
+func (s *MessageService) pollMessage(ctx context.Context, messageID string, userID int) (*models.Message, *models.Poll, error) {
+	msg, err := s.visibleMessage(ctx, messageID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if msg.MessageType != "poll" {
+		return nil, nil, errors.New("message is not a poll")
+	}
+
+	polls, err := s.messageRepo.GetPolls(ctx, []int{msg.ID}, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	poll, ok := polls[msg.ID]
+	if !ok {
+		return nil, nil, errors.New("message is not a poll")
+	}
+	return msg, poll, nil
+}
+
+// withPoll attaches the message's poll as the user now sees it
+func (s *MessageService) withPoll(ctx context.Context, msg *models.Message, userID int) (*models.Message, error) {
+	polls, err := s.messageRepo.GetPolls(ctx, []int{msg.ID}, userID)
+	if err != nil {
+		return nil, err
+	}
+	msg.Poll = polls[msg.ID]
+	return msg, nil
+}
+
+// attachPayloads attaches the polls, as userID sees them, and the locations of
+// the messages that have one. They are optional: when they cannot be loaded
+// the messages go without.
+func attachPayloads(ctx context.Context, messageRepo *repositories.MessageRepository, messages []*models.Message, userID int) {
+	messageIDs := make([]int, 0, len(messages))
+	for _, msg := range messages {
+		if msg != nil {
+			messageIDs = append(messageIDs, msg.ID)
+		}
+	}
+	if len(messageIDs) == 0 {
+		return
+	}
+
+	polls, err := messageRepo.GetPolls(ctx, messageIDs, userID)
+	if err != nil {
+		polls = make(map[int]*models.Poll)
+	}
+	locations, err := messageRepo.GetLocations(ctx, messageIDs)
+	if err != nil {
+		locations = make(map[int]*models.Location)
+	}
+	for _, msg := range messages {
+		if msg != nil {
+			msg.Poll = polls[msg.ID]
+			msg.Location = locations[msg.ID]
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"database/sql"
 	"errors"
 	"strings"
+	"time"
 
 	"github.com/vtstv/nexy/internal/models"
 	"github.com/vtstv/nexy/internal/repositories"
@@ -19,6 +20,10 @@ type MessageService struct {
 	userRepo     *repositories.UserRepository
 	reactionRepo *repositories.ReactionRepository
 	fileService  *FileService
+	access       *ChatAccessService
+	mentions     *MentionService
+	editWindow   time.Duration
+	deleteWindow time.Duration
 }
 
 func NewMessageService(messageRepo *repositories.MessageRepository, chatRepo *repositories.ChatRepository, userRepo *repositories.UserRepository, reactionRepo *repositories.ReactionRepository, fileService *FileService) *MessageService {
@@ -28,33 +33,34 @@ func NewMessageService(messageRepo *repositories.MessageRepository, chatRepo *re
 		userRepo:     userRepo,
 		reactionRepo: reactionRepo,
 		fileService:  fileService,
+		access:       NewChatAccessService(chatRepo),
+		mentions:     NewMentionService(messageRepo),
 	}
 }
 
-func (s *MessageService) GetChatHistory(ctx context.Context, chatID, userID, limit, offset int) ([]*models.Message, error) {
-	chat, err := s.chatRepo.GetByID(ctx, chatID)
-	if err != nil {
-		return nil, err
-	}
-	if chat == nil {
-		return nil, errors.New("chat not found")
-	}
+// SetEditWindow limits how long after sending a message can be edited, 0
+// meaning no limit
+func (s *MessageService) SetEditWindow(window time.Duration) {
+	s.editWindow = window
+}
 
-	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
-	if err != nil {
-		return nil, err
-	}
+// SetDeleteWindow limits how long after sending a sender can delete a message
+// for everyone, 0 meaning no limit
+func (s *MessageService) SetDeleteWindow(window time.Duration) {
+	s.deleteWindow = window
+}
 
-	// Allow access if user is a member OR if it's a public group
-	if !isMember && chat.GroupType != "public_group" {
-		return nil, errors.New("not a member of this chat")
+func (s *MessageService) GetChatHistory(ctx context.Context, chatID, userID, limit, offset int) ([]*models.Message, error) {
+	// Members and, for public groups, anyone who is not banned
+	if err := s.access.Authorize(ctx, chatID, userID, models.ChatActionView); err != nil {
+		return nil, err
 	}
 
 	if limit <= 0 || limit > 100 {
 		limit = 50
 	}
 
-	messages, err := s.messageRepo.GetByChatID(ctx, chatID, limit, offset)
+	messages, err := s.messageRepo.GetByChatID(ctx, chatID, userID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -72,24 +78,38 @@ func (s *MessageService) GetChatHistory(ctx context.Context, chatID, userID, lim
 		reactionsMap = make(map[int][]models.ReactionCount)
 	}
 
-	// Enrich messages with sender info and reactions
+	// Reply counts and mentions are optional as well
+	threads, err := s.messageRepo.GetThreadInfo(ctx, chatID, messageIDs, userID)
+	if err != nil {
+		threads = make(map[int]*models.ThreadInfo)
+	}
+	mentions, err := s.messageRepo.GetMentions(ctx, messageIDs)
+	if err != nil {
+		mentions = make(map[int][]models.MentionEntity)
+	}
+	attachPayloads(ctx, s.messageRepo, messages, userID)
+
+	// Enrich messages with sender info, reactions, threads and mentions
 	for _, msg := range messages {
 		if msg.SenderID > 0 {
-			sender, err := s.userRepo.GetByID(ctx, msg.SenderID)
-			if err == nil && sender != nil {
-				msg.Sender = sender
-			}
+			msg.Sender = s.loadSender(ctx, msg.SenderID)
 		}
 		// Attach reactions to message
 		if reactions, ok := reactionsMap[msg.ID]; ok {
 			msg.Reactions = reactions
 		}
+		if thread, ok := threads[msg.ID]; ok {
+			msg.Thread = thread
+		}
+		msg.Mentions = mentions[msg.ID]
 	}
 
 	return messages, nil
 }
 
-func (s *MessageService) UpdateMessage(ctx context.Context, messageID string, userID int, content string) (*models.Message, error) {
+// UpdateMessage replaces the content of the user's own message. Its mentions
+// are worked out again from the new content and the given mention entities.
+func (s *MessageService) UpdateMessage(ctx context.Context, messageID string, userID int, content string, mentions []models.MentionEntity) (*models.Message, error) {
 	// Get existing message to verify ownership
 	msg, err := s.messageRepo.GetByUUID(ctx, messageID)
 	if err != nil {
@@ -107,6 +127,24 @@ func (s *MessageService) UpdateMessage(ctx context.Context, messageID string, us
 		return nil, errors.New("cannot edit deleted message")
 	}
 
+	if s.editWindow > 0 && time.Since(msg.CreatedAt) > s.editWindow {
+		return nil, errors.New("edit window has expired")
+	}
+
+	if err := models.ValidateMessageEdit(msg.MessageType, content); err != nil {
+		return nil, err
+	}
+
+	if err := s.access.Authorize(ctx, msg.ChatID, userID, models.ChatActionSendMessages); err != nil {
+		return nil, err
+	}
+
+	resolved, err := s.mentions.ResolveMentions(ctx, msg.ChatID, userID, content, mentions, false)
+	if err != nil {
+		return nil, err
+	}
+	msg.Mentions = resolved
+
 	msg.Content = content
 	msg.IsEdited = true
 
@@ -127,8 +165,10 @@ func (s *MessageService) UpdateMessageStatus(ctx context.Context, messageID, use
 	return s.messageRepo.UpdateStatus(ctx, msgStatus)
 }
 
-func (s *MessageService) DeleteMessage(ctx context.Context, messageID string, userID int) (*models.Message, error) {
-	// Get message to check for attachments
+// DeleteMessage deletes a message for everyone or, with forMe, hides it from
+// the user's own history. Senders may delete their messages for everyone
+// within the delete window; other messages need the DeleteOthers right.
+func (s *MessageService) DeleteMessage(ctx context.Context, messageID string, userID int, forMe bool) (*models.Message, error) {
 	msg, err := s.messageRepo.GetByUUID(ctx, messageID)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -136,35 +176,33 @@ func (s *MessageService) DeleteMessage(ctx context.Context, messageID string, us
 		}
 		return nil, err
 	}
-	if msg == nil {
+	if msg == nil || msg.IsDeleted {
 		return nil, errors.New("message not found")
 	}
 
-	// Check if user can delete this message
-	canDelete := false
-
-	// User can always delete their own messages
-	if msg.SenderID == userID {
-		canDelete = true
-	} else {
-		// For group messages, check if user is admin or owner
-		chat, err := s.chatRepo.GetByID(ctx, msg.ChatID)
-		if err == nil && chat != nil && (chat.Type == "group" || chat.Type == "channel") {
-			member, err := s.chatRepo.GetChatMember(ctx, msg.ChatID, userID)
-			if err == nil && member != nil {
-				if member.Role == "owner" || member.Role == "admin" {
-					canDelete = true
-				}
-			}
+	if forMe {
+		if err := s.access.Authorize(ctx, msg.ChatID, userID, models.ChatActionView); err != nil {
+			return nil, err
+		}
+		if err := s.messageRepo.HideMessage(ctx, userID, msg); err != nil {
+			return nil, err
 		}
+		return msg, nil
 	}
 
-	if !canDelete {
-		return nil, errors.New("unauthorized")
+	if err := s.authorizeDelete(ctx, msg, userID); err != nil {
+		return nil, err
 	}
 
-	// Delete attachment if exists
+	// Delete attachment if exists and no forwarded copy still shows it
+	shared := false
 	if msg.MediaURL != "" {
+		shared, err = s.messageRepo.IsMediaSharedWith(ctx, msg.MediaURL, msg.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if msg.MediaURL != "" && !shared {
 		// Extract file ID from URL (e.g. /files/uuid -> uuid)
 		parts := strings.Split(msg.MediaURL, "/")
 		if len(parts) > 0 {
@@ -174,21 +212,45 @@ func (s *MessageService) DeleteMessage(ctx context.Context, messageID string, us
 		}
 	}
 
-	// Verify user owns the message before deleting
-	if err := s.messageRepo.DeleteMessage(ctx, messageID, userID); err != nil {
+	if err := s.messageRepo.DeleteForEveryone(ctx, msg); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("message not found")
+		}
 		return nil, err
 	}
 
 	return msg, nil
 }
 
+// authorizeDelete checks the user may delete the message for everyone
+func (s *MessageService) authorizeDelete(ctx context.Context, msg *models.Message, userID int) error {
+	if msg.SenderID != userID || msg.MessageType == "system" {
+		return s.access.Authorize(ctx, msg.ChatID, userID, models.ChatActionDeleteOthers)
+	}
+
+	if err := s.access.Authorize(ctx, msg.ChatID, userID, models.ChatActionParticipate); err != nil {
+		return err
+	}
+	if s.deleteWindow > 0 && time.Since(msg.CreatedAt) > s.deleteWindow {
+		// Moderators are not bound by the window
+		if s.access.Authorize(ctx, msg.ChatID, userID, models.ChatActionDeleteOthers) != nil {
+			return errors.New("delete window has expired")
+		}
+	}
+	return nil
+}
+
 func (s *MessageService) SearchMessages(ctx context.Context, chatID, userID int, query string) ([]*models.Message, error) {
-	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
-	if err != nil || !isMember {
-		return nil, errors.New("access denied")
+	if err := s.access.Authorize(ctx, chatID, userID, models.ChatActionView); err != nil {
+		return nil, err
 	}
 
-	return s.messageRepo.SearchMessages(ctx, chatID, query)
+	messages, err := s.messageRepo.SearchMessages(ctx, chatID, userID, query)
+	if err != nil {
+		return nil, err
+	}
+	attachPayloads(ctx, s.messageRepo, messages, userID)
+	return messages, nil
 }
 
 func (s *MessageService) GetMessageByID(ctx context.Context, messageID string, userID int) (*models.Message, error) {
@@ -203,34 +265,19 @@ func (s *MessageService) GetMessageByID(ctx context.Context, messageID string, u
 		return nil, errors.New("message not found")
 	}
 
-	isMember, err := s.chatRepo.IsMember(ctx, msg.ChatID, userID)
-	if err != nil {
+	if err := s.access.Authorize(ctx, msg.ChatID, userID, models.ChatActionView); err != nil {
 		return nil, err
 	}
 
-	chat, err := s.chatRepo.GetByID(ctx, msg.ChatID)
-	if err != nil {
-		return nil, err
-	}
-	if chat == nil {
-		return nil, errors.New("chat not found")
-	}
-
-	if !isMember && chat.GroupType != "public_group" {
-		return nil, errors.New("unauthorized")
-	}
-
 	if msg.SenderID > 0 {
-		sender, err := s.userRepo.GetByID(ctx, msg.SenderID)
-		if err == nil && sender != nil {
-			msg.Sender = sender
-		}
+		msg.Sender = s.loadSender(ctx, msg.SenderID)
 	}
 
 	reactions, err := s.reactionRepo.GetReactionsByMessageID(ctx, msg.ID, userID)
 	if err == nil {
 		msg.Reactions = reactions
 	}
+	attachPayloads(ctx, s.messageRepo, []*models.Message{msg}, userID)
 
 	return msg, nil
 }
@@ -247,34 +294,30 @@ func (s *MessageService) GetMessageByServerID(ctx context.Context, serverID int,
 		return nil, errors.New("message not found")
 	}
 
-	isMember, err := s.chatRepo.IsMember(ctx, msg.ChatID, userID)
-	if err != nil {
+	if err := s.access.Authorize(ctx, msg.ChatID, userID, models.ChatActionView); err != nil {
 		return nil, err
 	}
 
-	chat, err := s.chatRepo.GetByID(ctx, msg.ChatID)
-	if err != nil {
-		return nil, err
-	}
-	if chat == nil {
-		return nil, errors.New("chat not found")
-	}
-
-	if !isMember && chat.GroupType != "public_group" {
-		return nil, errors.New("unauthorized")
-	}
-
 	if msg.SenderID > 0 {
-		sender, err := s.userRepo.GetByID(ctx, msg.SenderID)
-		if err == nil && sender != nil {
-			msg.Sender = sender
-		}
+		msg.Sender = s.loadSender(ctx, msg.SenderID)
 	}
 
 	reactions, err := s.reactionRepo.GetReactionsByMessageID(ctx, msg.ID, userID)
 	if err == nil {
 		msg.Reactions = reactions
 	}
+	attachPayloads(ctx, s.messageRepo, []*models.Message{msg}, userID)
 
 	return msg, nil
 }
+
+// loadSender returns a message's sender as shown to other users, without
+// their presence, or nil when they cannot be loaded
+func (s *MessageService) loadSender(ctx context.Context, senderID int) *models.User {
+	sender, err := s.userRepo.GetByID(ctx, senderID)
+	if err != nil || sender == nil {
+		return nil
+	}
+	HidePresence(sender)
+	return sender
+}
@@ -0,0 +1,124 @@
+/*
+ * © 2025 Murr | https://github.com/vtstv
+ */
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// GetReplies returns a page of the replies to a message, oldest first. The
+// message is given by its server ID or UUID.
+func (s *MessageService) GetReplies(ctx context.Context, messageID string, userID, limit, offset int) ([]*models.Message, error) {
+	parent, err := s.visibleMessage(ctx, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	replies, err := s.messageRepo.GetReplies(ctx, parent.ChatID, parent.ID, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	replyIDs := make([]int, 0, len(replies))
+	for _, reply := range replies {
+		replyIDs = append(replyIDs, reply.ID)
+	}
+	reactionsMap, err := s.reactionRepo.GetReactionsByMessageIDs(ctx, replyIDs, userID)
+	if err != nil {
+		reactionsMap = make(map[int][]models.ReactionCount)
+	}
+
+	for _, reply := range replies {
+		if reply.SenderID > 0 {
+			reply.Sender = s.loadSender(ctx, reply.SenderID)
+		}
+		if reactions, ok := reactionsMap[reply.ID]; ok {
+			reply.Reactions = reactions
+		}
+	}
+	attachPayloads(ctx, s.messageRepo, replies, userID)
+
+	return replies, nil
+}
+
+// MarkThreadRead records that the user has read the thread up to replyID, or
+// up to its latest reply when replyID is 0, and returns the updated summary
+func (s *MessageService) MarkThreadRead(ctx context.Context, messageID string, userID, replyID int) (*models.ThreadInfo, error) {
+	parent, err := s.visibleMessage(ctx, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if replyID <= 0 {
+		threads, err := s.messageRepo.GetThreadInfo(ctx, parent.ChatID, []int{parent.ID}, userID)
+		if err != nil {
+			return nil, err
+		}
+		thread, ok := threads[parent.ID]
+		if !ok {
+			return &models.ThreadInfo{}, nil
+		}
+		replyID = thread.LastReplyID
+	}
+
+	if err := s.messageRepo.MarkThreadRead(ctx, userID, parent.ID, replyID); err != nil {
+		return nil, err
+	}
+
+	threads, err := s.messageRepo.GetThreadInfo(ctx, parent.ChatID, []int{parent.ID}, userID)
+	if err != nil {
+		return nil, err
+	}
+	if thread, ok := threads[parent.ID]; ok {
+		return thread, nil
+	}
+	return &models.ThreadInfo{}, nil
+}
+
+// visibleMessage loads a message by its server ID or UUID and checks the user
+// can read its chat
+func (s *MessageService) visibleMessage(ctx context.Context, messageID string, userID int) (*models.Message, error) {
+	msg, err := s.findMessage(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.access.Authorize(ctx, msg.ChatID, userID, models.ChatActionView); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// findMessage loads a message that is not deleted by its server ID or UUID
+func (s *MessageService) findMessage(ctx context.Context, messageID string) (*models.Message, error) {
+	var msg *models.Message
+	var err error
+	if serverID, parseErr := strconv.Atoi(messageID); parseErr == nil {
+		msg, err = s.messageRepo.GetByID(ctx, serverID)
+	} else {
+		msg, err = s.messageRepo.GetByUUID(ctx, messageID)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("message not found")
+		}
+		return nil, err
+	}
+	if msg == nil || msg.IsDeleted {
+		return nil, errors.New("message not found")
+	}
+	return msg, nil
+}
@@ -5,7 +5,9 @@ package services
 
 import (
 	"context"
+	"errors"
 	"time"
+	"unicode/utf8"
 
 	"github.com/vtstv/nexy/internal/models"
 	"github.com/vtstv/nexy/internal/repositories"
@@ -27,6 +29,15 @@ const (
 	StatusHidden      = ""
 )
 
+// Presence in bigger groups is not pushed to every member; clients ask for it
+// through presence subscriptions instead
+const PresenceGroupLimit = 200
+
+const (
+	maxCustomStatusText  = 100
+	maxCustomStatusEmoji = 32
+)
+
 type OnlineStatusService struct {
 	userRepo *repositories.UserRepository
 }
@@ -75,6 +86,42 @@ func (s *OnlineStatusService) ApplyPrivacyFilter(requestingUser, targetUser *mod
 	return s.GetOnlineStatus(targetUser.LastSeen, isOnline)
 }
 
+// EffectivePresence is the state other users see for a stored presence state
+func EffectivePresence(state string, isOnline bool) string {
+	if !isOnline || state == models.PresenceInvisible {
+		return models.PresenceOffline
+	}
+	if state == "" {
+		return models.PresenceOnline
+	}
+	return state
+}
+
+// ApplyPresence fills in the status text and presence state requestingUser
+// may see on targetUser. Users looking at themselves keep their real state.
+func (s *OnlineStatusService) ApplyPresence(requestingUser, targetUser *models.User, isOnline bool) {
+	visibleOnline := isOnline && targetUser.PresenceState != models.PresenceInvisible
+	targetUser.OnlineStatus = s.ApplyPrivacyFilter(requestingUser, targetUser, visibleOnline)
+
+	if requestingUser.ID == targetUser.ID {
+		return
+	}
+	if targetUser.OnlineStatus == StatusHidden {
+		targetUser.PresenceState = ""
+		targetUser.CustomStatus = nil
+		return
+	}
+	targetUser.PresenceState = EffectivePresence(targetUser.PresenceState, isOnline)
+}
+
+// HidePresence clears the presence state, custom status and status text of a
+// user shown to others where no viewer is known, such as a message sender
+func HidePresence(user *models.User) {
+	user.OnlineStatus = ""
+	user.PresenceState = ""
+	user.CustomStatus = nil
+}
+
 func (s *OnlineStatusService) EnrichUserWithStatus(ctx context.Context, user *models.User, requestingUserID int, isOnline bool) error {
 	if user == nil {
 		return nil
@@ -85,7 +132,7 @@ func (s *OnlineStatusService) EnrichUserWithStatus(ctx context.Context, user *mo
 		return err
 	}
 
-	user.OnlineStatus = s.ApplyPrivacyFilter(requestingUser, user, isOnline)
+	s.ApplyPresence(requestingUser, user, isOnline)
 	return nil
 }
 
@@ -101,8 +148,92 @@ func (s *OnlineStatusService) EnrichUsersWithStatus(ctx context.Context, users [
 
 	for _, user := range users {
 		isOnline := onlineUserIDs[user.ID]
-		user.OnlineStatus = s.ApplyPrivacyFilter(requestingUser, user, isOnline)
+		s.ApplyPresence(requestingUser, user, isOnline)
 	}
 
 	return nil
 }
+
+// PresenceAudience lists the users that should be pushed userID's presence
+// changes: their contacts and chat peers, plus those of subscriberIDs the
+// privacy and block rules still allow. hidden reports that userID hides their
+// status from everyone.
+func (s *OnlineStatusService) PresenceAudience(ctx context.Context, userID int, subscriberIDs []int) (audience []int, hidden bool, err error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	if !user.ShowOnlineStatus {
+		return nil, true, nil
+	}
+
+	audience, err = s.userRepo.GetPresenceAudience(ctx, userID, PresenceGroupLimit)
+	if err != nil {
+		return nil, false, err
+	}
+	subscribers, err := s.userRepo.FilterPresenceViewers(ctx, userID, subscriberIDs)
+	if err != nil {
+		return nil, false, err
+	}
+	return append(audience, subscribers...), false, nil
+}
+
+// PresenceStatus returns the status text viewerID may see for targetID, or
+// StatusHidden if privacy settings forbid it
+func (s *OnlineStatusService) PresenceStatus(ctx context.Context, viewerID, targetID int, isOnline bool) (string, error) {
+	viewer, err := s.userRepo.GetByID(ctx, viewerID)
+	if err != nil {
+		return StatusHidden, err
+	}
+
+	target, err := s.userRepo.GetByID(ctx, targetID)
+	if err != nil {
+		return StatusHidden, err
+	}
+
+	// A block in either direction hides presence, as in the pushed audience
+	visible, err := s.userRepo.FilterPresenceViewers(ctx, targetID, []int{viewerID})
+	if err != nil {
+		return StatusHidden, err
+	}
+	if len(visible) == 0 {
+		return StatusHidden, nil
+	}
+
+	return s.ApplyPrivacyFilter(viewer, target, isOnline && target.PresenceState != models.PresenceInvisible), nil
+}
+
+// CurrentPresence returns the state and custom status others see for userID
+func (s *OnlineStatusService) CurrentPresence(ctx context.Context, userID int, isOnline bool) (string, *models.CustomStatus, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	return EffectivePresence(user.PresenceState, isOnline), user.CustomStatus, nil
+}
+
+// SetPresence stores an explicit presence state
+func (s *OnlineStatusService) SetPresence(ctx context.Context, userID int, state string) error {
+	switch state {
+	case models.PresenceOnline, models.PresenceAway, models.PresenceDND, models.PresenceInvisible:
+	default:
+		return errors.New("invalid presence state")
+	}
+	return s.userRepo.UpdatePresenceState(ctx, userID, state)
+}
+
+// SetCustomStatus sets the custom status, or clears it when status is nil
+func (s *OnlineStatusService) SetCustomStatus(ctx context.Context, userID int, status *models.CustomStatus) error {
+	if status != nil {
+		if status.Text == "" && status.Emoji == "" {
+			status = nil
+		} else if utf8.RuneCountInString(status.Text) > maxCustomStatusText {
+			return errors.New("custom status text is too long")
+		} else if utf8.RuneCountInString(status.Emoji) > maxCustomStatusEmoji {
+			return errors.New("custom status emoji is too long")
+		} else if status.ExpiresAt != nil && !status.ExpiresAt.After(time.Now()) {
+			return errors.New("custom status expiry must be in the future")
+		}
+	}
+	return s.userRepo.UpdateCustomStatus(ctx, userID, status)
+}
@@ -12,6 +12,7 @@ type ReactionService struct {
 	reactionRepo *repositories.ReactionRepository
 	messageRepo  *repositories.MessageRepository
 	chatRepo     *repositories.ChatRepository
+	access       *ChatAccessService
 }
 
 func NewReactionService(reactionRepo *repositories.ReactionRepository, messageRepo *repositories.MessageRepository, chatRepo *repositories.ChatRepository) *ReactionService {
@@ -19,6 +20,7 @@ func NewReactionService(reactionRepo *repositories.ReactionRepository, messageRe
 		reactionRepo: reactionRepo,
 		messageRepo:  messageRepo,
 		chatRepo:     chatRepo,
+		access:       NewChatAccessService(chatRepo),
 	}
 }
 
@@ -41,14 +43,10 @@ func (s *ReactionService) AddReaction(ctx context.Context, messageID, userID int
 		return nil, errors.New("message not found")
 	}
 
-	// Check if user is a member of the chat
-	isMember, err := s.chatRepo.IsMember(ctx, message.ChatID, userID)
-	if err != nil {
+	// Check if user may participate in the chat
+	if err := s.access.Authorize(ctx, message.ChatID, userID, models.ChatActionParticipate); err != nil {
 		return nil, err
 	}
-	if !isMember {
-		return nil, errors.New("user is not a member of this chat")
-	}
 
 	result := &AddReactionResult{
 		ChatID: message.ChatID,
@@ -109,14 +107,10 @@ func (s *ReactionService) RemoveReaction(ctx context.Context, messageID, userID
 		return 0, errors.New("message not found")
 	}
 
-	// Check if user is a member of the chat
-	isMember, err := s.chatRepo.IsMember(ctx, message.ChatID, userID)
-	if err != nil {
+	// Check if user may participate in the chat
+	if err := s.access.Authorize(ctx, message.ChatID, userID, models.ChatActionParticipate); err != nil {
 		return 0, err
 	}
-	if !isMember {
-		return 0, errors.New("user is not a member of this chat")
-	}
 
 	return message.ChatID, s.reactionRepo.RemoveReaction(ctx, messageID, userID, emoji)
 }
@@ -0,0 +1,197 @@
+/*
+ * © 2025 Murr | https://github.com/vtstv
+ */
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vtstv/nexy/internal/models"
+	"github.com/vtstv/nexy/internal/repositories"
+)
+
+const (
+	scheduledDispatchInterval = 5 * time.Second
+	scheduledBatchSize        = 50
+	// A claim older than this is assumed to belong to a dead instance
+	scheduledClaimLease  = 2 * time.Minute
+	maxScheduledAttempts = 5
+	maxScheduleAhead     = 365 * 24 * time.Hour
+)
+
+// ScheduledMessageSender posts a due message the way a live chat_message is
+// posted. Refusals that retrying cannot fix carry an ErrorCode.
+type ScheduledMessageSender interface {
+	SendScheduledMessage(ctx context.Context, messageID string, chatID, senderID int, body json.RawMessage) (int, error)
+}
+
+type ScheduledMessageService struct {
+	repo   *repositories.ScheduledMessageRepository
+	access *ChatAccessService
+	sender ScheduledMessageSender
+}
+
+func NewScheduledMessageService(repo *repositories.ScheduledMessageRepository, chatRepo *repositories.ChatRepository) *ScheduledMessageService {
+	return &ScheduledMessageService{
+		repo:   repo,
+		access: NewChatAccessService(chatRepo),
+	}
+}
+
+func (s *ScheduledMessageService) SetSender(sender ScheduledMessageSender) {
+	s.sender = sender
+}
+
+func (s *ScheduledMessageService) validate(ctx context.Context, msg *models.ScheduledMessage) error {
+	if !msg.SendAt.After(time.Now()) {
+		return errors.New("send_at must be in the future")
+	}
+	if msg.SendAt.After(time.Now().Add(maxScheduleAhead)) {
+		return errors.New("send_at is too far ahead")
+	}
+
+	// Check the body up front, so a malformed message is refused when
+	// scheduled rather than when due
+	_, spec, err := models.ParseMessageBody(msg.Body)
+	if err != nil {
+		return err
+	}
+
+	return s.access.Authorize(ctx, msg.ChatID, msg.SenderID, spec.Action)
+}
+
+func (s *ScheduledMessageService) Schedule(ctx context.Context, msg *models.ScheduledMessage) error {
+	if err := s.validate(ctx, msg); err != nil {
+		return err
+	}
+	// Always ours: a client-chosen ID matching an existing message would make
+	// the dispatcher take it for already sent
+	msg.MessageID = uuid.New().String()
+	return s.repo.Create(ctx, msg)
+}
+
+func (s *ScheduledMessageService) GetPending(ctx context.Context, userID, chatID int) ([]*models.ScheduledMessage, error) {
+	return s.repo.GetPending(ctx, userID, chatID)
+}
+
+// Update changes the body and/or send time of a message that has not been
+// picked up for sending yet. A nil body or zero sendAt keeps the current one.
+func (s *ScheduledMessageService) Update(ctx context.Context, id, userID int, body json.RawMessage, sendAt time.Time) (*models.ScheduledMessage, error) {
+	msg, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil || msg.SenderID != userID {
+		return nil, errors.New("scheduled message not found")
+	}
+	if msg.Status != models.ScheduledPending {
+		return nil, errors.New("scheduled message is no longer pending")
+	}
+
+	if len(body) > 0 {
+		msg.Body = body
+	}
+	if !sendAt.IsZero() {
+		msg.SendAt = sendAt
+	}
+	if err := s.validate(ctx, msg); err != nil {
+		return nil, err
+	}
+
+	updated, err := s.repo.Update(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, errors.New("scheduled message is no longer pending")
+	}
+	return msg, nil
+}
+
+func (s *ScheduledMessageService) Cancel(ctx context.Context, id, userID int) error {
+	msg, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if msg == nil || msg.SenderID != userID {
+		return errors.New("scheduled message not found")
+	}
+
+	cancelled, err := s.repo.Cancel(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		return errors.New("scheduled message is no longer pending")
+	}
+	return nil
+}
+
+// RunDispatcher posts due messages until ctx is done. Every instance may run
+// one; claims in the database keep them from sending the same message.
+func (s *ScheduledMessageService) RunDispatcher(ctx context.Context) {
+	ticker := time.NewTicker(scheduledDispatchInterval)
+	defer ticker.Stop()
+
+	for {
+		s.dispatchDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *ScheduledMessageService) dispatchDue(ctx context.Context) {
+	if s.sender == nil {
+		return
+	}
+
+	for {
+		due, err := s.repo.ClaimDue(ctx, scheduledBatchSize, scheduledClaimLease)
+		if err != nil {
+			log.Printf("Error claiming scheduled messages: %v", err)
+			return
+		}
+
+		for _, msg := range due {
+			s.dispatch(ctx, msg)
+		}
+
+		if len(due) < scheduledBatchSize {
+			return
+		}
+	}
+}
+
+func (s *ScheduledMessageService) dispatch(ctx context.Context, msg *models.ScheduledMessage) {
+	_, err := s.sender.SendScheduledMessage(ctx, msg.MessageID, msg.ChatID, msg.SenderID, msg.Body)
+	if err == nil {
+		if err := s.repo.MarkSent(ctx, msg.ID); err != nil {
+			log.Printf("Error marking scheduled message %d as sent: %v", msg.ID, err)
+		}
+		return
+	}
+
+	// Access refusals and the like will not change on retry
+	_, refused := err.(interface{ ErrorCode() string })
+	if refused || msg.Attempts >= maxScheduledAttempts {
+		log.Printf("Scheduled message %d failed: %v", msg.ID, err)
+		if err := s.repo.MarkFailed(ctx, msg.ID, err.Error()); err != nil {
+			log.Printf("Error marking scheduled message %d as failed: %v", msg.ID, err)
+		}
+		return
+	}
+
+	log.Printf("Scheduled message %d will be retried (attempt %d): %v", msg.ID, msg.Attempts, err)
+	if err := s.repo.Release(ctx, msg.ID, err.Error()); err != nil {
+		log.Printf("Error releasing scheduled message %d: %v", msg.ID, err)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+ * © 2025 Murr | https://github.com/vtstv
+ */
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vtstv/nexy/internal/config"
+)
+
+type ICEServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+	Region     string   `json:"region,omitempty"`
+}
+
+// TURNService issues time-limited TURN credentials following the TURN REST
+// API scheme, which coturn validates with use-auth-secret
+type TURNService struct {
+	config *config.TURNConfig
+}
+
+func NewTURNService(cfg *config.TURNConfig) *TURNService {
+	if cfg.Secret == "" {
+		log.Println("TURN_SECRET is not set, only STUN servers will be handed out")
+	}
+	return &TURNService{config: cfg}
+}
+
+// ICEServers returns the configured servers with credentials for the user.
+// Servers in the preferred region are listed first. TURN servers are left
+// out when no secret is configured, since coturn would reject them anyway.
+func (s *TURNService) ICEServers(userID int, region string) ([]ICEServer, time.Time) {
+	expiresAt := time.Now().Add(s.config.CredentialTTL)
+	username, credential := s.credentials(userID, expiresAt)
+
+	servers := make([]ICEServer, 0, len(s.config.Servers))
+	for _, server := range s.config.Servers {
+		entry := ICEServer{
+			URLs:   server.URLs,
+			Region: server.Region,
+		}
+		if isTURN(server.URLs) {
+			if s.config.Secret == "" {
+				continue
+			}
+			entry.Username = username
+			entry.Credential = credential
+		}
+		servers = append(servers, entry)
+	}
+
+	if region != "" {
+		sort.SliceStable(servers, func(i, j int) bool {
+			return servers[i].Region == region && servers[j].Region != region
+		})
+	}
+	return servers, expiresAt
+}
+
+// credentials builds the "expiry:userID" username and its base64 HMAC-SHA1
+// password, so coturn can check them without a user database
+func (s *TURNService) credentials(userID int, expiresAt time.Time) (string, string) {
+	username := fmt.Sprintf("%d:%d", expiresAt.Unix(), userID)
+
+	mac := hmac.New(sha1.New, []byte(s.config.Secret))
+	mac.Write([]byte(username))
+	return username, base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func isTURN(urls []string) bool {
+	for _, url := range urls {
+		if strings.HasPrefix(url, "turn:") || strings.HasPrefix(url, "turns:") {
+			return true
+		}
+	}
+	return false
+}
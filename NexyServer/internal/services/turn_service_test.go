@@ -0,0 +1,56 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/vtstv/nexy/internal/config"
+)
+
+func TestTURNCredentialsFollowRESTScheme(t *testing.T) {
+	service := NewTURNService(&config.TURNConfig{
+		Secret:        "test-secret",
+		CredentialTTL: time.Hour,
+		Servers: []config.ICEServerConfig{
+			{URLs: []string{"stun:turn.example.com:3478"}},
+			{URLs: []string{"turn:turn.example.com:3478"}},
+		},
+	})
+
+	servers, expiresAt := service.ICEServers(42, "")
+	if len(servers) != 2 {
+		t.Fatalf("got %d servers, want 2", len(servers))
+	}
+	if servers[0].Username != "" || servers[0].Credential != "" {
+		t.Error("STUN server was given credentials")
+	}
+
+	turn := servers[1]
+	if want := fmt.Sprintf("%d:42", expiresAt.Unix()); turn.Username != want {
+		t.Errorf("username = %q, want %q", turn.Username, want)
+	}
+	mac := hmac.New(sha1.New, []byte("test-secret"))
+	mac.Write([]byte(turn.Username))
+	if want := base64.StdEncoding.EncodeToString(mac.Sum(nil)); turn.Credential != want {
+		t.Errorf("credential = %q, want %q", turn.Credential, want)
+	}
+}
+
+func TestTURNServersNeedSecret(t *testing.T) {
+	service := NewTURNService(&config.TURNConfig{
+		CredentialTTL: time.Hour,
+		Servers: []config.ICEServerConfig{
+			{URLs: []string{"stun:turn.example.com:3478"}},
+			{URLs: []string{"turns:turn.example.com:5349"}},
+		},
+	})
+
+	servers, _ := service.ICEServers(42, "")
+	if len(servers) != 1 || servers[0].URLs[0] != "stun:turn.example.com:3478" {
+		t.Errorf("servers without a secret = %+v, want only the STUN server", servers)
+	}
+}
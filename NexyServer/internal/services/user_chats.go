@@ -188,6 +188,19 @@ func (s *UserService) GetChat(ctx context.Context, userID, chatID int) (*models.
 				chat.FirstUnreadMessageId = firstUnreadId
 			}
 		}
+
+		if mentions, err := s.messageRepo.CountUnreadMentions(ctx, chatID, userID); err == nil {
+			chat.UnreadMentionCount = mentions
+		}
+	}
+
+	if pinned, err := s.messageRepo.GetPinnedMessages(ctx, chatID, userID); err == nil {
+		messages := make([]*models.Message, 0, len(pinned))
+		for _, pin := range pinned {
+			messages = append(messages, pin.Message)
+		}
+		attachPayloads(ctx, s.messageRepo, messages, userID)
+		chat.Pinned = pinned
 	}
 
 	chat.IsMember = isMember
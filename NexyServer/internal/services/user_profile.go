@@ -36,6 +36,26 @@ func (s *UserService) GetUserByIDWithStatus(ctx context.Context, id int, request
 	return user, nil
 }
 
+// UpdatePresence changes the user's presence state and/or custom status
+func (s *UserService) UpdatePresence(ctx context.Context, userID int, state string, customStatus *models.CustomStatus, clearCustomStatus bool) (*models.User, error) {
+	if s.onlineStatusService == nil {
+		return nil, fmt.Errorf("presence is not available")
+	}
+
+	if state != "" {
+		if err := s.onlineStatusService.SetPresence(ctx, userID, state); err != nil {
+			return nil, err
+		}
+	}
+	if customStatus != nil || clearCustomStatus {
+		if err := s.onlineStatusService.SetCustomStatus(ctx, userID, customStatus); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.userRepo.GetByID(ctx, userID)
+}
+
 // SearchUsers searches for users by query
 func (s *UserService) SearchUsers(ctx context.Context, query string, limit int) ([]*models.User, error) {
 	if limit <= 0 || limit > 50 {
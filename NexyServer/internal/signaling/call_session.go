@@ -0,0 +1,282 @@
+package signaling
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/vtstv/nexy/internal/models"
+)
+
+type CallState string
+
+const (
+	CallRinging  CallState = "ringing"
+	CallAccepted CallState = "accepted"
+	CallEnded    CallState = "ended"
+	CallMissed   CallState = "missed"  // Caller hung up before an answer
+	CallBusy     CallState = "busy"    // Callee was in another call or rejects calls
+	CallTimeout  CallState = "timeout" // Nobody answered in time
+)
+
+const (
+	ringTimeout = 45 * time.Second
+	callTTL     = 24 * time.Hour
+	// While ringing the active markers outlive the ring only briefly, so a
+	// node dying mid-ring cannot leave both users busy for long
+	ringingActiveTTL = ringTimeout + 15*time.Second
+)
+
+// Terminal reports whether the call can no longer change state
+func (s CallState) Terminal() bool {
+	return s != CallRinging && s != CallAccepted
+}
+
+// Call is the shared record of one call, kept in Redis so any node can
+// route its frames
+type Call struct {
+	ID           string
+	CallerID     int
+	CalleeID     int
+	CallerDevice string
+	CalleeDevice string // Set once a device answers
+	State        CallState
+	Video        bool
+	Reason       string
+	CreatedAt    time.Time
+	AnsweredAt   *time.Time
+	EndedAt      *time.Time
+}
+
+func (c *Call) toModel() *models.Call {
+	calleeID := c.CalleeID
+	return &models.Call{
+		CallID:     c.ID,
+		CallerID:   c.CallerID,
+		CalleeID:   &calleeID,
+		IsVideo:    c.Video,
+		Status:     string(c.State),
+		EndReason:  c.Reason,
+		StartedAt:  c.CreatedAt,
+		AnsweredAt: c.AnsweredAt,
+		EndedAt:    c.EndedAt,
+	}
+}
+
+func callKey(callID string) string {
+	return "nexy:call:" + callID
+}
+
+// ringingCallsKey holds every ringing call scored by when its ring times out,
+// so any node can time it out if the one that started it dies
+const ringingCallsKey = "nexy:call:ringing"
+
+func activeCallKey(userID int) string {
+	return fmt.Sprintf("nexy:call:active:%d", userID)
+}
+
+// callICEKey buffers the caller's candidates while the call rings, for
+// callee devices that connect late
+func callICEKey(callID string) string {
+	return "nexy:call:" + callID + ":ice"
+}
+
+// maxBufferedCandidates bounds the replay a late device receives
+const maxBufferedCandidates = 50
+
+// Results of createCallScript
+const (
+	createOK = iota
+	createCallerBusy
+	createCalleeBusy
+	createDuplicate
+)
+
+// KEYS: call, caller active, callee active, ringing calls
+// ARGV: call ID, active TTL (s), record TTL (s), ring deadline (unix), field/value pairs...
+var createCallScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then return 3 end
+if redis.call('EXISTS', KEYS[2]) == 1 then return 1 end
+if redis.call('EXISTS', KEYS[3]) == 1 then return 2 end
+redis.call('SET', KEYS[2], ARGV[1], 'EX', ARGV[2])
+redis.call('SET', KEYS[3], ARGV[1], 'EX', ARGV[2])
+redis.call('HSET', KEYS[1], unpack(ARGV, 5))
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+redis.call('ZADD', KEYS[4], ARGV[4], ARGV[1])
+return 0
+`)
+
+// KEYS: call
+// ARGV: expected state, new state, field/value pairs...
+var transitionScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'state') ~= ARGV[1] then return 0 end
+redis.call('HSET', KEYS[1], 'state', ARGV[2], unpack(ARGV, 3))
+return 1
+`)
+
+// KEYS: active markers to drop if they still point at the call
+// ARGV: call ID
+var releaseScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	if redis.call('GET', key) == ARGV[1] then redis.call('DEL', key) end
+end
+return 0
+`)
+
+type callStore struct {
+	redis *redis.Client
+}
+
+func (s *callStore) fields(call *Call) []interface{} {
+	return []interface{}{
+		"caller_id", call.CallerID,
+		"callee_id", call.CalleeID,
+		"caller_device", call.CallerDevice,
+		"state", string(call.State),
+		"video", strconv.FormatBool(call.Video),
+		"reason", call.Reason,
+		"created_at", call.CreatedAt.Unix(),
+	}
+}
+
+// create starts a ringing call, marking both users as in a call. It fails
+// with createCallerBusy/createCalleeBusy if either already is. The offer
+// frame is kept so devices that connect while it rings can still get it.
+func (s *callStore) create(ctx context.Context, call *Call, offer []byte) (int, error) {
+	deadline := call.CreatedAt.Add(ringTimeout).Unix()
+	args := []interface{}{call.ID, int(ringingActiveTTL.Seconds()), int(callTTL.Seconds()), deadline}
+	args = append(args, s.fields(call)...)
+	args = append(args, "offer", offer)
+
+	keys := []string{callKey(call.ID), activeCallKey(call.CallerID), activeCallKey(call.CalleeID), ringingCallsKey}
+	return createCallScript.Run(ctx, s.redis, keys, args...).Int()
+}
+
+// record stores a call that never rang, such as a busy one. A retried offer
+// must not overwrite the call it collided with, so existing calls are kept.
+func (s *callStore) record(ctx context.Context, call *Call) error {
+	exists, err := s.redis.Exists(ctx, callKey(call.ID)).Result()
+	if err != nil || exists > 0 {
+		return err
+	}
+
+	pipe := s.redis.TxPipeline()
+	fields := s.fields(call)
+	if call.EndedAt != nil {
+		fields = append(fields, "ended_at", call.EndedAt.Unix())
+	}
+	pipe.HSet(ctx, callKey(call.ID), fields...)
+	pipe.Expire(ctx, callKey(call.ID), callTTL)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *callStore) get(ctx context.Context, callID string) (*Call, error) {
+	values, err := s.redis.HGetAll(ctx, callKey(callID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	call := &Call{
+		ID:           callID,
+		CallerDevice: values["caller_device"],
+		CalleeDevice: values["callee_device"],
+		State:        CallState(values["state"]),
+		Reason:       values["reason"],
+	}
+	call.CallerID, _ = strconv.Atoi(values["caller_id"])
+	call.CalleeID, _ = strconv.Atoi(values["callee_id"])
+	call.Video, _ = strconv.ParseBool(values["video"])
+	call.CreatedAt = parseUnix(values["created_at"])
+	if t := parseUnix(values["answered_at"]); !t.IsZero() {
+		call.AnsweredAt = &t
+	}
+	if t := parseUnix(values["ended_at"]); !t.IsZero() {
+		call.EndedAt = &t
+	}
+	return call, nil
+}
+
+// transition moves the call from one state to another, reporting false if
+// something else changed it first
+func (s *callStore) transition(ctx context.Context, call *Call, to CallState, fields ...interface{}) (bool, error) {
+	args := append([]interface{}{string(call.State), string(to)}, fields...)
+	ok, err := transitionScript.Run(ctx, s.redis, []string{callKey(call.ID)}, args...).Int()
+	if err != nil || ok == 0 {
+		return false, err
+	}
+
+	call.State = to
+	if to.Terminal() || to == CallAccepted {
+		// The offer and the ring deadline are only needed while ringing
+		s.redis.HDel(ctx, callKey(call.ID), "offer")
+		s.redis.Del(ctx, callICEKey(call.ID))
+		s.redis.ZRem(ctx, ringingCallsKey, call.ID)
+	}
+	if to.Terminal() {
+		s.release(ctx, call)
+	} else {
+		// Accepted calls may run long, keep both users marked for the whole call
+		s.redis.Expire(ctx, activeCallKey(call.CallerID), callTTL)
+		s.redis.Expire(ctx, activeCallKey(call.CalleeID), callTTL)
+	}
+	return true, nil
+}
+
+// overdueRinging lists the calls whose ring should have timed out by now
+func (s *callStore) overdueRinging(ctx context.Context, now time.Time) ([]string, error) {
+	return s.redis.ZRangeByScore(ctx, ringingCallsKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Unix(), 10),
+	}).Result()
+}
+
+// pendingOffer returns the stored offer frame and buffered caller candidates
+func (s *callStore) pendingOffer(ctx context.Context, callID string) ([]byte, []string, error) {
+	offer, err := s.redis.HGet(ctx, callKey(callID), "offer").Bytes()
+	if err != nil {
+		return nil, nil, err
+	}
+	candidates, err := s.redis.LRange(ctx, callICEKey(callID), 0, -1).Result()
+	return offer, candidates, err
+}
+
+func (s *callStore) bufferCandidate(ctx context.Context, callID string, frame []byte) {
+	pipe := s.redis.TxPipeline()
+	pipe.RPush(ctx, callICEKey(callID), frame)
+	pipe.LTrim(ctx, callICEKey(callID), -maxBufferedCandidates, -1)
+	pipe.Expire(ctx, callICEKey(callID), ringingActiveTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error buffering ICE candidate for call %s: %v", callID, err)
+	}
+}
+
+// markPushed notes that the callee was woken by a push, so a call that ends
+// while ringing also needs a cancellation push
+func (s *callStore) markPushed(ctx context.Context, callID string) {
+	s.redis.HSet(ctx, callKey(callID), "pushed", "1")
+}
+
+func (s *callStore) wasPushed(ctx context.Context, callID string) bool {
+	pushed, _ := s.redis.HGet(ctx, callKey(callID), "pushed").Result()
+	return pushed == "1"
+}
+
+func (s *callStore) release(ctx context.Context, call *Call) {
+	keys := []string{activeCallKey(call.CallerID), activeCallKey(call.CalleeID)}
+	releaseScript.Run(ctx, s.redis, keys, call.ID)
+}
+
+func parseUnix(value string) time.Time {
+	ts, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ts == 0 {
+		return time.Time{}
+	}
+	return time.Unix(ts, 0)
+}
@@ -0,0 +1,356 @@
+package signaling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/vtstv/nexy/internal/models"
+	nexy "github.com/vtstv/nexy/internal/ws"
+)
+
+// Group calls use a full mesh, every participant uploading to every other
+// one, so the room has to stay small
+const maxGroupCallParticipants = 8
+
+const groupActivePrefix = "group:"
+
+// Results of joinGroupCallScript
+const (
+	joinOK = iota
+	joinBusy
+	joinFull
+)
+
+func groupCallKey(chatID int) string {
+	return fmt.Sprintf("nexy:groupcall:%d", chatID)
+}
+
+func groupCallParticipantsKey(chatID int) string {
+	return fmt.Sprintf("nexy:groupcall:%d:participants", chatID)
+}
+
+// groupActiveValue marks a user as in the chat's group call under the same
+// key 1:1 calls use, so either kind of call makes the user busy for the other
+func groupActiveValue(chatID int) string {
+	return groupActivePrefix + strconv.Itoa(chatID)
+}
+
+// groupParticipant is stored per user in the participants hash. Only one
+// device per user takes part; joining from another one replaces it.
+type groupParticipant struct {
+	DeviceID string `json:"device_id"`
+	Muted    bool   `json:"muted"`
+	Video    bool   `json:"video"`
+	JoinedAt int64  `json:"joined_at"`
+}
+
+// KEYS: room, participants, user active
+// ARGV: user ID, participant JSON, cap, new call ID, now, TTL (s), active marker, video
+var joinGroupCallScript = redis.NewScript(`
+local active = redis.call('GET', KEYS[3])
+if active and active ~= ARGV[7] then return {1, '', ''} end
+local callID = redis.call('HGET', KEYS[1], 'call_id')
+if callID and redis.call('HEXISTS', KEYS[2], ARGV[1]) == 0 and redis.call('HLEN', KEYS[2]) >= tonumber(ARGV[3]) then
+	return {2, callID, ''}
+end
+if not callID then
+	callID = ARGV[4]
+	redis.call('HSET', KEYS[1], 'call_id', callID, 'started_by', ARGV[1], 'started_at', ARGV[5], 'video', ARGV[8])
+end
+local previous = redis.call('HGET', KEYS[2], ARGV[1]) or ''
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+if redis.call('HLEN', KEYS[2]) >= 2 then redis.call('HSETNX', KEYS[1], 'answered_at', ARGV[5]) end
+redis.call('SET', KEYS[3], ARGV[7], 'EX', ARGV[6])
+redis.call('EXPIRE', KEYS[1], ARGV[6])
+redis.call('EXPIRE', KEYS[2], ARGV[6])
+return {0, callID, previous}
+`)
+
+// KEYS: room, participants, user active
+// ARGV: user ID, device ID ("" for any), active marker
+// Returns {0} if the user was not in the call, {1} if others remain, or
+// {2, call_id, started_by, started_at, answered_at, video} once it is empty
+var leaveGroupCallScript = redis.NewScript(`
+local entry = redis.call('HGET', KEYS[2], ARGV[1])
+if not entry then return {0} end
+if ARGV[2] ~= '' and cjson.decode(entry)['device_id'] ~= ARGV[2] then return {0} end
+redis.call('HDEL', KEYS[2], ARGV[1])
+if redis.call('GET', KEYS[3]) == ARGV[3] then redis.call('DEL', KEYS[3]) end
+if redis.call('HLEN', KEYS[2]) > 0 then return {1} end
+local room = redis.call('HMGET', KEYS[1], 'call_id', 'started_by', 'started_at', 'answered_at', 'video')
+redis.call('DEL', KEYS[1])
+return {2, room[1] or '', room[2] or '', room[3] or '', room[4] or '', room[5] or ''}
+`)
+
+func (h *SignalingHandler) HandleGroupCallJoin(msg *nexy.NexyMessage) {
+	if msg.Header.ChatID == nil {
+		return
+	}
+	chatID := *msg.Header.ChatID
+	userID := msg.Header.SenderID
+	device := msg.SenderDevice()
+
+	var body nexy.GroupCallMediaBody
+	if len(msg.Body) > 0 {
+		if err := msg.ParseBody(&body); err != nil {
+			log.Printf("Error parsing group call join: %v", err)
+			return
+		}
+	}
+
+	ctx := context.Background()
+	chat, err := h.chats.GetByID(ctx, chatID)
+	if err != nil || chat == nil || chat.Type != "group" {
+		h.sendError(userID, device, msg, "not_group", "group calls are only available in groups")
+		return
+	}
+
+	now := time.Now().Unix()
+	entry, _ := json.Marshal(groupParticipant{
+		DeviceID: device,
+		Muted:    body.Muted,
+		Video:    body.Video,
+		JoinedAt: now,
+	})
+
+	keys := []string{groupCallKey(chatID), groupCallParticipantsKey(chatID), activeCallKey(userID)}
+	result, err := joinGroupCallScript.Run(ctx, h.calls.redis, keys,
+		userID, entry, maxGroupCallParticipants, uuid.New().String(), now,
+		int(callTTL.Seconds()), groupActiveValue(chatID), strconv.FormatBool(body.Video)).Slice()
+	if err != nil || len(result) < 3 {
+		log.Printf("Error joining group call in chat %d: %v", chatID, err)
+		return
+	}
+
+	status, _ := result[0].(int64)
+	callID, _ := result[1].(string)
+	switch status {
+	case joinBusy:
+		h.sendError(userID, device, msg, "busy", "already in another call")
+		return
+	case joinFull:
+		h.sendError(userID, device, msg, "group_call_full",
+			fmt.Sprintf("the call is limited to %d participants", maxGroupCallParticipants))
+		return
+	}
+
+	log.Printf("User %d joined group call %s in chat %d", userID, callID, chatID)
+
+	// Joining from a second device takes the user out of the call on the first
+	if previous, _ := result[2].(string); previous != "" {
+		var old groupParticipant
+		if json.Unmarshal([]byte(previous), &old) == nil && old.DeviceID != device {
+			h.sendCallFrame(nexy.TypeCallEnd, 0, userID, []string{old.DeviceID}, false, callID, "joined_elsewhere")
+		}
+	}
+
+	h.broadcastGroupCallState(ctx, chatID)
+}
+
+func (h *SignalingHandler) HandleGroupCallLeave(msg *nexy.NexyMessage) {
+	if msg.Header.ChatID == nil {
+		return
+	}
+	h.leaveGroupCall(context.Background(), *msg.Header.ChatID, msg.Header.SenderID, msg.SenderDevice())
+}
+
+// HandleGroupCallMedia updates the sender's muted and video flags
+func (h *SignalingHandler) HandleGroupCallMedia(msg *nexy.NexyMessage) {
+	if msg.Header.ChatID == nil {
+		return
+	}
+	chatID := *msg.Header.ChatID
+
+	var body nexy.GroupCallMediaBody
+	if err := msg.ParseBody(&body); err != nil {
+		log.Printf("Error parsing group call media: %v", err)
+		return
+	}
+
+	ctx := context.Background()
+	field := strconv.Itoa(msg.Header.SenderID)
+	raw, err := h.calls.redis.HGet(ctx, groupCallParticipantsKey(chatID), field).Result()
+	if err != nil {
+		return
+	}
+
+	var participant groupParticipant
+	if err := json.Unmarshal([]byte(raw), &participant); err != nil || participant.DeviceID != msg.SenderDevice() {
+		return
+	}
+	participant.Muted = body.Muted
+	participant.Video = body.Video
+
+	entry, _ := json.Marshal(participant)
+	if err := h.calls.redis.HSet(ctx, groupCallParticipantsKey(chatID), field, entry).Err(); err != nil {
+		log.Printf("Error updating group call media in chat %d: %v", chatID, err)
+		return
+	}
+
+	h.broadcastGroupCallState(ctx, chatID)
+}
+
+// leaveGroupCall removes the user from the room, ending the call when they
+// were the last one in it. An empty device removes whichever device joined.
+func (h *SignalingHandler) leaveGroupCall(ctx context.Context, chatID, userID int, device string) {
+	keys := []string{groupCallKey(chatID), groupCallParticipantsKey(chatID), activeCallKey(userID)}
+	result, err := leaveGroupCallScript.Run(ctx, h.calls.redis, keys, userID, device, groupActiveValue(chatID)).Slice()
+	if err != nil || len(result) == 0 {
+		if err != nil {
+			log.Printf("Error leaving group call in chat %d: %v", chatID, err)
+		}
+		return
+	}
+
+	switch status, _ := result[0].(int64); status {
+	case 0:
+		return
+	case 1:
+		log.Printf("User %d left the group call in chat %d", userID, chatID)
+		h.broadcastGroupCallState(ctx, chatID)
+		return
+	}
+
+	if len(result) < 6 {
+		return
+	}
+	callID, _ := result[1].(string)
+	log.Printf("Group call %s in chat %d ended", callID, chatID)
+
+	h.broadcastGroupCallEnded(chatID, callID)
+
+	now := time.Now()
+	record := &models.Call{
+		CallID:    callID,
+		ChatID:    &chatID,
+		Status:    models.CallStatusEnded,
+		StartedAt: parseUnix(stringAt(result, 3)),
+		EndedAt:   &now,
+	}
+	record.CallerID, _ = strconv.Atoi(stringAt(result, 2))
+	record.IsVideo, _ = strconv.ParseBool(stringAt(result, 5))
+	if answeredAt := parseUnix(stringAt(result, 4)); !answeredAt.IsZero() {
+		record.AnsweredAt = &answeredAt
+	}
+	h.persist(record)
+}
+
+// groupCallChat returns the chat whose group call the user is in, or 0
+func (h *SignalingHandler) groupCallChat(ctx context.Context, userID int) int {
+	active, err := h.calls.redis.Get(ctx, activeCallKey(userID)).Result()
+	if err != nil || !strings.HasPrefix(active, groupActivePrefix) {
+		return 0
+	}
+	chatID, _ := strconv.Atoi(strings.TrimPrefix(active, groupActivePrefix))
+	return chatID
+}
+
+// relayGroupFrame forwards a per-peer offer, answer or ICE candidate between
+// two participants of a group call. It reports false for frames that do not
+// belong to the chat's group call, which are then handled as 1:1 frames.
+func (h *SignalingHandler) relayGroupFrame(msg *nexy.NexyMessage, callID string) bool {
+	if msg.Header.ChatID == nil || msg.Header.RecipientID == nil || callID == "" {
+		return false
+	}
+	chatID := *msg.Header.ChatID
+
+	ctx := context.Background()
+	roomCallID, err := h.calls.redis.HGet(ctx, groupCallKey(chatID), "call_id").Result()
+	if err != nil || roomCallID != callID {
+		return false
+	}
+
+	participants := h.groupParticipants(ctx, chatID)
+	sender, ok := participants[msg.Header.SenderID]
+	if !ok || sender.DeviceID != msg.SenderDevice() {
+		return true
+	}
+	recipient, ok := participants[*msg.Header.RecipientID]
+	if !ok {
+		return true
+	}
+
+	h.hub.SendToDevices(*msg.Header.RecipientID, []string{recipient.DeviceID}, false, msg)
+	return true
+}
+
+func (h *SignalingHandler) groupParticipants(ctx context.Context, chatID int) map[int]groupParticipant {
+	values, err := h.calls.redis.HGetAll(ctx, groupCallParticipantsKey(chatID)).Result()
+	if err != nil {
+		log.Printf("Error loading group call participants in chat %d: %v", chatID, err)
+		return nil
+	}
+
+	participants := make(map[int]groupParticipant, len(values))
+	for field, raw := range values {
+		userID, err := strconv.Atoi(field)
+		if err != nil {
+			continue
+		}
+		var participant groupParticipant
+		if json.Unmarshal([]byte(raw), &participant) == nil {
+			participants[userID] = participant
+		}
+	}
+	return participants
+}
+
+// broadcastGroupCallState sends the room to every chat member, so members
+// outside the call can show it as joinable. Newcomers offer to every
+// participant already listed.
+func (h *SignalingHandler) broadcastGroupCallState(ctx context.Context, chatID int) {
+	callID, err := h.calls.redis.HGet(ctx, groupCallKey(chatID), "call_id").Result()
+	if err != nil {
+		return
+	}
+
+	state := nexy.GroupCallStateBody{
+		ChatID:       chatID,
+		CallID:       callID,
+		Active:       true,
+		Participants: []nexy.GroupCallParticipant{},
+	}
+	for userID, participant := range h.groupParticipants(ctx, chatID) {
+		state.Participants = append(state.Participants, nexy.GroupCallParticipant{
+			UserID:   userID,
+			Muted:    participant.Muted,
+			Video:    participant.Video,
+			JoinedAt: participant.JoinedAt,
+		})
+	}
+	sort.Slice(state.Participants, func(i, j int) bool {
+		return state.Participants[i].JoinedAt < state.Participants[j].JoinedAt
+	})
+
+	h.sendGroupCallState(chatID, state)
+}
+
+func (h *SignalingHandler) broadcastGroupCallEnded(chatID int, callID string) {
+	h.sendGroupCallState(chatID, nexy.GroupCallStateBody{
+		ChatID:       chatID,
+		CallID:       callID,
+		Participants: []nexy.GroupCallParticipant{},
+	})
+}
+
+func (h *SignalingHandler) sendGroupCallState(chatID int, state nexy.GroupCallStateBody) {
+	msg, err := nexy.NewNexyMessage(nexy.TypeGroupCallState, 0, &chatID, state)
+	if err != nil {
+		log.Printf("Error creating group call state: %v", err)
+		return
+	}
+	h.hub.BroadcastToChat(chatID, msg)
+}
+
+func stringAt(values []interface{}, i int) string {
+	s, _ := values[i].(string)
+	return s
+}
@@ -1,18 +1,135 @@
 package signaling
 
 import (
+	"context"
 	"encoding/json"
 	"log"
+	"strings"
+	"time"
 
+	"github.com/redis/go-redis/v9"
+	"github.com/vtstv/nexy/internal/models"
 	nexy "github.com/vtstv/nexy/internal/ws"
 )
 
+type SessionRepository interface {
+	GetByUserID(ctx context.Context, userID int) ([]models.UserSession, error)
+}
+
+type ChatRepository interface {
+	GetByID(ctx context.Context, id int) (*models.Chat, error)
+}
+
+// CallPushNotifier wakes offline callee devices through push notifications
+type CallPushNotifier interface {
+	SendIncomingCall(ctx context.Context, calleeID, callerID int, callID string, video bool, ttl time.Duration) error
+	SendCallCancelled(ctx context.Context, calleeID int, callID, reason string, ttl time.Duration) error
+}
+
+// CallRecorder persists calls once they reach a final state
+type CallRecorder interface {
+	RecordCall(ctx context.Context, call *models.Call) error
+}
+
+// SignalingHandler tracks each call from offer to hangup and routes its
+// frames to the devices taking part in it
 type SignalingHandler struct {
-	hub *nexy.Hub
+	hub      *nexy.Hub
+	calls    *callStore
+	sessions SessionRepository
+	chats    ChatRepository
+	recorder CallRecorder
+	push     CallPushNotifier
+}
+
+func NewSignalingHandler(hub *nexy.Hub, redisClient *redis.Client, sessions SessionRepository, chats ChatRepository) *SignalingHandler {
+	return &SignalingHandler{
+		hub:      hub,
+		calls:    &callStore{redis: redisClient},
+		sessions: sessions,
+		chats:    chats,
+	}
+}
+
+func (h *SignalingHandler) SetRecorder(recorder CallRecorder) {
+	h.recorder = recorder
+}
+
+func (h *SignalingHandler) SetPushNotifier(push CallPushNotifier) {
+	h.push = push
+}
+
+// HandleCallFrame implements nexy.CallHandler
+func (h *SignalingHandler) HandleCallFrame(msg *nexy.NexyMessage) {
+	switch msg.Header.Type {
+	case nexy.TypeCallOffer:
+		h.HandleCallOffer(msg)
+	case nexy.TypeCallAnswer:
+		h.HandleCallAnswer(msg)
+	case nexy.TypeICECandidate:
+		h.HandleICECandidate(msg)
+	case nexy.TypeCallCancel:
+		h.HandleCallCancel(msg)
+	case nexy.TypeCallEnd:
+		h.HandleCallEnd(msg)
+	case nexy.TypeCallBusy:
+		h.HandleCallBusy(msg)
+	case nexy.TypeGroupCallJoin:
+		h.HandleGroupCallJoin(msg)
+	case nexy.TypeGroupCallLeave:
+		h.HandleGroupCallLeave(msg)
+	case nexy.TypeGroupCallMedia:
+		h.HandleGroupCallMedia(msg)
+	}
+}
+
+// HandleConnect implements nexy.CallHandler. A device that connects while a
+// call to its user is still ringing, typically one woken by the incoming call
+// push, gets the pending offer and the caller's candidates so far.
+func (h *SignalingHandler) HandleConnect(userID int, deviceID string) {
+	ctx := context.Background()
+	callID, err := h.calls.redis.Get(ctx, activeCallKey(userID)).Result()
+	if err != nil || strings.HasPrefix(callID, groupActivePrefix) {
+		return
+	}
+
+	call := h.loadCall(ctx, callID)
+	if call == nil || call.State != CallRinging || call.CalleeID != userID {
+		return
+	}
+
+	declining, _, _ := h.callDevices(ctx, userID)
+	for _, declined := range declining {
+		if declined == deviceID {
+			return
+		}
+	}
+
+	offer, candidates, err := h.calls.pendingOffer(ctx, callID)
+	if err != nil {
+		return
+	}
+
+	frames := append([]string{string(offer)}, candidates...)
+	for _, frame := range frames {
+		var msg nexy.NexyMessage
+		if err := json.Unmarshal([]byte(frame), &msg); err != nil {
+			log.Printf("Error unmarshaling pending frame for call %s: %v", callID, err)
+			continue
+		}
+		h.hub.SendToDevices(userID, []string{deviceID}, false, &msg)
+	}
+
+	log.Printf("Delivered pending offer for call %s to user %d, deviceID=%s", callID, userID, deviceID)
 }
 
-func NewSignalingHandler(hub *nexy.Hub) *SignalingHandler {
-	return &SignalingHandler{hub: hub}
+// HandleDisconnect implements nexy.CallHandler. A closed socket leaves the
+// group call it was in; 1:1 calls survive it so the device can reconnect.
+func (h *SignalingHandler) HandleDisconnect(userID int, deviceID string) {
+	ctx := context.Background()
+	if chatID := h.groupCallChat(ctx, userID); chatID != 0 {
+		h.leaveGroupCall(ctx, chatID, userID, deviceID)
+	}
 }
 
 func (h *SignalingHandler) HandleCallOffer(msg *nexy.NexyMessage) {
@@ -21,11 +138,83 @@ func (h *SignalingHandler) HandleCallOffer(msg *nexy.NexyMessage) {
 		log.Printf("Error parsing call offer: %v", err)
 		return
 	}
+	if body.CallID == "" || msg.Header.RecipientID == nil || *msg.Header.RecipientID == msg.Header.SenderID {
+		return
+	}
+	if h.relayGroupFrame(msg, body.CallID) {
+		return
+	}
+
+	ctx := context.Background()
+	call := &Call{
+		ID:           body.CallID,
+		CallerID:     msg.Header.SenderID,
+		CalleeID:     *msg.Header.RecipientID,
+		CallerDevice: msg.SenderDevice(),
+		State:        CallRinging,
+		Video:        body.Video,
+		CreatedAt:    time.Now(),
+	}
+
+	log.Printf("Call offer from %d to %d: call_id=%s", call.CallerID, call.CalleeID, call.ID)
+
+	// Devices that turned calls off never ring
+	declining, available, err := h.callDevices(ctx, call.CalleeID)
+	if err != nil {
+		log.Printf("Error loading sessions for user %d: %v", call.CalleeID, err)
+	}
+	if !available {
+		h.rejectBusy(ctx, call, "unavailable")
+		return
+	}
+
+	offer, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error marshaling call offer: %v", err)
+		return
+	}
+
+	result, err := h.calls.create(ctx, call, offer)
+	if err != nil {
+		log.Printf("Error creating call %s: %v", call.ID, err)
+		return
+	}
+
+	switch result {
+	case createDuplicate:
+		// A retried offer needs nothing more. Call IDs come from clients, so
+		// the ID may also belong to someone else's call; that one is left
+		// alone and the caller has to pick another ID.
+		if existing := h.loadCall(ctx, call.ID); existing != nil && existing.CallerID != call.CallerID {
+			h.sendError(call.CallerID, call.CallerDevice, msg, "call_id_taken", "call ID is already in use")
+		}
+		return
+	case createCallerBusy:
+		h.rejectBusy(ctx, call, "already_in_call")
+		return
+	case createCalleeBusy:
+		h.rejectBusy(ctx, call, "busy")
+		return
+	}
+
+	h.hub.SendToDevices(call.CalleeID, declining, true, msg)
+	time.AfterFunc(ringTimeout, func() { h.expireRing(call) })
+
+	if h.push != nil && !h.hub.IsUserOnline(call.CalleeID) {
+		// Marked up front, so a call that ends while the push is still on its
+		// way gets its cancellation push too
+		h.calls.markPushed(ctx, call.ID)
+		go h.pushIncomingCall(call)
+	}
+}
 
-	log.Printf("Call offer from %d to %d: call_id=%s",
-		msg.Header.SenderID,
-		*msg.Header.RecipientID,
-		body.CallID)
+// pushIncomingCall wakes the callee's device. The push expires with the
+// ring, after which the offer is gone anyway.
+func (h *SignalingHandler) pushIncomingCall(call *Call) {
+	ctx := context.Background()
+	if err := h.push.SendIncomingCall(ctx, call.CalleeID, call.CallerID, call.ID, call.Video, ringTimeout); err != nil {
+		log.Printf("Error sending incoming call push for call %s: %v", call.ID, err)
+	}
 }
 
 func (h *SignalingHandler) HandleCallAnswer(msg *nexy.NexyMessage) {
@@ -34,10 +223,36 @@ func (h *SignalingHandler) HandleCallAnswer(msg *nexy.NexyMessage) {
 		log.Printf("Error parsing call answer: %v", err)
 		return
 	}
+	if h.relayGroupFrame(msg, body.CallID) {
+		return
+	}
+
+	log.Printf("Call answer from %d: call_id=%s", msg.Header.SenderID, body.CallID)
 
-	log.Printf("Call answer from %d: call_id=%s",
-		msg.Header.SenderID,
-		body.CallID)
+	ctx := context.Background()
+	call := h.loadCall(ctx, body.CallID)
+	if call == nil || call.CalleeID != msg.Header.SenderID || call.State != CallRinging {
+		h.cancelLateAnswer(msg, call, body.CallID)
+		return
+	}
+
+	device := msg.SenderDevice()
+	ok, err := h.calls.transition(ctx, call, CallAccepted,
+		"callee_device", device,
+		"answered_at", time.Now().Unix())
+	if err != nil {
+		log.Printf("Error accepting call %s: %v", call.ID, err)
+		return
+	}
+	if !ok {
+		h.cancelLateAnswer(msg, h.loadCall(ctx, body.CallID), body.CallID)
+		return
+	}
+	call.CalleeDevice = device
+
+	h.hub.SendToDevices(call.CallerID, []string{call.CallerDevice}, false, msg)
+	h.sendCallFrame(nexy.TypeCallCancel, call.CallerID, call.CalleeID,
+		[]string{device}, true, call.ID, "answered_elsewhere")
 }
 
 func (h *SignalingHandler) HandleICECandidate(msg *nexy.NexyMessage) {
@@ -46,47 +261,285 @@ func (h *SignalingHandler) HandleICECandidate(msg *nexy.NexyMessage) {
 		log.Printf("Error parsing ICE candidate: %v", err)
 		return
 	}
+	if h.relayGroupFrame(msg, body.CallID) {
+		return
+	}
 
-	log.Printf("ICE candidate from %d: call_id=%s",
-		msg.Header.SenderID,
-		body.CallID)
+	call := h.loadCall(context.Background(), body.CallID)
+	if call == nil || call.State.Terminal() {
+		return
+	}
+
+	switch msg.Header.SenderID {
+	case call.CallerID:
+		// Trickled candidates can arrive before an answer, so they go to
+		// every ringing device until one takes the call
+		if call.CalleeDevice != "" {
+			h.hub.SendToDevices(call.CalleeID, []string{call.CalleeDevice}, false, msg)
+		} else {
+			h.hub.SendToDevices(call.CalleeID, nil, true, msg)
+			if frame, err := json.Marshal(msg); err == nil {
+				h.calls.bufferCandidate(context.Background(), call.ID, frame)
+			}
+		}
+	case call.CalleeID:
+		if call.CalleeDevice == "" || call.CalleeDevice == msg.SenderDevice() {
+			h.hub.SendToDevices(call.CallerID, []string{call.CallerDevice}, false, msg)
+		}
+	}
 }
 
 func (h *SignalingHandler) HandleCallCancel(msg *nexy.NexyMessage) {
+	h.hangUp(msg, "")
+}
+
+func (h *SignalingHandler) HandleCallEnd(msg *nexy.NexyMessage) {
+	h.hangUp(msg, "")
+}
+
+// HandleCallBusy is sent by a callee device that cannot take the call, for
+// instance because it is on a cellular call
+func (h *SignalingHandler) HandleCallBusy(msg *nexy.NexyMessage) {
+	h.hangUp(msg, CallBusy)
+}
+
+// hangUp ends the call on behalf of the sender. The resulting state depends
+// on who hung up and whether the call had been answered.
+func (h *SignalingHandler) hangUp(msg *nexy.NexyMessage, state CallState) {
 	var body nexy.CallCancelBody
 	if err := msg.ParseBody(&body); err != nil {
-		log.Printf("Error parsing call cancel: %v", err)
+		log.Printf("Error parsing %s: %v", msg.Header.Type, err)
+		return
+	}
+
+	ctx := context.Background()
+
+	// Hanging up in a group call only takes the sender out of the room
+	if msg.Header.ChatID != nil && h.groupCallChat(ctx, msg.Header.SenderID) == *msg.Header.ChatID {
+		h.leaveGroupCall(ctx, *msg.Header.ChatID, msg.Header.SenderID, msg.SenderDevice())
+		return
+	}
+
+	call := h.loadCall(ctx, body.CallID)
+	if call == nil || call.State.Terminal() {
+		return
+	}
+
+	senderID := msg.Header.SenderID
+	isCaller := senderID == call.CallerID
+	if !isCaller && senderID != call.CalleeID {
+		return
+	}
+
+	reason := body.Reason
+	if state == "" {
+		switch {
+		case call.State == CallAccepted:
+			state = CallEnded
+		case isCaller:
+			state = CallMissed
+		default:
+			state = CallEnded
+			reason = "declined"
+		}
+	}
+	if reason == "" {
+		reason = string(state)
+	}
+
+	log.Printf("Call %s by %d: call_id=%s, reason=%s", state, senderID, call.ID, reason)
+
+	wasRinging := call.State == CallRinging
+	if !h.finish(ctx, call, state, reason) {
 		return
 	}
 
-	log.Printf("Call cancelled by %d: call_id=%s, reason=%s",
-		msg.Header.SenderID,
-		body.CallID,
-		body.Reason)
+	frameType := msg.Header.Type
+	if state == CallBusy {
+		frameType = nexy.TypeCallBusy
+	}
+
+	if isCaller {
+		if wasRinging {
+			h.sendCallFrame(frameType, call.CallerID, call.CalleeID, nil, true, call.ID, reason)
+		} else {
+			h.sendCallFrame(frameType, call.CallerID, call.CalleeID, []string{call.CalleeDevice}, false, call.ID, reason)
+		}
+		return
+	}
+
+	h.sendCallFrame(frameType, call.CalleeID, call.CallerID, []string{call.CallerDevice}, false, call.ID, reason)
+	if wasRinging {
+		// Stop the ring on the callee's other devices as well
+		h.sendCallFrame(nexy.TypeCallCancel, call.CallerID, call.CalleeID,
+			[]string{msg.SenderDevice()}, true, call.ID, reason)
+	}
 }
 
-func (h *SignalingHandler) HandleCallEnd(msg *nexy.NexyMessage) {
-	var body nexy.CallCancelBody
-	if err := msg.ParseBody(&body); err != nil {
-		log.Printf("Error parsing call end: %v", err)
+// HandleHeartbeat implements nexy.CallHandler. The timer expireRing runs on
+// dies with its node, so every node also times out the rings that are past
+// their deadline in Redis.
+func (h *SignalingHandler) HandleHeartbeat() {
+	ctx := context.Background()
+	callIDs, err := h.calls.overdueRinging(ctx, time.Now())
+	if err != nil {
+		log.Printf("Error listing overdue ringing calls: %v", err)
 		return
 	}
 
-	log.Printf("Call ended by %d: call_id=%s",
-		msg.Header.SenderID,
-		body.CallID)
+	for _, callID := range callIDs {
+		call := h.loadCall(ctx, callID)
+		if call == nil || call.State != CallRinging {
+			// Gone, or moved on without its deadline being cleared
+			h.calls.redis.ZRem(ctx, ringingCallsKey, callID)
+			continue
+		}
+		h.expireRing(call)
+	}
 }
 
-func (h *SignalingHandler) HandleCallBusy(msg *nexy.NexyMessage) {
-	var body nexy.CallCancelBody
-	if err := msg.ParseBody(&body); err != nil {
-		log.Printf("Error parsing call busy: %v", err)
+// expireRing times out a call nobody answered. Of the timer and the
+// heartbeat sweep, only the first to get here finishes the call.
+func (h *SignalingHandler) expireRing(call *Call) {
+	if !h.finish(context.Background(), call, CallTimeout, string(CallTimeout)) {
+		return
+	}
+
+	log.Printf("Call %s timed out", call.ID)
+
+	reason := string(CallTimeout)
+	h.sendCallFrame(nexy.TypeCallCancel, call.CalleeID, call.CallerID, []string{call.CallerDevice}, false, call.ID, reason)
+	h.sendCallFrame(nexy.TypeCallCancel, call.CallerID, call.CalleeID, nil, true, call.ID, reason)
+}
+
+// finish moves the call into a final state and persists it. It reports false
+// if the call had already changed state.
+func (h *SignalingHandler) finish(ctx context.Context, call *Call, state CallState, reason string) bool {
+	now := time.Now()
+	wasRinging := call.State == CallRinging
+	ok, err := h.calls.transition(ctx, call, state,
+		"reason", reason,
+		"ended_at", now.Unix())
+	if err != nil {
+		log.Printf("Error ending call %s: %v", call.ID, err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+
+	call.Reason = reason
+	call.EndedAt = &now
+	h.persist(call.toModel())
+
+	// A device showing the call from a push has no socket to hear the hangup on
+	if wasRinging && h.push != nil && h.calls.wasPushed(ctx, call.ID) {
+		go func() {
+			if err := h.push.SendCallCancelled(context.Background(), call.CalleeID, call.ID, reason, ringTimeout); err != nil {
+				log.Printf("Error sending call cancelled push for call %s: %v", call.ID, err)
+			}
+		}()
+	}
+	return true
+}
+
+// persist hands a finished call to the recorder off the dispatch path
+func (h *SignalingHandler) persist(record *models.Call) {
+	if h.recorder == nil {
 		return
 	}
 
-	log.Printf("Call busy from %d: call_id=%s",
-		msg.Header.SenderID,
-		body.CallID)
+	go func() {
+		if err := h.recorder.RecordCall(context.Background(), record); err != nil {
+			log.Printf("Error recording call %s: %v", record.CallID, err)
+		}
+	}()
+}
+
+// sendError reports a rejected frame to the device that sent it
+func (h *SignalingHandler) sendError(userID int, deviceID string, msg *nexy.NexyMessage, code, message string) {
+	errorMsg, err := nexy.NewNexyMessage(nexy.TypeError, 0, nil, nexy.ErrorBody{
+		Code:      code,
+		Message:   message,
+		MessageID: msg.Header.MessageID,
+	})
+	if err != nil {
+		return
+	}
+	h.hub.SendToDevices(userID, []string{deviceID}, false, errorMsg)
+}
+
+// rejectBusy records a call that could not ring and tells the caller why
+func (h *SignalingHandler) rejectBusy(ctx context.Context, call *Call, reason string) {
+	now := time.Now()
+	call.State = CallBusy
+	call.Reason = reason
+	call.EndedAt = &now
+
+	if err := h.calls.record(ctx, call); err != nil {
+		log.Printf("Error recording busy call %s: %v", call.ID, err)
+	}
+	h.persist(call.toModel())
+
+	h.sendCallFrame(nexy.TypeCallBusy, call.CalleeID, call.CallerID, []string{call.CallerDevice}, false, call.ID, reason)
+}
+
+// cancelLateAnswer stops a device that answered a call it can no longer take
+func (h *SignalingHandler) cancelLateAnswer(msg *nexy.NexyMessage, call *Call, callID string) {
+	reason := "ended"
+	if call != nil && call.State == CallAccepted {
+		reason = "answered_elsewhere"
+	}
+	peerID := 0
+	if call != nil {
+		peerID = call.CallerID
+	}
+	h.sendCallFrame(nexy.TypeCallCancel, peerID, msg.Header.SenderID,
+		[]string{msg.SenderDevice()}, false, callID, reason)
+}
+
+// callDevices lists the user's devices that refuse calls and whether any
+// device may ring at all. Users without known sessions are rung anyway.
+func (h *SignalingHandler) callDevices(ctx context.Context, userID int) ([]string, bool, error) {
+	sessions, err := h.sessions.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, true, err
+	}
+
+	var declining []string
+	for _, session := range sessions {
+		if !session.AcceptCalls {
+			declining = append(declining, session.DeviceID)
+		}
+	}
+	return declining, len(sessions) == 0 || len(declining) < len(sessions), nil
+}
+
+func (h *SignalingHandler) loadCall(ctx context.Context, callID string) *Call {
+	if callID == "" {
+		return nil
+	}
+	call, err := h.calls.get(ctx, callID)
+	if err != nil {
+		log.Printf("Error loading call %s: %v", callID, err)
+		return nil
+	}
+	return call
+}
+
+// sendCallFrame sends a server-generated call frame to some of the
+// recipient's devices, see Hub.SendToDevices
+func (h *SignalingHandler) sendCallFrame(msgType nexy.MessageType, senderID, recipientID int, deviceIDs []string, exclude bool, callID, reason string) {
+	msg, err := nexy.NewNexyMessage(msgType, senderID, nil, nexy.CallCancelBody{
+		CallID: callID,
+		Reason: reason,
+	})
+	if err != nil {
+		log.Printf("Error creating %s: %v", msgType, err)
+		return
+	}
+	msg.Header.RecipientID = &recipientID
+	h.hub.SendToDevices(recipientID, deviceIDs, exclude, msg)
 }
 
 func (h *SignalingHandler) CreateCallOffer(senderID, recipientID int, callID, sdp string, video, audio bool) ([]byte, error) {
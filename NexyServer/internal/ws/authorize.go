@@ -0,0 +1,172 @@
+package nexy
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// ChatAuthorizer applies the same chat access rules used by the REST API
+type ChatAuthorizer interface {
+	Authorize(ctx context.Context, chatID, userID int, action models.ChatAction) error
+}
+
+func (h *Hub) SetAuthorizer(authorizer ChatAuthorizer) {
+	h.authorizer = authorizer
+}
+
+// authorizeFrame checks an inbound frame against the sender's rights in the
+// target chat and reports the rejection back to the sender
+func (h *Hub) authorizeFrame(message *NexyMessage) bool {
+	if h.authorizer == nil {
+		return true
+	}
+
+	ctx := context.Background()
+	senderID := message.Header.SenderID
+
+	chatID, action, err := h.frameTarget(ctx, message)
+	if err == nil && chatID != 0 {
+		err = h.authorizer.Authorize(ctx, chatID, senderID, action)
+	}
+	if err == nil {
+		return true
+	}
+
+	log.Printf("Rejected %s frame from user %d: chatID=%d, err=%v", message.Header.Type, senderID, chatID, err)
+
+	// A refused chat_message is answered by its ack alone
+	if message.Header.Type == TypeChatMessage {
+		h.sendToUser(senderID, errorAck(message.Header.MessageID, err), h.unregisterClientFunc)
+		return false
+	}
+
+	h.sendFrameError(message, err, "internal_error", nil)
+	return false
+}
+
+// frameTarget resolves the chat a frame acts on and the action it needs.
+// A zero chat ID means the frame does not target an existing chat.
+func (h *Hub) frameTarget(ctx context.Context, message *NexyMessage) (int, models.ChatAction, error) {
+	switch message.Header.Type {
+	case TypeChatMessage:
+		// Malformed bodies are refused once the sender is known to be allowed
+		action := models.ChatActionSendMessages
+		var body ChatMessageBody
+		if err := json.Unmarshal(message.Body, &body); err == nil {
+			if spec, ok := models.LookupMessageType(body.MessageType); ok {
+				action = spec.Action
+			}
+		}
+		if message.Header.ChatID != nil {
+			return *message.Header.ChatID, action, nil
+		}
+		// A first private message creates the chat, so only an existing one is checked
+		if message.Header.RecipientID != nil {
+			chat, err := h.chatRepo.GetPrivateChatBetween(ctx, message.Header.SenderID, *message.Header.RecipientID)
+			if err != nil {
+				return 0, action, err
+			}
+			if chat != nil {
+				return chat.ID, action, nil
+			}
+		}
+		return 0, action, nil
+
+	case TypeEdit:
+		var body EditMessageBody
+		if err := json.Unmarshal(message.Body, &body); err != nil {
+			return 0, models.ChatActionSendMessages, nil
+		}
+		dbMsg, err := h.messageRepo.GetByUUID(ctx, body.MessageID)
+		if err != nil || dbMsg == nil {
+			return 0, models.ChatActionSendMessages, nil
+		}
+		return dbMsg.ChatID, models.ChatActionSendMessages, nil
+
+	case TypeTyping:
+		var body TypingBody
+		if err := json.Unmarshal(message.Body, &body); err != nil {
+			return 0, models.ChatActionParticipate, nil
+		}
+		return body.ChatID, models.ChatActionParticipate, nil
+
+	case TypeDelivered, TypeRead:
+		chatID, err := h.receiptTarget(ctx, message)
+		return chatID, models.ChatActionParticipate, err
+
+	case TypeCallOffer, TypeCallAnswer, TypeICECandidate, TypeCallCancel, TypeCallEnd, TypeCallBusy:
+		if message.Header.ChatID != nil {
+			return *message.Header.ChatID, models.ChatActionParticipate, nil
+		}
+		if message.Header.RecipientID == nil {
+			return 0, models.ChatActionParticipate, nil
+		}
+		chat, err := h.chatRepo.GetPrivateChatBetween(ctx, message.Header.SenderID, *message.Header.RecipientID)
+		if err != nil {
+			return 0, models.ChatActionParticipate, err
+		}
+		if chat == nil {
+			return 0, models.ChatActionParticipate, errNoSharedChat
+		}
+		return chat.ID, models.ChatActionParticipate, nil
+
+	case TypeGroupCallJoin, TypeGroupCallLeave, TypeGroupCallMedia:
+		if message.Header.ChatID != nil {
+			return *message.Header.ChatID, models.ChatActionParticipate, nil
+		}
+		return 0, models.ChatActionParticipate, nil
+	}
+
+	return 0, models.ChatActionView, nil
+}
+
+// receiptTarget resolves the chat a receipt is about. A receipt is relayed to
+// its recipient, so the recipient has to be a member of that chat too.
+func (h *Hub) receiptTarget(ctx context.Context, message *NexyMessage) (int, error) {
+	var chatID int
+	switch {
+	case message.Header.ChatID != nil:
+		chatID = *message.Header.ChatID
+	case message.Header.RecipientID != nil:
+		chat, err := h.chatRepo.GetPrivateChatBetween(ctx, message.Header.SenderID, *message.Header.RecipientID)
+		if err != nil {
+			return 0, err
+		}
+		if chat == nil {
+			return 0, errNoSharedChat
+		}
+		chatID = chat.ID
+	default:
+		return 0, errNoReceiptChat
+	}
+
+	if message.Header.RecipientID != nil {
+		isMember, err := h.chatRepo.IsMember(ctx, chatID, *message.Header.RecipientID)
+		if err != nil {
+			return chatID, err
+		}
+		if !isMember {
+			return chatID, errRecipientNotMember
+		}
+	}
+	return chatID, nil
+}
+
+type frameError struct {
+	code    string
+	message string
+}
+
+func (e *frameError) Error() string     { return e.message }
+func (e *frameError) ErrorCode() string { return e.code }
+
+var errNoSharedChat = &frameError{code: "not_member", message: "no chat with this user"}
+
+var errNoReceiptChat = &frameError{code: "invalid_frame", message: "receipt has no chat or recipient"}
+
+var errRecipientNotMember = &frameError{code: "not_member", message: "recipient is not a member of this chat"}
+
+var errVoiceDisabled = &frameError{code: "voice_disabled", message: "Voice messages are disabled by the recipient"}
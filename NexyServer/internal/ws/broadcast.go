@@ -4,14 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+
+	"github.com/vtstv/nexy/internal/models"
 )
 
 func (h *Hub) sendToUser(userID int, message *NexyMessage, unregisterFunc func(*Client)) {
-	h.mu.RLock()
-	clients, ok := h.clients[userID]
-	h.mu.RUnlock()
+	offline := h.deliver([]int{userID}, message, unregisterFunc)
 
-	if !ok || len(clients) == 0 {
+	if len(offline) > 0 {
 		log.Printf("User %d not connected, will send FCM notification", userID)
 
 		// Send FCM notification for chat messages when user is offline
@@ -19,30 +19,75 @@ func (h *Hub) sendToUser(userID int, message *NexyMessage, unregisterFunc func(*
 		if message.Header.Type == TypeChatMessage && userID != message.Header.SenderID {
 			go h.sendFcmForMessage(userID, message)
 		}
-		return
 	}
+}
 
-	data, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("Error marshaling message: %v", err)
-		return
+// deliver sends a message to every device of the given users on any node
+// and returns the users that have no live socket anywhere in the cluster
+func (h *Hub) deliver(userIDs []int, message *NexyMessage, unregisterFunc func(*Client)) []int {
+	// Every sequenced frame gets a place in the stream of each of the
+	// recipient's devices, even those not connected right now
+	seqs := h.appendToStreams(userIDs, message)
+
+	// A user may have devices on several nodes, so look up remote nodes for everyone
+	remote := h.remoteNodes(userIDs)
+	h.publishToNodes(remote, envelopeDeliver, message, seqs)
+
+	var offline []int
+	for _, userID := range userIDs {
+		if !h.sendLocal(userID, message, seqs[userID], unregisterFunc) && len(remote[userID]) == 0 {
+			offline = append(offline, userID)
+		}
+	}
+	return offline
+}
+
+// sendLocal writes the message to the user's sockets on this node, stamped
+// with each device's sequence, and reports whether any exist
+func (h *Hub) sendLocal(userID int, message *NexyMessage, seqs map[string]int64, unregisterFunc func(*Client)) bool {
+	h.mu.RLock()
+	clients, ok := h.clients[userID]
+	h.mu.RUnlock()
+
+	if !ok || len(clients) == 0 {
+		return false
 	}
 
 	// Send to all connections for this user
 	for _, client := range clients {
-		select {
-		case client.send <- data:
-			log.Printf("Message sent to user %d, deviceID=%s", userID, client.deviceID)
-		default:
+		seq := seqs[client.deviceID]
+		data, err := marshalWithSeq(message, seq)
+		if err != nil {
+			log.Printf("Error marshaling message: %v", err)
+			continue
+		}
+		frame := client.adapt(message, seq, data)
+		if frame == nil {
+			log.Printf("Omitting %s frame for user %d, deviceID=%s: not supported by client", message.Header.Type, userID, client.deviceID)
+			continue
+		}
+
+		if client.queue(seq, frame) {
+			log.Printf("Message sent to user %d, deviceID=%s, seq=%d", userID, client.deviceID, seq)
+		} else {
 			log.Printf("Send channel full for user %d, deviceID=%s, unregistering", userID, client.deviceID)
 			if unregisterFunc != nil {
 				go unregisterFunc(client)
 			}
 		}
 	}
+	return true
 }
 
 func (h *Hub) broadcastToAll(message *NexyMessage, unregisterFunc func(*Client)) {
+	h.broadcastLocal(message, unregisterFunc)
+	h.publish(clusterBroadcastChannel, &clusterEnvelope{
+		Kind:    envelopeBroadcast,
+		Message: message,
+	})
+}
+
+func (h *Hub) broadcastLocal(message *NexyMessage, unregisterFunc func(*Client)) {
 	data, err := json.Marshal(message)
 	if err != nil {
 		log.Printf("Error marshaling broadcast message: %v", err)
@@ -57,12 +102,12 @@ func (h *Hub) broadcastToAll(message *NexyMessage, unregisterFunc func(*Client))
 	h.mu.RUnlock()
 
 	for _, client := range allClients {
-		select {
-		case client.send <- data:
-		default:
-			if unregisterFunc != nil {
-				go unregisterFunc(client)
-			}
+		frame := client.adapt(message, 0, data)
+		if frame == nil {
+			continue
+		}
+		if !client.queue(0, frame) && unregisterFunc != nil {
+			go unregisterFunc(client)
 		}
 	}
 }
@@ -82,38 +127,21 @@ func (h *Hub) broadcastToChatMembers(chatID int, message *NexyMessage) {
 		return
 	}
 
-	data, _ := json.Marshal(message)
-
-	h.mu.RLock()
-	onlineClients := make(map[int][]*Client)
-	for id, clients := range h.clients {
-		onlineClients[id] = clients
-	}
-	h.mu.RUnlock()
-
+	// Skip the sender - they don't need notification for their own message
+	recipients := make([]int, 0, len(memberIDs))
 	for _, memberID := range memberIDs {
-		// Skip the sender - they don't need notification for their own message
-		if memberID == message.Header.SenderID {
-			continue
+		if memberID != message.Header.SenderID {
+			recipients = append(recipients, memberID)
 		}
+	}
 
-		if clients, ok := onlineClients[memberID]; ok && len(clients) > 0 {
-			// Member is online, send via WebSocket to all their devices
-			for _, client := range clients {
-				select {
-				case client.send <- data:
-				default:
-					go func(c *Client) {
-						h.unregister <- c
-					}(client)
-				}
-			}
-		} else {
-			// Member is offline, send FCM notification
-			if message.Header.Type == TypeChatMessage {
-				log.Printf("Member %d is offline, sending FCM notification", memberID)
-				go h.sendFcmForMessage(memberID, message)
-			}
+	offline := h.deliver(recipients, message, h.unregisterClientFunc)
+
+	// Members with no socket on any node get an FCM notification
+	if message.Header.Type == TypeChatMessage {
+		for _, memberID := range offline {
+			log.Printf("Member %d is offline, sending FCM notification", memberID)
+			go h.sendFcmForMessage(memberID, message)
 		}
 	}
 }
@@ -134,6 +162,13 @@ func (h *Hub) sendFcmForMessage(userID int, message *NexyMessage) {
 		return
 	}
 
+	// Muting a chat silences everything but mentions of the user
+	mentioned := mentionsUser(&messageBody, userID)
+	if !mentioned && message.Header.ChatID != nil && h.chatMuted(ctx, *message.Header.ChatID, userID) {
+		log.Printf("Chat muted by user %d, skipping FCM notification", userID)
+		return
+	}
+
 	// Get sender info
 	sender, err := h.userRepo.GetByID(ctx, message.Header.SenderID)
 	if err != nil {
@@ -148,9 +183,10 @@ func (h *Hub) sendFcmForMessage(userID int, message *NexyMessage) {
 	}
 
 	notifBody := messageBody.Content
-	if messageBody.MessageType == "media" || messageBody.MessageType == "file" {
-		notifBody = "Sent a " + messageBody.MessageType
-	} else if len(notifBody) > 100 {
+	if spec, ok := models.LookupMessageType(messageBody.MessageType); ok {
+		notifBody = spec.NotificationPreview(notifBody)
+	}
+	if len(notifBody) > 100 {
 		notifBody = notifBody[:100] + "..."
 	}
 
@@ -160,6 +196,10 @@ func (h *Hub) sendFcmForMessage(userID int, message *NexyMessage) {
 		"message_id": message.Header.MessageID,
 	}
 
+	if mentioned {
+		data["mentioned"] = "true"
+	}
+
 	if message.Header.ChatID != nil {
 		data["chat_id"] = string(rune(*message.Header.ChatID))
 	}
@@ -0,0 +1,69 @@
+package nexy
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// CallHandler owns the lifecycle of calls. When set, call_*, ice_candidate
+// and group_call_* frames go to it instead of being forwarded as-is.
+type CallHandler interface {
+	HandleCallFrame(message *NexyMessage)
+	// HandleConnect is called whenever the user opens a socket on this node
+	HandleConnect(userID int, deviceID string)
+	// HandleDisconnect is called whenever one of the user's sockets on this node closes
+	HandleDisconnect(userID int, deviceID string)
+	// HandleHeartbeat is called on every node heartbeat, for work that must
+	// go on when the node that started it died
+	HandleHeartbeat()
+}
+
+func (h *Hub) SetCallHandler(calls CallHandler) {
+	h.calls = calls
+}
+
+// SendToDevices writes a message to some of the user's devices on every node.
+// With exclude set it goes to every device except the listed ones.
+func (h *Hub) SendToDevices(userID int, deviceIDs []string, exclude bool, message *NexyMessage) {
+	h.sendToDevicesLocal(userID, deviceIDs, exclude, message)
+
+	nodes := h.remoteNodes([]int{userID})
+	for _, nodeID := range nodes[userID] {
+		h.publish(nodeChannel(nodeID), &clusterEnvelope{
+			Kind:      envelopeDevices,
+			UserIDs:   []int{userID},
+			DeviceIDs: deviceIDs,
+			Exclude:   exclude,
+			Message:   message,
+		})
+	}
+}
+
+func (h *Hub) sendToDevicesLocal(userID int, deviceIDs []string, exclude bool, message *NexyMessage) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Error marshaling device message: %v", err)
+		return
+	}
+
+	h.mu.RLock()
+	clients := h.clients[userID]
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		listed := false
+		for _, deviceID := range deviceIDs {
+			if client.deviceID == deviceID {
+				listed = true
+				break
+			}
+		}
+		if listed == exclude {
+			continue
+		}
+
+		if frame := client.adapt(message, 0, data); frame != nil {
+			client.queue(0, frame)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package nexy
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// MinProtocolVersion is the oldest protocol the server still speaks
+const MinProtocolVersion = "1.0"
+
+// Capability is an optional protocol feature a client declares in its hello
+type Capability string
+
+const (
+	CapReactions Capability = "reactions"
+	CapResumable Capability = "resumable"
+	CapGroupCall Capability = "group_calls"
+	CapPins      Capability = "pins"
+	CapThreads   Capability = "threads"
+	CapPolls     Capability = "polls"
+
+	CapLiveLocations Capability = "live_locations"
+	CapRichPresence  Capability = "rich_presence"
+)
+
+// serverCapabilities lists every feature this server can offer
+var serverCapabilities = []Capability{CapReactions, CapResumable, CapGroupCall, CapPins, CapThreads, CapPolls, CapLiveLocations, CapRichPresence}
+
+// legacyCapabilities is what clients that never send a hello already handled
+// before the handshake existed
+var legacyCapabilities = []Capability{CapReactions}
+
+// frameRequirement gates an outbound frame on a client capability. When the
+// client lacks it, downgrade may rewrite the frame; a nil downgrade (or a nil
+// result) omits it.
+type frameRequirement struct {
+	capability Capability
+	downgrade  func(*NexyMessage) *NexyMessage
+}
+
+var frameRequirements = map[MessageType]frameRequirement{
+	TypeReactionAdd:     {capability: CapReactions},
+	TypeReactionRemove:  {capability: CapReactions},
+	TypeResumed:         {capability: CapResumable},
+	TypeResyncRequired:  {capability: CapResumable},
+	TypeGroupCallState:  {capability: CapGroupCall},
+	TypeMessagePinned:   {capability: CapPins},
+	TypeMessageUnpinned: {capability: CapPins},
+	TypeThreadUpdate:    {capability: CapThreads},
+	TypePollUpdate:      {capability: CapPolls},
+	TypeLocationUpdate:  {capability: CapLiveLocations},
+	TypeOnline:          {capability: CapRichPresence, downgrade: withoutRichPresence},
+	TypeOffline:         {capability: CapRichPresence, downgrade: withoutRichPresence},
+	TypePresence:        {capability: CapRichPresence, downgrade: withoutRichPresence},
+}
+
+// messageTypeRequirements gates chat messages on the message type in their
+// body. Clients without the capability get the message as text.
+var messageTypeRequirements = map[string]frameRequirement{
+	"poll":     {capability: CapPolls, downgrade: asTextMessage},
+	"location": {capability: CapLiveLocations, downgrade: asTextMessage},
+}
+
+// requirement returns what a client needs to get the frame as it is
+func (m *NexyMessage) requirement() (frameRequirement, bool) {
+	if m.Header.Type == TypeChatMessage {
+		var body struct {
+			MessageType string `json:"message_type"`
+		}
+		if err := json.Unmarshal(m.Body, &body); err != nil {
+			return frameRequirement{}, false
+		}
+		requirement, ok := messageTypeRequirements[body.MessageType]
+		return requirement, ok
+	}
+	requirement, ok := frameRequirements[m.Header.Type]
+	return requirement, ok
+}
+
+// withBody copies the frame with another body
+func (m *NexyMessage) withBody(body interface{}) *NexyMessage {
+	data, err := json.Marshal(body)
+	if err != nil {
+		log.Printf("Error marshaling downgraded %s body: %v", m.Header.Type, err)
+		return nil
+	}
+	downgraded := *m
+	downgraded.Body = data
+	return &downgraded
+}
+
+// withoutRichPresence leaves out the presence state and custom status, which
+// older clients do not know
+func withoutRichPresence(message *NexyMessage) *NexyMessage {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(message.Body, &body); err != nil {
+		return nil
+	}
+	delete(body, "state")
+	delete(body, "custom_status")
+	return message.withBody(body)
+}
+
+// asTextMessage turns a message of a type the client does not know into a
+// text message showing its preview
+func asTextMessage(message *NexyMessage) *NexyMessage {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(message.Body, &body); err != nil {
+		return nil
+	}
+
+	var messageType, content string
+	json.Unmarshal(body["message_type"], &messageType)
+	json.Unmarshal(body["content"], &content)
+
+	text := content
+	if spec, ok := models.LookupMessageType(messageType); ok {
+		text = spec.NotificationPreview(content)
+	}
+	// Mention offsets only fit the original content
+	if text != content {
+		delete(body, "mentions")
+	}
+
+	body["message_type"], _ = json.Marshal("text")
+	body["content"], _ = json.Marshal(text)
+	delete(body, "poll")
+	delete(body, "location")
+	return message.withBody(body)
+}
+
+// parseVersion splits "major.minor"; a missing minor counts as 0
+func parseVersion(version string) (int, int, bool) {
+	majorStr, minorStr, _ := strings.Cut(version, ".")
+	major, err := strconv.Atoi(majorStr)
+	if err != nil {
+		return 0, 0, false
+	}
+	minor := 0
+	if minorStr != "" {
+		if minor, err = strconv.Atoi(minorStr); err != nil {
+			return 0, 0, false
+		}
+	}
+	return major, minor, true
+}
+
+// compareVersions returns -1, 0 or 1; unparsable versions sort lowest
+func compareVersions(a, b string) int {
+	aMajor, aMinor, aOK := parseVersion(a)
+	bMajor, bMinor, bOK := parseVersion(b)
+	switch {
+	case !aOK && !bOK:
+		return 0
+	case !aOK:
+		return -1
+	case !bOK:
+		return 1
+	case aMajor != bMajor:
+		if aMajor < bMajor {
+			return -1
+		}
+		return 1
+	case aMinor != bMinor:
+		if aMinor < bMinor {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// negotiateVersion picks the highest version both sides speak
+func negotiateVersion(clientVersion string) (string, bool) {
+	if compareVersions(clientVersion, MinProtocolVersion) < 0 {
+		return "", false
+	}
+	if compareVersions(clientVersion, ProtocolVersion) > 0 {
+		return ProtocolVersion, true
+	}
+	return clientVersion, true
+}
+
+// handleHello agrees on a version and capability set with the client
+func (c *Client) handleHello(msg *NexyMessage) {
+	var hello HelloBody
+	if err := json.Unmarshal(msg.Body, &hello); err != nil {
+		log.Printf("Error unmarshaling hello from user %d: %v", c.userID, err)
+		return
+	}
+
+	version, ok := negotiateVersion(hello.Version)
+	if !ok {
+		log.Printf("User %d, deviceID=%s offered unsupported protocol version %q", c.userID, c.deviceID, hello.Version)
+		errorMsg, _ := NewNexyMessage(TypeError, 0, nil, ErrorBody{
+			Code:      "unsupported_version",
+			Message:   "protocol version " + hello.Version + " is not supported, minimum is " + MinProtocolVersion,
+			MessageID: msg.Header.MessageID,
+		})
+		if data, err := json.Marshal(errorMsg); err == nil {
+			c.queue(0, data)
+		}
+		return
+	}
+
+	offered := make(map[Capability]bool, len(hello.Capabilities))
+	for _, capability := range hello.Capabilities {
+		offered[capability] = true
+	}
+
+	agreed := make(map[Capability]bool)
+	agreedList := []Capability{}
+	for _, capability := range serverCapabilities {
+		if offered[capability] {
+			agreed[capability] = true
+			agreedList = append(agreedList, capability)
+		}
+	}
+
+	c.capMu.Lock()
+	c.capabilities = agreed
+	c.capMu.Unlock()
+
+	log.Printf("Handshake with user %d, deviceID=%s: version=%s, capabilities=%v", c.userID, c.deviceID, version, agreedList)
+
+	welcome, _ := NewNexyMessage(TypeWelcome, 0, nil, WelcomeBody{
+		Version:       version,
+		ServerVersion: ProtocolVersion,
+		MinVersion:    MinProtocolVersion,
+		Capabilities:  agreedList,
+	})
+	if data, err := json.Marshal(welcome); err == nil {
+		c.queue(0, data)
+	}
+}
+
+func (c *Client) hasCapability(capability Capability) bool {
+	c.capMu.RLock()
+	defer c.capMu.RUnlock()
+	return c.capabilities[capability]
+}
+
+// adapt returns the frame as this client should receive it: unchanged,
+// downgraded, or nil when the client cannot handle it at all
+func (c *Client) adapt(message *NexyMessage, seq int64, data []byte) []byte {
+	requirement, gated := message.requirement()
+	if !gated || c.hasCapability(requirement.capability) {
+		return data
+	}
+
+	if requirement.downgrade == nil {
+		return nil
+	}
+	downgraded := requirement.downgrade(message)
+	if downgraded == nil {
+		return nil
+	}
+
+	adapted, err := marshalWithSeq(downgraded, seq)
+	if err != nil {
+		log.Printf("Error marshaling downgraded %s frame: %v", message.Header.Type, err)
+		return nil
+	}
+	return adapted
+}
@@ -0,0 +1,70 @@
+package nexy
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func adaptedBody(t *testing.T, c *Client, message *NexyMessage) map[string]json.RawMessage {
+	t.Helper()
+	data, _ := json.Marshal(message)
+	frame := c.adapt(message, 7, data)
+	if frame == nil {
+		t.Fatalf("%s frame was omitted", message.Header.Type)
+	}
+
+	var adapted NexyMessage
+	if err := json.Unmarshal(frame, &adapted); err != nil {
+		t.Fatalf("adapted frame is not valid JSON: %v", err)
+	}
+	if adapted.Header.Seq != 7 {
+		t.Errorf("adapted frame seq = %d, want 7", adapted.Header.Seq)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(adapted.Body, &body); err != nil {
+		t.Fatalf("adapted body is not an object: %v", err)
+	}
+	return body
+}
+
+func TestLegacyClientGetsPollAsText(t *testing.T) {
+	legacy := &Client{capabilities: map[Capability]bool{CapReactions: true}}
+	message := &NexyMessage{
+		Header: NexyHeader{Type: TypeChatMessage},
+		Body:   json.RawMessage(`{"message_type":"poll","content":"","server_id":3,"poll":{"question":"Lunch?"}}`),
+	}
+
+	body := adaptedBody(t, legacy, message)
+	if got := string(body["message_type"]); got != `"text"` {
+		t.Errorf("message_type = %s, want \"text\"", got)
+	}
+	if got := string(body["content"]); got != `"Sent a poll"` {
+		t.Errorf("content = %s, want \"Sent a poll\"", got)
+	}
+	if _, ok := body["poll"]; ok {
+		t.Error("downgraded message still carries the poll")
+	}
+	if got := string(body["server_id"]); got != "3" {
+		t.Errorf("server_id = %s, want 3", got)
+	}
+
+	polls := &Client{capabilities: map[Capability]bool{CapPolls: true}}
+	data, _ := json.Marshal(message)
+	if frame := polls.adapt(message, 7, data); string(frame) != string(data) {
+		t.Error("a client with polls did not get the frame as it is")
+	}
+}
+
+func TestLegacyClientGetsPresenceWithoutState(t *testing.T) {
+	legacy := &Client{}
+	message, _ := NewNexyMessage(TypeOnline, 5, nil, OnlineBody{UserID: 5, State: "away"})
+
+	body := adaptedBody(t, legacy, message)
+	if _, ok := body["state"]; ok {
+		t.Error("downgraded presence still carries the state")
+	}
+	if got := string(body["user_id"]); got != "5" {
+		t.Errorf("user_id = %s, want 5", got)
+	}
+}
@@ -17,15 +17,120 @@ type Client struct {
 	deviceID string
 	mu       sync.Mutex
 	isClosed bool
+	encoding wireEncoding // Negotiated via Sec-WebSocket-Protocol
+
+	// Protocol handshake state; clients that skip the hello keep the legacy set
+	capMu        sync.RWMutex
+	capabilities map[Capability]bool
+
+	// Stream state: while resuming, live sequenced frames are held until the
+	// missed ones have been replayed
+	streamMu   sync.Mutex
+	resumeFrom int64 // last acked seq sent by the client, -1 for a fresh session
+	resuming   bool
+	held       []heldFrame
+	replayed   map[int64]bool // Seqs the replay wrote, which held frames must not repeat
 }
 
-func newClient(hub *Hub, conn *websocket.Conn, userID int, deviceID string) *Client {
+type heldFrame struct {
+	seq  int64
+	data []byte
+}
+
+func newClient(hub *Hub, conn *websocket.Conn, userID int, deviceID string, resumeFrom int64) *Client {
+	capabilities := make(map[Capability]bool)
+	for _, capability := range legacyCapabilities {
+		capabilities[capability] = true
+	}
+	// Sending last_seq implies the client understands resumption frames
+	if resumeFrom >= 0 {
+		capabilities[CapResumable] = true
+	}
+
 	return &Client{
-		hub:      hub,
-		conn:     conn,
-		send:     make(chan []byte, 256),
-		userID:   userID,
-		deviceID: deviceID,
+		hub:          hub,
+		conn:         conn,
+		send:         make(chan []byte, 256),
+		userID:       userID,
+		deviceID:     deviceID,
+		encoding:     encodingForSubprotocol(conn.Subprotocol()),
+		capabilities: capabilities,
+		resumeFrom:   resumeFrom,
+		resuming:     resumeFrom >= 0,
+	}
+}
+
+// queue hands a frame to the write pump. Sequenced frames are held while the
+// client is resuming.
+func (c *Client) queue(seq int64, data []byte) bool {
+	c.streamMu.Lock()
+	defer c.streamMu.Unlock()
+
+	if seq > 0 && c.resuming {
+		c.held = append(c.held, heldFrame{seq: seq, data: data})
+		return true
+	}
+	return c.push(data)
+}
+
+// replay writes a frame during resumption, bypassing the hold. The backlog can
+// be larger than the send buffer, so it waits for room, up to writeWait,
+// rather than dropping the frame.
+func (c *Client) replay(seq int64, data []byte) bool {
+	deadline := time.Now().Add(writeWait)
+	for {
+		c.streamMu.Lock()
+		ok := c.push(data)
+		if ok && seq > 0 {
+			if c.replayed == nil {
+				c.replayed = make(map[int64]bool)
+			}
+			c.replayed[seq] = true
+		}
+		c.streamMu.Unlock()
+		if ok {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(replayRetryInterval)
+	}
+}
+
+// finishResume releases the frames held during the replay, except those the
+// replay already wrote. Sequences are handed out on several workers and
+// nodes, so a held frame can be older than the newest replayed one and still
+// be missing from the client.
+func (c *Client) finishResume() {
+	c.streamMu.Lock()
+	defer c.streamMu.Unlock()
+
+	for _, frame := range c.held {
+		if !c.replayed[frame.seq] {
+			c.push(frame.data)
+		}
+	}
+	c.held = nil
+	c.replayed = nil
+	c.resuming = false
+}
+
+// push must be called with streamMu held. It reports false when the send
+// buffer is full.
+func (c *Client) push(data []byte) bool {
+	// Frames are pushed from several workers, so guard against a concurrent close
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.isClosed {
+		return true
+	}
+
+	select {
+	case c.send <- data:
+		return true
+	default:
+		return false
 	}
 }
 
@@ -43,11 +148,17 @@ func (c *Client) readPump() {
 	c.conn.SetReadLimit(maxMessageSize)
 
 	for {
-		_, data, err := c.conn.ReadMessage()
+		messageType, raw, err := c.conn.ReadMessage()
 		if err != nil {
 			break
 		}
 
+		data, err := c.decodeFrame(messageType, raw)
+		if err != nil {
+			log.Printf("Error decoding binary frame from user %d: %v", c.userID, err)
+			continue
+		}
+
 		log.Printf("Received raw WebSocket data from user %d: %s", c.userID, string(data))
 
 		var msg NexyMessage
@@ -58,16 +169,22 @@ func (c *Client) readPump() {
 
 		log.Printf("Parsed message type: %s, messageID: %s", msg.Header.Type, msg.Header.MessageID)
 
+		if msg.Header.Type == TypeHello {
+			c.handleHello(&msg)
+			continue
+		}
+
 		if msg.Header.Type == TypeHeartbeat {
 			ack, _ := NewNexyMessage(TypeAck, 0, nil, AckBody{MessageID: msg.Header.MessageID, Status: "ok"})
 			ackData, _ := json.Marshal(ack)
-			c.send <- ackData
+			c.queue(0, ackData)
 			continue
 		}
 
 		msg.Header.SenderID = c.userID
-		log.Printf("Broadcasting message to hub: type=%s, senderID=%d", msg.Header.Type, c.userID)
-		c.hub.broadcast <- &msg
+		msg.senderDevice = c.deviceID
+		log.Printf("Dispatching message to hub: type=%s, senderID=%d", msg.Header.Type, c.userID)
+		c.hub.dispatcher.submit(&msg)
 	}
 }
 
@@ -87,7 +204,13 @@ func (c *Client) writePump() {
 				return
 			}
 
-			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			frameType, frame, err := c.encodeFrame(message)
+			if err != nil {
+				log.Printf("Error encoding frame for user %d: %v", c.userID, err)
+				continue
+			}
+
+			if err := c.conn.WriteMessage(frameType, frame); err != nil {
 				return
 			}
 
@@ -0,0 +1,59 @@
+package nexy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func drain(c *Client) []string {
+	var frames []string
+	for {
+		select {
+		case data := <-c.send:
+			frames = append(frames, string(data))
+		default:
+			return frames
+		}
+	}
+}
+
+func TestFinishResumeSkipsOnlyReplayedFrames(t *testing.T) {
+	c := &Client{send: make(chan []byte, 16), resumeFrom: 3, resuming: true}
+
+	// Live frames reach the hold while the replay runs, 5 before 4
+	c.queue(5, []byte("5"))
+	c.queue(4, []byte("4"))
+	c.queue(6, []byte("6"))
+
+	// The replay's snapshot of the buffer only had 5
+	if !c.replay(5, []byte("5")) {
+		t.Fatal("replay refused a frame with room in the buffer")
+	}
+	c.finishResume()
+
+	if got, want := drain(c), []string{"5", "4", "6"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("frames sent = %v, want %v", got, want)
+	}
+
+	// Once resumed, out of order frames go straight out
+	c.queue(8, []byte("8"))
+	c.queue(7, []byte("7"))
+	if got, want := drain(c), []string{"8", "7"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("frames sent after resuming = %v, want %v", got, want)
+	}
+}
+
+func TestEphemeralFramesAreNotSequenced(t *testing.T) {
+	typing := &NexyMessage{Header: NexyHeader{Type: TypeTyping}}
+	if typing.sequenced() {
+		t.Error("typing frames are sequenced")
+	}
+	chat := &NexyMessage{Header: NexyHeader{Type: TypeChatMessage}}
+	if !chat.sequenced() {
+		t.Error("chat messages are not sequenced")
+	}
+	chat.ephemeral = true
+	if chat.sequenced() {
+		t.Error("a frame marked ephemeral is sequenced")
+	}
+}
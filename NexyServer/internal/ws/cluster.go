@@ -0,0 +1,318 @@
+package nexy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	clusterBroadcastChannel = "nexy:cluster:broadcast"
+	clusterNodesKey         = "nexy:cluster:nodes"
+	nodeHeartbeatInterval   = 10 * time.Second
+	nodeHeartbeatTTL        = 30 * time.Second
+	userOnlinePrefix        = "user:online:"
+)
+
+type envelopeKind string
+
+const (
+	envelopeDeliver    envelopeKind = "deliver"
+	envelopeBroadcast  envelopeKind = "broadcast"
+	envelopeDevice     envelopeKind = "device"
+	envelopeDisconnect envelopeKind = "disconnect"
+	envelopeDevices    envelopeKind = "devices"
+)
+
+// clusterEnvelope is what Hub instances publish to each other over Redis
+type clusterEnvelope struct {
+	Origin    string                   `json:"origin"`
+	Kind      envelopeKind             `json:"kind"`
+	UserIDs   []int                    `json:"user_ids,omitempty"`
+	Seqs      map[int]map[string]int64 `json:"seqs,omitempty"` // By user and device
+	DeviceID  string                   `json:"device_id,omitempty"`
+	DeviceIDs []string                 `json:"device_ids,omitempty"`
+	Exclude   bool                     `json:"exclude,omitempty"`
+	Message   *NexyMessage             `json:"message,omitempty"`
+}
+
+func userOnlineKey(userID int) string {
+	return fmt.Sprintf("%s%d", userOnlinePrefix, userID)
+}
+
+func nodeChannel(nodeID string) string {
+	return "nexy:cluster:node:" + nodeID
+}
+
+func nodeAliveKey(nodeID string) string {
+	return "nexy:cluster:alive:" + nodeID
+}
+
+func nodeUsersKey(nodeID string) string {
+	return "nexy:cluster:users:" + nodeID
+}
+
+func nodeDispatchKey(nodeID string) string {
+	return "nexy:cluster:dispatch:" + nodeID
+}
+
+// runCluster subscribes to the broadcast channel and to this node's own
+// channel, and keeps the node heartbeat alive
+func (h *Hub) runCluster() {
+	ctx := context.Background()
+
+	pubsub := h.redis.Subscribe(ctx, clusterBroadcastChannel, nodeChannel(h.nodeID))
+	defer pubsub.Close()
+
+	go h.heartbeat()
+
+	log.Printf("Cluster node %s subscribed", h.nodeID)
+
+	for msg := range pubsub.Channel() {
+		var env clusterEnvelope
+		if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+			log.Printf("Error unmarshaling cluster envelope: %v", err)
+			continue
+		}
+
+		if env.Origin == h.nodeID {
+			continue
+		}
+
+		h.handleEnvelope(&env)
+	}
+}
+
+func (h *Hub) handleEnvelope(env *clusterEnvelope) {
+	switch env.Kind {
+	case envelopeDeliver:
+		if env.Message == nil {
+			return
+		}
+		for _, userID := range env.UserIDs {
+			h.sendLocal(userID, env.Message, env.Seqs[userID], h.unregisterClientFunc)
+		}
+	case envelopeBroadcast:
+		if env.Message != nil {
+			h.broadcastLocal(env.Message, h.unregisterClientFunc)
+		}
+	case envelopeDevice:
+		if env.Message == nil || len(env.UserIDs) == 0 {
+			return
+		}
+		data, err := json.Marshal(env.Message)
+		if err != nil {
+			log.Printf("Error marshaling cluster message: %v", err)
+			return
+		}
+		h.sendToDevice(env.UserIDs[0], env.DeviceID, data)
+	case envelopeDevices:
+		if env.Message == nil || len(env.UserIDs) == 0 {
+			return
+		}
+		h.sendToDevicesLocal(env.UserIDs[0], env.DeviceIDs, env.Exclude, env.Message)
+	case envelopeDisconnect:
+		for _, userID := range env.UserIDs {
+			h.disconnectLocal(userID)
+		}
+	}
+}
+
+func (h *Hub) publish(channel string, env *clusterEnvelope) {
+	env.Origin = h.nodeID
+
+	data, err := json.Marshal(env)
+	if err != nil {
+		log.Printf("Error marshaling cluster envelope: %v", err)
+		return
+	}
+
+	if err := h.redis.Publish(context.Background(), channel, data).Err(); err != nil {
+		log.Printf("Error publishing to %s: %v", channel, err)
+	}
+}
+
+// publishToNodes sends an envelope to every remote node holding one of the given users
+func (h *Hub) publishToNodes(nodes map[int][]string, kind envelopeKind, message *NexyMessage, seqs map[int]map[string]int64) {
+	byNode := make(map[string][]int)
+	for userID, nodeIDs := range nodes {
+		for _, nodeID := range nodeIDs {
+			byNode[nodeID] = append(byNode[nodeID], userID)
+		}
+	}
+
+	for nodeID, userIDs := range byNode {
+		nodeSeqs := make(map[int]map[string]int64, len(userIDs))
+		for _, userID := range userIDs {
+			if seq, ok := seqs[userID]; ok {
+				nodeSeqs[userID] = seq
+			}
+		}
+		h.publish(nodeChannel(nodeID), &clusterEnvelope{
+			Kind:    kind,
+			UserIDs: userIDs,
+			Seqs:    nodeSeqs,
+			Message: message,
+		})
+	}
+}
+
+// remoteNodes returns, for each user connected elsewhere, the IDs of the other nodes holding their sockets
+func (h *Hub) remoteNodes(userIDs []int) map[int][]string {
+	result := make(map[int][]string)
+	if len(userIDs) == 0 {
+		return result
+	}
+
+	ctx := context.Background()
+	pipe := h.redis.Pipeline()
+	cmds := make([]*redis.StringSliceCmd, len(userIDs))
+	for i, userID := range userIDs {
+		cmds[i] = pipe.SMembers(ctx, userOnlineKey(userID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		log.Printf("Error looking up user nodes: %v", err)
+		return result
+	}
+
+	for i, userID := range userIDs {
+		for _, nodeID := range cmds[i].Val() {
+			if nodeID != h.nodeID {
+				result[userID] = append(result[userID], nodeID)
+			}
+		}
+	}
+	return result
+}
+
+// addPresence records that this node holds a socket for the user
+func (h *Hub) addPresence(userID int) {
+	ctx := context.Background()
+	pipe := h.redis.TxPipeline()
+	pipe.SAdd(ctx, userOnlineKey(userID), h.nodeID)
+	pipe.SAdd(ctx, nodeUsersKey(h.nodeID), userID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error adding presence for user %d: %v", userID, err)
+	}
+}
+
+// removePresence drops the node from the user's presence set and reports
+// whether the user is now offline on every node
+func (h *Hub) removePresence(userID int, nodeID string) bool {
+	ctx := context.Background()
+	pipe := h.redis.TxPipeline()
+	pipe.SRem(ctx, userOnlineKey(userID), nodeID)
+	pipe.SRem(ctx, nodeUsersKey(nodeID), userID)
+	remaining := pipe.SCard(ctx, userOnlineKey(userID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error removing presence for user %d: %v", userID, err)
+		return true
+	}
+	return remaining.Val() == 0
+}
+
+func (h *Hub) heartbeat() {
+	ticker := time.NewTicker(nodeHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		ctx := context.Background()
+		h.redis.Set(ctx, nodeAliveKey(h.nodeID), "1", nodeHeartbeatTTL)
+		h.redis.SAdd(ctx, clusterNodesKey, h.nodeID)
+		h.publishDispatchStats()
+		h.reapDeadNodes()
+		if h.calls != nil {
+			h.calls.HandleHeartbeat()
+		}
+
+		<-ticker.C
+	}
+}
+
+// publishDispatchStats stores this node's worker pool metrics for the admin panel
+func (h *Hub) publishDispatchStats() {
+	stats := h.dispatcher.stats()
+	stats.NodeID = h.nodeID
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return
+	}
+	if err := h.redis.Set(context.Background(), nodeDispatchKey(h.nodeID), data, nodeHeartbeatTTL).Err(); err != nil {
+		log.Printf("Error publishing dispatch stats: %v", err)
+	}
+}
+
+// reapDeadNodes clears presence left behind by nodes that stopped heartbeating
+func (h *Hub) reapDeadNodes() {
+	ctx := context.Background()
+
+	nodeIDs, err := h.redis.SMembers(ctx, clusterNodesKey).Result()
+	if err != nil {
+		log.Printf("Error listing cluster nodes: %v", err)
+		return
+	}
+
+	for _, nodeID := range nodeIDs {
+		if nodeID == h.nodeID {
+			continue
+		}
+
+		alive, err := h.redis.Exists(ctx, nodeAliveKey(nodeID)).Result()
+		if err != nil || alive > 0 {
+			continue
+		}
+
+		// Only one node wins the SREM, so the reap runs once per dead node
+		removed, err := h.redis.SRem(ctx, clusterNodesKey, nodeID).Result()
+		if err != nil || removed == 0 {
+			continue
+		}
+
+		userIDs, err := h.redis.SMembers(ctx, nodeUsersKey(nodeID)).Result()
+		if err != nil {
+			log.Printf("Error listing users of dead node %s: %v", nodeID, err)
+			continue
+		}
+
+		log.Printf("Reaping dead cluster node %s (%d users)", nodeID, len(userIDs))
+
+		for _, idStr := range userIDs {
+			var userID int
+			if _, err := fmt.Sscan(idStr, &userID); err != nil {
+				continue
+			}
+			if h.removePresence(userID, nodeID) {
+				go func(userID int) {
+					h.publishPresence(userID)
+					h.clearPresenceSubscriptions(userID)
+				}(userID)
+			}
+		}
+
+		h.redis.Del(ctx, nodeUsersKey(nodeID))
+	}
+}
+
+// clusterOnlineUserIDs scans presence keys for users connected to any node
+func (h *Hub) clusterOnlineUserIDs() map[int]bool {
+	ctx := context.Background()
+	result := make(map[int]bool)
+
+	iter := h.redis.Scan(ctx, 0, userOnlinePrefix+"*", 500).Iterator()
+	for iter.Next(ctx) {
+		var userID int
+		if _, err := fmt.Sscan(strings.TrimPrefix(iter.Val(), userOnlinePrefix), &userID); err == nil {
+			result[userID] = true
+		}
+	}
+	if err := iter.Err(); err != nil {
+		log.Printf("Error scanning online users: %v", err)
+	}
+	return result
+}
@@ -0,0 +1,48 @@
+package nexy
+
+import (
+	"github.com/gorilla/websocket"
+)
+
+// Subprotocols offered during the upgrade. Clients that send no
+// Sec-WebSocket-Protocol header get JSON.
+const (
+	SubprotocolMsgpack = "nexy.msgpack"
+	SubprotocolJSON    = "nexy.json"
+)
+
+type wireEncoding int
+
+const (
+	encodingJSON wireEncoding = iota
+	encodingMsgpack
+)
+
+func encodingForSubprotocol(subprotocol string) wireEncoding {
+	if subprotocol == SubprotocolMsgpack {
+		return encodingMsgpack
+	}
+	return encodingJSON
+}
+
+// encodeFrame converts a JSON frame into the client's wire encoding
+func (c *Client) encodeFrame(data []byte) (int, []byte, error) {
+	if c.encoding != encodingMsgpack {
+		return websocket.TextMessage, data, nil
+	}
+
+	packed, err := jsonToMsgpack(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	return websocket.BinaryMessage, packed, nil
+}
+
+// decodeFrame converts an inbound frame to JSON. Binary clients may still
+// send text frames, which are taken as JSON.
+func (c *Client) decodeFrame(messageType int, data []byte) ([]byte, error) {
+	if messageType != websocket.BinaryMessage {
+		return data, nil
+	}
+	return msgpackToJSON(data)
+}
@@ -0,0 +1,176 @@
+package nexy
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultDispatchWorkers   = 32
+	defaultDispatchQueueSize = 256
+)
+
+// dispatcher runs inbound frames on a fixed pool of workers. Frames for the
+// same chat always land on the same worker, so they are handled in order
+// while different chats proceed in parallel.
+type dispatcher struct {
+	queues []chan dispatchJob
+	handle func(*NexyMessage)
+
+	processed   atomic.Int64
+	waitTotal   atomic.Int64 // nanoseconds spent queued
+	handleTotal atomic.Int64 // nanoseconds spent in the handler
+	waitMax     atomic.Int64
+	handleMax   atomic.Int64
+}
+
+type dispatchJob struct {
+	message  *NexyMessage
+	enqueued time.Time
+}
+
+// DispatchStats is a snapshot of the inbound worker pool of one node
+type DispatchStats struct {
+	NodeID        string  `json:"node_id"`
+	Workers       int     `json:"workers"`
+	QueueCapacity int     `json:"queue_capacity"`
+	QueueDepth    int     `json:"queue_depth"`
+	MaxQueueDepth int     `json:"max_queue_depth"` // Busiest worker
+	Processed     int64   `json:"processed"`
+	AvgWaitMs     float64 `json:"avg_wait_ms"`
+	AvgHandleMs   float64 `json:"avg_handle_ms"`
+	MaxWaitMs     float64 `json:"max_wait_ms"`   // Since the previous snapshot
+	MaxHandleMs   float64 `json:"max_handle_ms"` // Since the previous snapshot
+	Timestamp     int64   `json:"timestamp"`
+}
+
+func newDispatcher(workers, queueSize int, handle func(*NexyMessage)) *dispatcher {
+	if workers <= 0 {
+		workers = defaultDispatchWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = defaultDispatchQueueSize
+	}
+
+	d := &dispatcher{
+		queues: make([]chan dispatchJob, workers),
+		handle: handle,
+	}
+	for i := range d.queues {
+		d.queues[i] = make(chan dispatchJob, queueSize)
+	}
+	return d
+}
+
+func (d *dispatcher) start() {
+	for _, queue := range d.queues {
+		go d.work(queue)
+	}
+}
+
+func (d *dispatcher) work(queue chan dispatchJob) {
+	for job := range queue {
+		started := time.Now()
+		d.handle(job.message)
+		finished := time.Now()
+
+		d.record(started.Sub(job.enqueued), finished.Sub(started))
+	}
+}
+
+func (d *dispatcher) record(wait, handled time.Duration) {
+	d.processed.Add(1)
+	d.waitTotal.Add(int64(wait))
+	d.handleTotal.Add(int64(handled))
+	storeMax(&d.waitMax, int64(wait))
+	storeMax(&d.handleMax, int64(handled))
+}
+
+func storeMax(v *atomic.Int64, n int64) {
+	for {
+		cur := v.Load()
+		if n <= cur || v.CompareAndSwap(cur, n) {
+			return
+		}
+	}
+}
+
+// submit queues a frame on the worker owning its chat. It blocks when that
+// worker is full, which pushes back on the sending connection only.
+func (d *dispatcher) submit(message *NexyMessage) {
+	queue := d.queues[d.shard(message)]
+	job := dispatchJob{message: message, enqueued: time.Now()}
+
+	select {
+	case queue <- job:
+	default:
+		log.Printf("Dispatch queue full for %s frame from user %d, waiting", message.Header.Type, message.Header.SenderID)
+		queue <- job
+	}
+}
+
+func (d *dispatcher) shard(message *NexyMessage) int {
+	h := fnv.New32a()
+	h.Write([]byte(orderingKey(message)))
+	return int(h.Sum32() % uint32(len(d.queues)))
+}
+
+// orderingKey names the conversation a frame belongs to. Frames sharing a key
+// are handled strictly in arrival order.
+func orderingKey(message *NexyMessage) string {
+	if message.Header.ChatID != nil {
+		return "chat:" + strconv.Itoa(*message.Header.ChatID)
+	}
+
+	if message.Header.Type == TypeTyping {
+		var body TypingBody
+		if err := json.Unmarshal(message.Body, &body); err == nil && body.ChatID != 0 {
+			return "chat:" + strconv.Itoa(body.ChatID)
+		}
+	}
+
+	// Private frames before the chat exists are ordered per pair of users
+	if message.Header.RecipientID != nil {
+		a, b := message.Header.SenderID, *message.Header.RecipientID
+		if a > b {
+			a, b = b, a
+		}
+		return "pair:" + strconv.Itoa(a) + ":" + strconv.Itoa(b)
+	}
+
+	return "user:" + strconv.Itoa(message.Header.SenderID)
+}
+
+func (d *dispatcher) stats() DispatchStats {
+	stats := DispatchStats{
+		Workers:   len(d.queues),
+		Processed: d.processed.Load(),
+		Timestamp: time.Now().Unix(),
+	}
+
+	for _, queue := range d.queues {
+		depth := len(queue)
+		stats.QueueCapacity += cap(queue)
+		stats.QueueDepth += depth
+		if depth > stats.MaxQueueDepth {
+			stats.MaxQueueDepth = depth
+		}
+	}
+
+	if stats.Processed > 0 {
+		stats.AvgWaitMs = toMillis(d.waitTotal.Load() / stats.Processed)
+		stats.AvgHandleMs = toMillis(d.handleTotal.Load() / stats.Processed)
+	}
+	stats.MaxWaitMs = toMillis(d.waitMax.Swap(0))
+	stats.MaxHandleMs = toMillis(d.handleMax.Swap(0))
+
+	return stats
+}
+
+func toMillis(ns int64) float64 {
+	return float64(ns) / float64(time.Millisecond)
+}
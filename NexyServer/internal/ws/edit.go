@@ -0,0 +1,52 @@
+package nexy
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// MessageEditor edits a user's own message, applying the same ownership, edit
+// window and access checks as the REST edit endpoint
+type MessageEditor interface {
+	UpdateMessage(ctx context.Context, messageID string, userID int, content string, mentions []models.MentionEntity) (*models.Message, error)
+}
+
+func (h *Hub) SetMessageEditor(editor MessageEditor) {
+	h.editor = editor
+}
+
+// editErrorCodes gives the editor's plain refusals their error frame codes
+var editErrorCodes = map[string]string{
+	"message not found":                        "not_found",
+	"unauthorized: can only edit own messages": "not_sender",
+	"cannot edit deleted message":              "message_deleted",
+	"edit window has expired":                  "edit_window_expired",
+}
+
+// handleEditMessage edits on behalf of the sender and tells the other
+// members. A refused edit comes back to the sender as an error frame.
+func (h *Hub) handleEditMessage(message *NexyMessage) {
+	senderID := message.Header.SenderID
+	if h.editor == nil {
+		return
+	}
+
+	var editBody EditMessageBody
+	if err := json.Unmarshal(message.Body, &editBody); err != nil {
+		log.Printf("Error unmarshaling edit body: %v", err)
+		return
+	}
+
+	msg, err := h.editor.UpdateMessage(context.Background(), editBody.MessageID, senderID, editBody.Content, editBody.Mentions)
+	if err != nil {
+		log.Printf("Rejected edit of message %s from user %d: %v", editBody.MessageID, senderID, err)
+		h.sendFrameError(message, err, "edit_failed", editErrorCodes)
+		return
+	}
+
+	h.BroadcastEdit(msg)
+	log.Printf("Edit broadcasted to chat members: chatID=%d, messageID=%s", msg.ChatID, msg.MessageID)
+}
@@ -0,0 +1,100 @@
+package nexy
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// MessageForwarder copies messages into other chats, applying the same read
+// and send checks as the REST forward endpoint
+type MessageForwarder interface {
+	ForwardMessages(ctx context.Context, userID int, messageIDs []string, chatIDs []int) ([]*models.Message, error)
+}
+
+func (h *Hub) SetForwarder(forwarder MessageForwarder) {
+	h.forwarder = forwarder
+}
+
+// forwardErrorCodes gives the forwarder's plain refusals their error frame codes
+var forwardErrorCodes = map[string]string{
+	"message not found":                     "not_found",
+	"no messages to forward":                "invalid_forward",
+	"too many messages to forward":          "invalid_forward",
+	"no target chats":                       "invalid_forward",
+	"too many target chats":                 "invalid_forward",
+	"system messages cannot be forwarded":   "not_forwardable",
+	"polls cannot be forwarded":             "not_forwardable",
+	"locations cannot be forwarded":         "not_forwardable",
+	"message cannot be forwarded":           "not_forwardable",
+	"recipient has disabled voice messages": "voice_disabled",
+}
+
+// handleForward forwards on behalf of the sender and acks the frame. The
+// copies reach every member of the target chats, the sender's devices included.
+func (h *Hub) handleForward(message *NexyMessage) {
+	senderID := message.Header.SenderID
+	if h.forwarder == nil {
+		return
+	}
+
+	var body ForwardBody
+	if err := message.ParseBody(&body); err != nil {
+		log.Printf("Error parsing forward from user %d: %v", senderID, err)
+		return
+	}
+
+	forwarded, err := h.forwarder.ForwardMessages(context.Background(), senderID, body.MessageIDs, body.ChatIDs)
+	if err != nil {
+		log.Printf("Rejected forward from user %d: %v", senderID, err)
+		h.sendFrameError(message, err, "forward_failed", forwardErrorCodes)
+		return
+	}
+
+	for _, msg := range forwarded {
+		h.BroadcastMessage(msg)
+	}
+
+	ack, _ := NewNexyMessage(TypeAck, 0, nil, AckBody{
+		MessageID: message.Header.MessageID,
+		Status:    "ok",
+	})
+	h.sendToUser(senderID, ack, h.unregisterClientFunc)
+}
+
+// BroadcastMessage delivers a message created outside a chat_message frame to
+// the chat's members and to all of the sender's devices
+func (h *Hub) BroadcastMessage(msg *models.Message) {
+	body := ChatMessageBody{
+		Content:     msg.Content,
+		MessageType: msg.MessageType,
+		ServerID:    msg.ID,
+		MediaURL:    msg.MediaURL,
+		MediaType:   msg.MediaType,
+		FileSize:    msg.FileSize,
+		Duration:    msg.Duration,
+		ReplyToID:   msg.ReplyToID,
+		Forward:     msg.Forward,
+	}
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		log.Printf("Error marshaling message %s: %v", msg.MessageID, err)
+		return
+	}
+
+	nexyMsg := &NexyMessage{
+		Header: NexyHeader{
+			Type:      TypeChatMessage,
+			MessageID: msg.MessageID,
+			Timestamp: msg.CreatedAt.Unix(),
+			SenderID:  msg.SenderID,
+			ChatID:    &msg.ChatID,
+		},
+		Body: bodyBytes,
+	}
+
+	h.broadcastToChatMembers(msg.ChatID, nexyMsg)
+	h.deliver([]int{msg.SenderID}, nexyMsg, h.unregisterClientFunc)
+}
@@ -39,6 +39,8 @@ var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
 	CheckOrigin:     checkOrigin,
+	// Listed in order of preference; the first one the client also offers wins
+	Subprotocols: []string{SubprotocolMsgpack, SubprotocolJSON},
 }
 
 type WSHandler struct {
@@ -49,7 +51,9 @@ func NewWSHandler(hub *Hub) *WSHandler {
 	return &WSHandler{hub: hub}
 }
 
-func (h *WSHandler) ServeWS(w http.ResponseWriter, r *http.Request, userID int, deviceID string) {
+// ServeWS upgrades the connection. lastSeq is the last stream sequence the
+// device acked before reconnecting, or -1 for a fresh session.
+func (h *WSHandler) ServeWS(w http.ResponseWriter, r *http.Request, userID int, deviceID string, lastSeq int64) {
 	// Check if user is banned before allowing WebSocket connection
 	if h.hub.redis != nil {
 		banKey := "banned:user:" + string(rune(userID))
@@ -73,7 +77,7 @@ func (h *WSHandler) ServeWS(w http.ResponseWriter, r *http.Request, userID int,
 		return
 	}
 
-	client := newClient(h.hub, conn, userID, deviceID)
+	client := newClient(h.hub, conn, userID, deviceID, lastSeq)
 
 	client.hub.register <- client
 
@@ -156,6 +160,10 @@ func (r *NexyChatRepo) GetByID(ctx context.Context, id int) (*models.Chat, error
 	return r.repo.GetByID(ctx, id)
 }
 
+func (r *NexyChatRepo) GetChatMember(ctx context.Context, chatID, userID int) (*models.ChatMember, error) {
+	return r.repo.GetChatMember(ctx, chatID, userID)
+}
+
 func (r *NexyChatRepo) Create(ctx context.Context, chat *models.Chat) error {
 	return r.repo.Create(ctx, chat)
 }
@@ -4,8 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/vtstv/nexy/internal/models"
 )
@@ -13,6 +13,13 @@ import (
 func (h *Hub) handleChatMessage(message *NexyMessage, unregisterFunc func(*Client)) {
 	ctx := context.Background()
 
+	// Refuse a malformed body before it can create a chat
+	_, spec, err := models.ParseMessageBody(message.Body)
+	if err != nil {
+		h.sendToUser(message.Header.SenderID, errorAck(message.Header.MessageID, err), unregisterFunc)
+		return
+	}
+
 	// Check if this is a private message without existing chat
 	if message.Header.ChatID == nil && message.Header.RecipientID != nil {
 		// Try to find existing private chat
@@ -75,33 +82,16 @@ func (h *Hub) handleChatMessage(message *NexyMessage, unregisterFunc func(*Clien
 		return
 	}
 
-	// Check for voice message restriction
-	var body ChatMessageBody
-	if err := json.Unmarshal(message.Body, &body); err == nil && body.MessageType == "voice" {
-		chat, err := h.chatRepo.GetByID(ctx, *message.Header.ChatID)
-		if err == nil && chat != nil && chat.Type == "private" {
-			// Get members to find the recipient
-			members, err := h.chatRepo.GetChatMembers(ctx, chat.ID)
-			if err == nil {
-				for _, memberID := range members {
-					if memberID != message.Header.SenderID {
-						// Check if this user has voice messages enabled
-						user, err := h.userRepo.GetByID(ctx, memberID)
-						if err == nil && user != nil && !user.VoiceMessagesEnabled {
-							log.Printf("Voice message rejected: recipient %d has disabled voice messages", memberID)
-							errorAck, _ := NewNexyMessage(TypeAck, 0, nil, AckBody{
-								MessageID: message.Header.MessageID,
-								Status:    "error",
-								Error:     "Voice messages are disabled by the recipient",
-							})
-							h.sendToUser(message.Header.SenderID, errorAck, unregisterFunc)
-							return
-						}
-					}
-				}
-			}
-		}
+	mentions, err := h.resolveMentions(ctx, *message.Header.ChatID, message.Header.SenderID, message.Body)
+	if err == nil {
+		err = h.checkVoiceAllowed(ctx, *message.Header.ChatID, message.Header.SenderID, spec)
 	}
+	if err != nil {
+		h.sendToUser(message.Header.SenderID, errorAck(message.Header.MessageID, err), unregisterFunc)
+		return
+	}
+
+	message.Body = withMentions(message.Body, mentions)
 
 	// Save message to database
 	serverID, err := h.messageRepo.CreateMessageFromWebSocket(ctx, message.Header.MessageID, *message.Header.ChatID, message.Header.SenderID, message.Body)
@@ -129,52 +119,128 @@ func (h *Hub) handleChatMessage(message *NexyMessage, unregisterFunc func(*Clien
 	h.sendToUser(message.Header.SenderID, ack, unregisterFunc)
 	log.Printf("ACK sent to sender %d for message %s (serverID=%d)", message.Header.SenderID, message.Header.MessageID, serverID)
 
-	// Add server_id to message body for broadcast
-	var bodyMap map[string]interface{}
-	if err := json.Unmarshal(message.Body, &bodyMap); err == nil {
-		bodyMap["server_id"] = serverID
-		if newBody, err := json.Marshal(bodyMap); err == nil {
-			message.Body = newBody
-		}
-	}
+	// Add server_id, and the stored poll or location, to message body for broadcast
+	message.Body = h.withPayload(ctx, withServerID(message.Body, serverID), spec, serverID)
 
 	// Broadcast to chat members
 	h.broadcastToChatMembers(*message.Header.ChatID, message)
 	log.Printf("Message broadcasted to chat members: chatID=%d", *message.Header.ChatID)
+
+	h.publishThreadUpdate(ctx, *message.Header.ChatID, message.Body)
 }
 
-func (h *Hub) handleEditMessage(message *NexyMessage) {
-	ctx := context.Background()
+// errorAck refuses a chat_message, with the error's code when it has one
+func errorAck(messageID string, err error) *NexyMessage {
+	code, text := errorText(err)
+	ack, _ := NewNexyMessage(TypeAck, 0, nil, AckBody{
+		MessageID: messageID,
+		Status:    "error",
+		Error:     text,
+		Code:      code,
+	})
+	return ack
+}
 
-	var editBody EditMessageBody
-	if err := json.Unmarshal(message.Body, &editBody); err != nil {
-		log.Printf("Error unmarshaling edit body: %v", err)
-		return
+// sendFrameError refuses a frame other than a chat_message with an error
+// frame to its sender. Coded errors and the plain refusals listed in known
+// keep their text; anything else goes out as fallbackCode with a generic
+// text, and its details only reach the server log.
+func (h *Hub) sendFrameError(message *NexyMessage, err error, fallbackCode string, known map[string]string) {
+	code, text := errorText(err)
+	if code == "" {
+		if knownCode, ok := known[err.Error()]; ok {
+			code, text = knownCode, err.Error()
+		} else {
+			code = fallbackCode
+		}
 	}
 
-	dbMsg, err := h.messageRepo.GetByUUID(ctx, editBody.MessageID)
-	if err != nil {
-		log.Printf("Error getting message by UUID: %v", err)
-		return
+	errorMsg, _ := NewNexyMessage(TypeError, 0, nil, ErrorBody{
+		Code:      code,
+		Message:   text,
+		MessageID: message.Header.MessageID,
+	})
+	h.sendToUser(message.Header.SenderID, errorMsg, h.unregisterClientFunc)
+}
+
+// errorText gives the code and text a client is told for a refusal. Only
+// coded errors are meant for clients; anything else stays in the server log.
+func errorText(err error) (string, string) {
+	if coded, ok := err.(interface{ ErrorCode() string }); ok {
+		return coded.ErrorCode(), err.Error()
 	}
+	return "", "internal error"
+}
 
-	if dbMsg.SenderID != message.Header.SenderID {
-		log.Printf("User %d attempted to edit message from user %d", message.Header.SenderID, dbMsg.SenderID)
-		return
+// withPayload replaces the poll or location a client sent with the stored
+// one, as the message type's storage says
+func (h *Hub) withPayload(ctx context.Context, body json.RawMessage, spec *models.MessageTypeSpec, serverID int) json.RawMessage {
+	switch spec.Storage {
+	case models.StoragePoll:
+		return h.withPoll(ctx, body, serverID)
+	case models.StorageLocation:
+		return h.withLocation(ctx, body, serverID)
+	}
+	return body
+}
+
+// checkVoiceAllowed refuses voice messages to a private chat whose other
+// member has turned them off
+func (h *Hub) checkVoiceAllowed(ctx context.Context, chatID, senderID int, spec *models.MessageTypeSpec) error {
+	if spec.Name != "voice" {
+		return nil
 	}
 
-	dbMsg.Content = editBody.Content
-	dbMsg.IsEdited = true
-	dbMsg.UpdatedAt = time.Now()
+	chat, err := h.chatRepo.GetByID(ctx, chatID)
+	if err != nil || chat == nil || chat.Type != "private" {
+		return nil
+	}
 
-	if err := h.messageRepo.Update(ctx, dbMsg); err != nil {
-		log.Printf("Error updating message: %v", err)
-		return
+	// Get members to find the recipient
+	members, err := h.chatRepo.GetChatMembers(ctx, chat.ID)
+	if err != nil {
+		return nil
+	}
+	for _, memberID := range members {
+		if memberID == senderID {
+			continue
+		}
+		// Check if this user has voice messages enabled
+		user, err := h.userRepo.GetByID(ctx, memberID)
+		if err == nil && user != nil && !user.VoiceMessagesEnabled {
+			log.Printf("Voice message rejected: recipient %d has disabled voice messages", memberID)
+			return errVoiceDisabled
+		}
+	}
+	return nil
+}
+
+// withServerID sets server_id in a JSON object body, replacing any the client
+// sent
+func withServerID(body json.RawMessage, serverID int) json.RawMessage {
+	return withField(body, "server_id", strconv.AppendInt(nil, int64(serverID), 10))
+}
+
+// withField sets a key of a JSON object body to an already encoded value, or
+// removes it when value is nil. Only the top level is decoded, and every
+// copy of the key the client sent is replaced. A body that is not an object
+// is returned as is.
+func withField(body json.RawMessage, key string, value []byte) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		return body
 	}
 
-	message.Header.ChatID = &dbMsg.ChatID
-	h.broadcastToChatMembers(dbMsg.ChatID, message)
-	log.Printf("Edit broadcasted to chat members: chatID=%d, messageID=%s", dbMsg.ChatID, editBody.MessageID)
+	if value == nil {
+		delete(fields, key)
+	} else {
+		fields[key] = value
+	}
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return out
 }
 
 func (h *Hub) handleTypingMessage(message *NexyMessage, unregisterFunc func(*Client)) {
@@ -215,20 +281,17 @@ func (h *Hub) handleTypingMessage(message *NexyMessage, unregisterFunc func(*Cli
 		return
 	}
 
-	data, _ := json.Marshal(message)
+	online := h.GetOnlineUserIDsForUsers(members)
 
+	recipients := make([]int, 0, len(members))
 	for _, memberID := range members {
 		// Skip sender
 		if memberID == senderID {
 			continue
 		}
 
-		// Check if recipient is connected
-		h.mu.RLock()
-		clients, ok := h.clients[memberID]
-		h.mu.RUnlock()
-
-		if !ok || len(clients) == 0 {
+		// Check if recipient is connected to any node
+		if !online[memberID] {
 			continue
 		}
 
@@ -243,17 +306,11 @@ func (h *Hub) handleTypingMessage(message *NexyMessage, unregisterFunc func(*Cli
 			continue
 		}
 
-		// Send to all devices
-		for _, client := range clients {
-			select {
-			case client.send <- data:
-			default:
-				if unregisterFunc != nil {
-					go unregisterFunc(client)
-				}
-			}
-		}
+		recipients = append(recipients, memberID)
 	}
+
+	// Send to all devices
+	h.deliver(recipients, message, unregisterFunc)
 }
 
 func (h *Hub) handleStatusMessage(message *NexyMessage, unregisterFunc func(*Client)) {
@@ -277,6 +334,9 @@ func (h *Hub) handleStatusMessage(message *NexyMessage, unregisterFunc func(*Cli
 				msg, err := h.messageRepo.GetByUUID(ctx, readBody.MessageID)
 				if err != nil {
 					log.Printf("Error getting message by UUID for read receipt: %v", err)
+				} else if msg != nil && msg.ChatID != *message.Header.ChatID {
+					log.Printf("Read receipt for message %s does not belong to chat %d", readBody.MessageID, *message.Header.ChatID)
+					return
 				} else if msg != nil {
 					// Mark this message and all previous unread messages in this chat as read
 					if err := h.messageRepo.MarkMessagesAsRead(ctx, msg.ChatID, message.Header.SenderID, msg.ID); err != nil {
@@ -305,8 +365,9 @@ func (h *Hub) handleStatusMessage(message *NexyMessage, unregisterFunc func(*Cli
 
 				log.Printf("Broadcasting read receipt to %d members", len(members))
 
-				data, _ := json.Marshal(message)
+				online := h.GetOnlineUserIDsForUsers(members)
 
+				recipients := make([]int, 0, len(members))
 				for _, memberID := range members {
 					// Skip sender (the one who read it)
 					if memberID == message.Header.SenderID {
@@ -314,12 +375,8 @@ func (h *Hub) handleStatusMessage(message *NexyMessage, unregisterFunc func(*Cli
 						continue
 					}
 
-					// Check if recipient is connected
-					h.mu.RLock()
-					clients, ok := h.clients[memberID]
-					h.mu.RUnlock()
-
-					if !ok || len(clients) == 0 {
+					// Check if recipient is connected to any node
+					if !online[memberID] {
 						log.Printf("Recipient %d not connected", memberID)
 						continue
 					}
@@ -337,19 +394,11 @@ func (h *Hub) handleStatusMessage(message *NexyMessage, unregisterFunc func(*Cli
 					}
 
 					log.Printf("Sending read receipt to user %d", memberID)
-					// Send to all devices
-					for _, client := range clients {
-						select {
-						case client.send <- data:
-							log.Printf("Read receipt sent to user %d, deviceID=%s", memberID, client.deviceID)
-						default:
-							log.Printf("Failed to send read receipt to user %d (channel full)", memberID)
-							if unregisterFunc != nil {
-								go unregisterFunc(client)
-							}
-						}
-					}
+					recipients = append(recipients, memberID)
 				}
+
+				// Send to all devices
+				h.deliver(recipients, message, unregisterFunc)
 			}
 		}
 		return
@@ -0,0 +1,80 @@
+package nexy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWithServerIDReplacesClientValue(t *testing.T) {
+	body := json.RawMessage(`{"content":"hi","server_id":1,"server_id":2}`)
+	out := withServerID(body, 42)
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(out, &fields); err != nil {
+		t.Fatalf("withServerID produced invalid JSON %s: %v", out, err)
+	}
+	if string(fields["server_id"]) != "42" {
+		t.Errorf("server_id = %s, want 42", fields["server_id"])
+	}
+	if n := countKey(t, out, "server_id"); n != 1 {
+		t.Errorf("body has %d server_id keys, want 1: %s", n, out)
+	}
+}
+
+func TestWithFieldRemovesKey(t *testing.T) {
+	out := withField(json.RawMessage(`{"poll":{"correct_option":1},"content":"q"}`), "poll", nil)
+	var fields map[string]interface{}
+	if err := json.Unmarshal(out, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"content": "q"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("withField removing poll gave %s", out)
+	}
+}
+
+func TestWithFieldLeavesNonObjects(t *testing.T) {
+	for _, body := range []string{`[1]`, `"x"`, `null`, `{`} {
+		if out := withField(json.RawMessage(body), "k", []byte("1")); string(out) != body {
+			t.Errorf("withField(%s) = %s, want it unchanged", body, out)
+		}
+	}
+}
+
+// countKey counts the top-level occurrences of key in a JSON object
+func countKey(t *testing.T, data []byte, key string) int {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok == key {
+			n++
+		}
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return n
+}
+
+func TestErrorTextHidesUncodedErrors(t *testing.T) {
+	code, text := errorText(errors.New(`pq: relation "messages" does not exist`))
+	if code != "" || text != "internal error" {
+		t.Errorf("errorText of a plain error = %q, %q, want no code and a generic text", code, text)
+	}
+
+	code, text = errorText(errNoSharedChat)
+	if code != "not_member" || text != errNoSharedChat.Error() {
+		t.Errorf("errorText of a coded error = %q, %q", code, text)
+	}
+}
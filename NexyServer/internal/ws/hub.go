@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"github.com/vtstv/nexy/internal/models"
 )
@@ -22,8 +23,10 @@ type Hub struct {
 	clients      map[int][]*Client // Changed to slice to support multiple devices per user
 	register     chan *Client
 	unregister   chan *Client
-	broadcast    chan *NexyMessage
+	dispatcher   *dispatcher        // Runs inbound frames off the register/unregister loop
+	presenceLog  chan presenceEvent // Connects and disconnects, in order, for runPresence
 	redis        *redis.Client
+	nodeID       string // Identifies this instance on the Redis cluster channels
 	mu           sync.RWMutex
 	typingStatus map[int]map[int]bool // UserID -> ChatID -> isTyping
 	typingMu     sync.Mutex
@@ -31,14 +34,26 @@ type Hub struct {
 	chatRepo     ChatRepository
 	userRepo     UserRepository
 	fcmService   FcmService
+	authorizer   ChatAuthorizer
+	mentions     MentionResolver
+	presence     PresenceService
+	calls        CallHandler
+	forwarder    MessageForwarder
+	polls        PollVoter
+	locations    LiveLocationSharer
+	locationMu   sync.Mutex
+	lastLocation map[string]time.Time // Message UUID -> last accepted live location update
+	editor       MessageEditor
 }
 
 type MessageRepository interface {
 	CreateMessageFromWebSocket(ctx context.Context, messageID string, chatID, senderID int, bodyJSON []byte) (int, error)
 	GetByUUID(ctx context.Context, uuid string) (*models.Message, error)
 	UpdateStatus(ctx context.Context, status *models.MessageStatus) error
-	Update(ctx context.Context, msg *models.Message) error
 	MarkMessagesAsRead(ctx context.Context, chatID, userID, lastMessageID int) error
+	GetThreadInfo(ctx context.Context, chatID int, parentIDs []int, userID int) (map[int]*models.ThreadInfo, error)
+	GetPolls(ctx context.Context, messageIDs []int, userID int) (map[int]*models.Poll, error)
+	GetLocations(ctx context.Context, messageIDs []int) (map[int]*models.Location, error)
 }
 
 type ChatRepository interface {
@@ -48,6 +63,7 @@ type ChatRepository interface {
 	AddMember(ctx context.Context, member *models.ChatMember) error
 	GetChatMembers(ctx context.Context, chatID int) ([]int, error)
 	GetByID(ctx context.Context, id int) (*models.Chat, error)
+	GetChatMember(ctx context.Context, chatID, userID int) (*models.ChatMember, error)
 }
 
 type UserRepository interface {
@@ -67,29 +83,40 @@ type Chat struct {
 }
 
 func NewHub(redisClient *redis.Client, messageRepo MessageRepository, chatRepo ChatRepository, userRepo UserRepository, fcmService FcmService) *Hub {
-	return &Hub{
+	h := &Hub{
 		clients:      make(map[int][]*Client),
 		register:     make(chan *Client),
 		unregister:   make(chan *Client),
-		broadcast:    make(chan *NexyMessage, 256),
+		presenceLog:  make(chan presenceEvent, presenceQueueSize),
 		redis:        redisClient,
+		nodeID:       uuid.New().String(),
 		typingStatus: make(map[int]map[int]bool),
+		lastLocation: make(map[string]time.Time),
 		messageRepo:  messageRepo,
 		chatRepo:     chatRepo,
 		userRepo:     userRepo,
 		fcmService:   fcmService,
 	}
+	h.dispatcher = newDispatcher(defaultDispatchWorkers, defaultDispatchQueueSize, h.handleBroadcast)
+	return h
+}
+
+// SetDispatchSize sizes the inbound worker pool. It must be called before Run.
+func (h *Hub) SetDispatchSize(workers, queueSize int) {
+	h.dispatcher = newDispatcher(workers, queueSize, h.handleBroadcast)
 }
 
 func (h *Hub) Run() {
+	go h.runCluster()
+	go h.runPresence()
+	h.dispatcher.start()
+
 	for {
 		select {
 		case client := <-h.register:
 			h.registerClient(client)
 		case client := <-h.unregister:
 			h.unregisterClient(client)
-		case message := <-h.broadcast:
-			h.handleBroadcast(message)
 		}
 	}
 }
@@ -99,11 +126,16 @@ func (h *Hub) registerClient(client *Client) {
 	h.clients[client.userID] = append(h.clients[client.userID], client)
 	h.mu.Unlock()
 
-	ctx := context.Background()
-	h.redis.Set(ctx, userOnlineKey(client.userID), "1", 0)
+	h.presenceLog <- presenceEvent{userID: client.userID, deviceID: client.deviceID, connected: true}
 
-	onlineMsg, _ := NewNexyMessage(TypeOnline, client.userID, nil, OnlineBody{UserID: client.userID})
-	h.broadcastToAll(onlineMsg, h.unregisterClientFunc)
+	// Replay missed frames now that live ones are reaching the client's hold
+	if client.resumeFrom >= 0 {
+		go h.resumeStream(client, client.resumeFrom)
+	}
+
+	if h.calls != nil {
+		go h.calls.HandleConnect(client.userID, client.deviceID)
+	}
 
 	log.Printf("Client connected: user_id=%d, deviceID=%s, total_connections=%d", client.userID, client.deviceID, len(h.clients[client.userID]))
 }
@@ -126,27 +158,14 @@ func (h *Hub) unregisterClient(client *Client) {
 	client.closeConnection()
 	h.mu.Unlock()
 
-	ctx := context.Background()
+	h.presenceLog <- presenceEvent{userID: client.userID, deviceID: client.deviceID}
 
-	// Only mark user as offline if no more connections
-	h.mu.RLock()
-	hasMoreClients := len(h.clients[client.userID]) > 0
-	h.mu.RUnlock()
-
-	if !hasMoreClients {
-		h.redis.Del(ctx, userOnlineKey(client.userID))
-
-		// Update last seen when user disconnects
-		if err := h.userRepo.UpdateLastSeen(ctx, client.userID); err != nil {
-			log.Printf("Error updating last seen for user %d: %v", client.userID, err)
-		}
+	log.Printf("Client disconnected: user_id=%d, deviceID=%s", client.userID, client.deviceID)
 
-		offlineMsg, _ := NewNexyMessage(TypeOffline, client.userID, nil, OnlineBody{UserID: client.userID})
-		h.broadcastToAll(offlineMsg, h.unregisterClientFunc)
+	if h.calls != nil {
+		go h.calls.HandleDisconnect(client.userID, client.deviceID)
 	}
 
-	log.Printf("Client disconnected: user_id=%d, deviceID=%s", client.userID, client.deviceID)
-
 	// Check if user was typing in any chats and broadcast stop typing
 	chatIDs := h.clearTypingStatusForUser(client.userID)
 	for _, chatID := range chatIDs {
@@ -166,7 +185,7 @@ func (h *Hub) unregisterClient(client *Client) {
 			Body: bodyBytes,
 		}
 
-		go h.handleTypingMessage(stopTypingMsg, h.unregisterClientFunc)
+		go h.dispatcher.submit(stopTypingMsg)
 	}
 }
 
@@ -175,6 +194,10 @@ func (h *Hub) unregisterClientFunc(client *Client) {
 }
 
 func (h *Hub) handleBroadcast(message *NexyMessage) {
+	if !h.authorizeFrame(message) {
+		return
+	}
+
 	switch message.Header.Type {
 	case TypeChatMessage:
 		h.handleChatMessage(message, h.unregisterClientFunc)
@@ -185,7 +208,27 @@ func (h *Hub) handleBroadcast(message *NexyMessage) {
 	case TypeDelivered, TypeRead:
 		h.handleStatusMessage(message, h.unregisterClientFunc)
 	case TypeCallOffer, TypeCallAnswer, TypeICECandidate, TypeCallCancel, TypeCallEnd, TypeCallBusy:
-		h.handleSignalingMessage(message, h.unregisterClientFunc)
+		if h.calls != nil {
+			h.calls.HandleCallFrame(message)
+		} else {
+			h.handleSignalingMessage(message, h.unregisterClientFunc)
+		}
+	case TypeGroupCallJoin, TypeGroupCallLeave, TypeGroupCallMedia:
+		if h.calls != nil {
+			h.calls.HandleCallFrame(message)
+		}
+	case TypePresenceSubscribe, TypePresenceUnsubscribe:
+		h.handlePresenceSubscription(message)
+	case TypePresenceUpdate:
+		h.handlePresenceUpdate(message)
+	case TypeForward:
+		h.handleForward(message)
+	case TypePollVote:
+		h.handlePollVote(message)
+	case TypeLocationUpdate:
+		h.handleLocationUpdate(message)
+	case TypeLocationStop:
+		h.handleLocationStop(message)
 	}
 }
 
@@ -193,6 +236,7 @@ func (h *Hub) BroadcastEdit(msg *models.Message) {
 	editBody := EditMessageBody{
 		MessageID: msg.MessageID,
 		Content:   msg.Content,
+		Mentions:  msg.Mentions,
 	}
 	bodyBytes, _ := json.Marshal(editBody)
 
@@ -210,11 +254,29 @@ func (h *Hub) BroadcastEdit(msg *models.Message) {
 	h.broadcastToChatMembers(msg.ChatID, nexyMsg)
 }
 
+// BroadcastDelete tells every member, including the devices of whoever
+// deleted it, that a message was deleted for everyone
 func (h *Hub) BroadcastDelete(msg *models.Message) {
-	deleteBody := map[string]string{
-		"message_id": msg.MessageID,
+	bodyBytes, _ := json.Marshal(DeleteBody{MessageID: msg.MessageID})
+
+	nexyMsg := &NexyMessage{
+		Header: NexyHeader{
+			Type:      TypeDelete,
+			MessageID: msg.MessageID,
+			Timestamp: time.Now().Unix(),
+			SenderID:  msg.SenderID,
+			ChatID:    &msg.ChatID,
+		},
+		Body: bodyBytes,
 	}
-	bodyBytes, _ := json.Marshal(deleteBody)
+
+	h.BroadcastToChat(msg.ChatID, nexyMsg)
+}
+
+// BroadcastHide tells the user's devices that they deleted a message for
+// themselves
+func (h *Hub) BroadcastHide(userID int, msg *models.Message) {
+	bodyBytes, _ := json.Marshal(DeleteBody{MessageID: msg.MessageID, ForMe: true})
 
 	nexyMsg := &NexyMessage{
 		Header: NexyHeader{
@@ -227,7 +289,41 @@ func (h *Hub) BroadcastDelete(msg *models.Message) {
 		Body: bodyBytes,
 	}
 
-	h.broadcastToChatMembers(msg.ChatID, nexyMsg)
+	h.deliver([]int{userID}, nexyMsg, h.unregisterClientFunc)
+}
+
+// BroadcastSystemMessage delivers a server-generated chat message to every
+// member, including the sender's own devices
+func (h *Hub) BroadcastSystemMessage(msg *models.Message) {
+	body := ChatMessageBody{
+		Content:     msg.Content,
+		MessageType: msg.MessageType,
+		ServerID:    msg.ID,
+	}
+	bodyBytes, _ := json.Marshal(body)
+
+	nexyMsg := &NexyMessage{
+		Header: NexyHeader{
+			Type:      TypeChatMessage,
+			MessageID: msg.MessageID,
+			Timestamp: msg.CreatedAt.Unix(),
+			SenderID:  msg.SenderID,
+			ChatID:    &msg.ChatID,
+		},
+		Body: bodyBytes,
+	}
+
+	h.BroadcastToChat(msg.ChatID, nexyMsg)
+}
+
+// BroadcastToChat delivers a server-generated frame to every chat member
+func (h *Hub) BroadcastToChat(chatID int, message *NexyMessage) {
+	memberIDs, err := h.chatRepo.GetChatMembers(context.Background(), chatID)
+	if err != nil {
+		log.Printf("Error getting chat members: %v", err)
+		return
+	}
+	h.deliver(memberIDs, message, h.unregisterClientFunc)
 }
 
 func (h *Hub) BroadcastReactionAdd(chatID, messageID, userID int, emoji string) {
@@ -272,19 +368,28 @@ func (h *Hub) BroadcastReactionRemove(chatID, messageID, userID int, emoji strin
 	h.broadcastToChatMembers(chatID, nexyMsg)
 }
 
-func userOnlineKey(userID int) string {
-	return "user:online:" + string(rune(userID))
-}
-
 func (h *Hub) IsUserOnline(userID int) bool {
 	h.mu.RLock()
-	defer h.mu.RUnlock()
 	clients, online := h.clients[userID]
-	return online && len(clients) > 0
+	h.mu.RUnlock()
+	if online && len(clients) > 0 {
+		return true
+	}
+
+	count, err := h.redis.SCard(context.Background(), userOnlineKey(userID)).Result()
+	return err == nil && count > 0
 }
 
-// DisconnectBannedUser disconnects all connections for a banned user
+// DisconnectBannedUser disconnects all connections for a banned user on every node
 func (h *Hub) DisconnectBannedUser(userID int) {
+	h.disconnectLocal(userID)
+	h.publish(clusterBroadcastChannel, &clusterEnvelope{
+		Kind:    envelopeDisconnect,
+		UserIDs: []int{userID},
+	})
+}
+
+func (h *Hub) disconnectLocal(userID int) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
@@ -306,15 +411,15 @@ func (h *Hub) DisconnectBannedUser(userID int) {
 	// Remove all clients for this user
 	delete(h.clients, userID)
 
-	// Remove from Redis
-	ctx := context.Background()
-	h.redis.Del(ctx, userOnlineKey(userID))
+	// Remove this node from the user's presence
+	h.removePresence(userID, h.nodeID)
 }
 
 func (h *Hub) GetOnlineUserIDs() map[int]bool {
+	result := h.clusterOnlineUserIDs()
+
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	result := make(map[int]bool)
 	for userID, clients := range h.clients {
 		if len(clients) > 0 {
 			result[userID] = true
@@ -324,9 +429,13 @@ func (h *Hub) GetOnlineUserIDs() map[int]bool {
 }
 
 func (h *Hub) GetOnlineUserIDsForUsers(userIDs []int) map[int]bool {
+	result := make(map[int]bool)
+	for userID := range h.remoteNodes(userIDs) {
+		result[userID] = true
+	}
+
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	result := make(map[int]bool)
 	for _, userID := range userIDs {
 		if clients, online := h.clients[userID]; online && len(clients) > 0 {
 			result[userID] = true
@@ -338,15 +447,6 @@ func (h *Hub) GetOnlineUserIDsForUsers(userIDs []int) map[int]bool {
 func (h *Hub) NotifySessionTerminated(userID int, sessionID int, targetDeviceID string, reason string) {
 	log.Printf("NotifySessionTerminated: userID=%d, sessionID=%d, targetDeviceID=%s, reason=%s", userID, sessionID, targetDeviceID, reason)
 
-	h.mu.RLock()
-	clients, exists := h.clients[userID]
-	h.mu.RUnlock()
-
-	if !exists || len(clients) == 0 {
-		log.Printf("NotifySessionTerminated: user %d has no active WebSocket connection", userID)
-		return
-	}
-
 	terminatedBody := SessionTerminatedBody{
 		SessionID: sessionID,
 		Reason:    reason,
@@ -368,14 +468,40 @@ func (h *Hub) NotifySessionTerminated(userID int, sessionID int, targetDeviceID
 		return
 	}
 
+	if h.sendToDevice(userID, targetDeviceID, msgData) {
+		return
+	}
+
+	// The device may be connected to another node
+	nodes := h.remoteNodes([]int{userID})
+	if len(nodes[userID]) == 0 {
+		log.Printf("NotifySessionTerminated: target device %s not currently connected for user %d", targetDeviceID, userID)
+		return
+	}
+
+	for _, nodeID := range nodes[userID] {
+		h.publish(nodeChannel(nodeID), &clusterEnvelope{
+			Kind:     envelopeDevice,
+			UserIDs:  []int{userID},
+			DeviceID: targetDeviceID,
+			Message:  msg,
+		})
+	}
+}
+
+// sendToDevice writes data to one device of the user on this node
+func (h *Hub) sendToDevice(userID int, deviceID string, data []byte) bool {
+	h.mu.RLock()
+	clients := h.clients[userID]
+	h.mu.RUnlock()
+
 	// Send only to the specific device that was terminated
 	for _, client := range clients {
-		if client.deviceID == targetDeviceID {
-			log.Printf("NotifySessionTerminated: sending message to user %d, deviceID=%s: %s", userID, client.deviceID, string(msgData))
-			client.send <- msgData
-			return // Found the target device, exit
+		if client.deviceID == deviceID {
+			log.Printf("sendToDevice: sending message to user %d, deviceID=%s: %s", userID, client.deviceID, string(data))
+			client.queue(0, data)
+			return true
 		}
 	}
-
-	log.Printf("NotifySessionTerminated: target device %s not currently connected for user %d", targetDeviceID, userID)
+	return false
 }
@@ -0,0 +1,182 @@
+package nexy
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// LiveLocationSharer moves and stops live locations, applying the same checks
+// as the REST endpoints
+type LiveLocationSharer interface {
+	UpdateLiveLocation(ctx context.Context, messageID string, userID int, latitude, longitude float64, accuracy *float64) (*models.Message, error)
+	StopLiveLocation(ctx context.Context, messageID string, userID int) (*models.Message, error)
+}
+
+// minLocationInterval is the shortest gap between two accepted updates of one
+// live location. Updates coming in faster are dropped.
+const minLocationInterval = time.Second
+
+// maxTrackedLocations is how many rate limit entries build up before the
+// stale ones are dropped
+const maxTrackedLocations = 1024
+
+func (h *Hub) SetLiveLocations(sharer LiveLocationSharer) {
+	h.locations = sharer
+}
+
+// locationErrorCodes gives the sharer's plain refusals their error frame codes
+var locationErrorCodes = map[string]string{
+	"message not found":                        "not_found",
+	"message is not a location":                "not_a_location",
+	"only the sender can share their location": "not_sender",
+	"live location has ended":                  "location_ended",
+	"invalid coordinates":                      "invalid_location",
+}
+
+// withLocation replaces the location a client sent with the stored one, which
+// says until when it is live. Without a stored location the client's is
+// dropped.
+func (h *Hub) withLocation(ctx context.Context, body json.RawMessage, serverID int) json.RawMessage {
+	locations, err := h.messageRepo.GetLocations(ctx, []int{serverID})
+	if err != nil {
+		log.Printf("Error loading location of message %d: %v", serverID, err)
+		return withField(body, "location", nil)
+	}
+	loc, ok := locations[serverID]
+	if !ok {
+		return withField(body, "location", nil)
+	}
+	value, err := json.Marshal(loc)
+	if err != nil {
+		return withField(body, "location", nil)
+	}
+	return withField(body, "location", value)
+}
+
+// handleLocationUpdate moves the sender's live location. Updates stream in, so
+// they are not acked; the sender's devices get the broadcast like everyone
+// else and only failures are reported. Updates over the rate limit are
+// dropped, since the next one replaces them anyway.
+func (h *Hub) handleLocationUpdate(message *NexyMessage) {
+	senderID := message.Header.SenderID
+	if h.locations == nil {
+		return
+	}
+
+	var body LocationUpdateBody
+	if err := message.ParseBody(&body); err != nil {
+		log.Printf("Error parsing location update from user %d: %v", senderID, err)
+		return
+	}
+	if !h.allowLocationUpdate(body.MessageID) {
+		return
+	}
+
+	msg, err := h.locations.UpdateLiveLocation(context.Background(), body.MessageID, senderID, body.Latitude, body.Longitude, body.Accuracy)
+	if err != nil {
+		h.rejectLocationFrame(message, err)
+		return
+	}
+	h.BroadcastLocation(msg)
+}
+
+// handleLocationStop ends the sender's live location, acks the frame and
+// shares its final position
+func (h *Hub) handleLocationStop(message *NexyMessage) {
+	senderID := message.Header.SenderID
+	if h.locations == nil {
+		return
+	}
+
+	var body LocationStopBody
+	if err := message.ParseBody(&body); err != nil {
+		log.Printf("Error parsing location stop from user %d: %v", senderID, err)
+		return
+	}
+
+	msg, err := h.locations.StopLiveLocation(context.Background(), body.MessageID, senderID)
+	if err != nil {
+		h.rejectLocationFrame(message, err)
+		return
+	}
+
+	ack, _ := NewNexyMessage(TypeAck, 0, nil, AckBody{
+		MessageID: message.Header.MessageID,
+		ServerID:  msg.ID,
+		Status:    "ok",
+	})
+	h.sendToUser(senderID, ack, h.unregisterClientFunc)
+
+	h.BroadcastLocation(msg)
+}
+
+func (h *Hub) rejectLocationFrame(message *NexyMessage, err error) {
+	log.Printf("Rejected %s frame from user %d: %v", message.Header.Type, message.Header.SenderID, err)
+	h.sendFrameError(message, err, "location_failed", locationErrorCodes)
+}
+
+// allowLocationUpdate reports whether an update of the live location may go
+// through now, and if so counts it as the last one
+func (h *Hub) allowLocationUpdate(messageID string) bool {
+	h.locationMu.Lock()
+	defer h.locationMu.Unlock()
+
+	now := time.Now()
+	if last, ok := h.lastLocation[messageID]; ok && now.Sub(last) < minLocationInterval {
+		return false
+	}
+	h.lastLocation[messageID] = now
+
+	// Entries older than the interval no longer hold anything back, which
+	// also covers locations whose final update went out on another node
+	if len(h.lastLocation) > maxTrackedLocations {
+		for id, last := range h.lastLocation {
+			if now.Sub(last) >= minLocationInterval {
+				delete(h.lastLocation, id)
+			}
+		}
+	}
+	return true
+}
+
+// BroadcastLocation sends a location message's current position to every
+// member of its chat, the sender's devices included. Live is false once
+// sharing has stopped or run out. Positions while live are only worth having
+// as they happen, so they stay out of the streams; the final one is kept so
+// that every device learns sharing ended.
+func (h *Hub) BroadcastLocation(msg *models.Message) {
+	if msg.Location == nil {
+		return
+	}
+
+	body := LocationUpdateBody{
+		MessageID: msg.MessageID,
+		ServerID:  msg.ID,
+		Latitude:  msg.Location.Latitude,
+		Longitude: msg.Location.Longitude,
+		Accuracy:  msg.Location.Accuracy,
+		Live:      msg.Location.Live,
+	}
+	if msg.Location.LiveUntil != nil {
+		body.LiveUntil = msg.Location.LiveUntil.Unix()
+	}
+
+	update, err := NewNexyMessage(TypeLocationUpdate, msg.SenderID, &msg.ChatID, body)
+	if err != nil {
+		log.Printf("Error building location update for message %d: %v", msg.ID, err)
+		return
+	}
+
+	if msg.Location.Live {
+		update.ephemeral = true
+	} else {
+		h.locationMu.Lock()
+		delete(h.lastLocation, msg.MessageID)
+		h.locationMu.Unlock()
+	}
+	h.BroadcastToChat(msg.ChatID, update)
+}
@@ -0,0 +1,63 @@
+package nexy
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// MentionResolver works out whom a message mentions with the same rules as
+// REST edits. Refused mentions come back as errors with an ErrorCode.
+type MentionResolver interface {
+	ResolveMentions(ctx context.Context, chatID, senderID int, content string, explicit []models.MentionEntity, encrypted bool) ([]models.MentionEntity, error)
+}
+
+func (h *Hub) SetMentionResolver(resolver MentionResolver) {
+	h.mentions = resolver
+}
+
+// resolveMentions works out whom a chat message mentions from its content and
+// mention entities. Without a resolver the client's entities go out as sent.
+func (h *Hub) resolveMentions(ctx context.Context, chatID, senderID int, bodyJSON []byte) ([]models.MentionEntity, error) {
+	if h.mentions == nil {
+		return nil, nil
+	}
+	var body ChatMessageBody
+	if err := json.Unmarshal(bodyJSON, &body); err != nil {
+		return nil, nil
+	}
+	return h.mentions.ResolveMentions(ctx, chatID, senderID, body.Content, body.Mentions, body.Encryption != nil)
+}
+
+// withMentions replaces the body's mentions with the resolved ones
+func withMentions(body json.RawMessage, mentions []models.MentionEntity) json.RawMessage {
+	if len(mentions) == 0 {
+		return body
+	}
+	value, err := json.Marshal(mentions)
+	if err != nil {
+		return body
+	}
+	return withField(body, "mentions", value)
+}
+
+// mentionsUser reports whether a chat message body mentions the user
+func mentionsUser(body *ChatMessageBody, userID int) bool {
+	for _, mention := range body.Mentions {
+		if mention.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// chatMuted reports whether the user has muted the chat for now
+func (h *Hub) chatMuted(ctx context.Context, chatID, userID int) bool {
+	member, err := h.chatRepo.GetChatMember(ctx, chatID, userID)
+	if err != nil || member == nil || member.MutedUntil == nil {
+		return false
+	}
+	return member.MutedUntil.After(time.Now())
+}
@@ -0,0 +1,249 @@
+package nexy
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// normalize decodes JSON with integers as int64 and other numbers as float64,
+// so documents compare equal however their numbers were spelled
+func normalize(t *testing.T, data []byte) interface{} {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		t.Fatalf("decoding %s: %v", data, err)
+	}
+	return normalizeValue(v)
+}
+
+func normalizeValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+	case []interface{}:
+		for i := range val {
+			val[i] = normalizeValue(val[i])
+		}
+	case map[string]interface{}:
+		for k := range val {
+			val[k] = normalizeValue(val[k])
+		}
+	}
+	return v
+}
+
+func roundTrip(t *testing.T, doc string) []byte {
+	t.Helper()
+	packed, err := jsonToMsgpack([]byte(doc))
+	if err != nil {
+		t.Fatalf("jsonToMsgpack(%s): %v", doc, err)
+	}
+	out, err := msgpackToJSON(packed)
+	if err != nil {
+		t.Fatalf("msgpackToJSON(%x): %v", packed, err)
+	}
+	return out
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{"empty object", `{}`},
+		{"empty array", `[]`},
+		{"scalars", `{"null":null,"true":true,"false":false,"str":"hi"}`},
+		{"nested objects", `{"header":{"type":"chat_message","chat_id":7,"seq":12},"body":{"content":"x","mentions":[{"user_id":1,"offset":0,"length":3}],"poll":{"options":["a","b"],"quiz":false}}}`},
+		{"deep nesting", strings.Repeat(`{"a":[`, 20) + `1` + strings.Repeat(`]}`, 20)},
+		{"fixint bounds", `[0,127,128,255,256,65535,65536,4294967295,4294967296]`},
+		{"negative int bounds", `[-1,-32,-33,-128,-129,-32768,-32769,-2147483648,-2147483649]`},
+		{"int64 limits", `[9223372036854775807,-9223372036854775808,9007199254740993]`},
+		{"floats", `[1.5,-0.25,1e300,-1e-300,3.141592653589793,0.1]`},
+		{"beyond int64", `[18446744073709551615]`},
+		{"unicode strings", `["","é","日本語","😀",` + `"\u0000\n\t\""]`},
+		{"string lengths", `["` + strings.Repeat("a", 31) + `","` + strings.Repeat("b", 32) + `","` + strings.Repeat("c", 255) + `","` + strings.Repeat("d", 256) + `","` + strings.Repeat("e", 65536) + `"]`},
+		{"large array", `[` + strings.TrimSuffix(strings.Repeat("1,", 70000), ",") + `]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := roundTrip(t, tt.doc)
+			if want, got := normalize(t, []byte(tt.doc)), normalize(t, out); !reflect.DeepEqual(want, got) {
+				t.Errorf("round trip of %.200s gave %.200s", tt.doc, out)
+			}
+		})
+	}
+}
+
+func TestMsgpackLargeMap(t *testing.T) {
+	fields := make(map[string]int, 70000)
+	for i := 0; i < 70000; i++ {
+		fields[strings.Repeat("k", i%5+1)+string(rune('a'+i%26))+hex.EncodeToString([]byte{byte(i >> 16), byte(i >> 8), byte(i)})] = i
+	}
+	doc, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := roundTrip(t, string(doc))
+	if want, got := normalize(t, doc), normalize(t, out); !reflect.DeepEqual(want, got) {
+		t.Error("round trip of a map with 70000 keys changed it")
+	}
+}
+
+func TestJSONToMsgpackEncoding(t *testing.T) {
+	tests := []struct {
+		doc  string
+		want string
+	}{
+		{`null`, "c0"},
+		{`true`, "c3"},
+		{`false`, "c2"},
+		{`0`, "00"},
+		{`127`, "7f"},
+		{`128`, "cc80"},
+		{`256`, "cd0100"},
+		{`65536`, "ce00010000"},
+		{`4294967296`, "cf0000000100000000"},
+		{`-1`, "ff"},
+		{`-32`, "e0"},
+		{`-33`, "d0df"},
+		{`-129`, "d1ff7f"},
+		{`-32769`, "d2ffff7fff"},
+		{`-2147483649`, "d3ffffffff7fffffff"},
+		{`1.5`, "cb3ff8000000000000"},
+		{`""`, "a0"},
+		{`"é"`, "a2c3a9"},
+		{`"` + strings.Repeat("a", 31) + `"`, "bf" + strings.Repeat("61", 31)},
+		{`"` + strings.Repeat("a", 32) + `"`, "d920" + strings.Repeat("61", 32)},
+		{`"` + strings.Repeat("a", 256) + `"`, "da0100" + strings.Repeat("61", 256)},
+		{`[]`, "90"},
+		{`[` + strings.TrimSuffix(strings.Repeat("1,", 16), ",") + `]`, "dc0010" + strings.Repeat("01", 16)},
+		{`{"b":1,"a":2}`, "82a16102a16201"}, // Keys are sorted
+	}
+
+	for _, tt := range tests {
+		got, err := jsonToMsgpack([]byte(tt.doc))
+		if err != nil {
+			t.Errorf("jsonToMsgpack(%.40s): %v", tt.doc, err)
+			continue
+		}
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("jsonToMsgpack(%.40s) = %.80x, want %.80s", tt.doc, got, tt.want)
+		}
+	}
+}
+
+func TestMsgpackToJSONDecoding(t *testing.T) {
+	tests := []struct {
+		name   string
+		packed string
+		want   string
+	}{
+		{"bin8 as base64", "c403010203", `"AQID"`},
+		{"empty bin8", "c400", `""`},
+		{"bin16", "c50002ffee", `"/+4="`},
+		{"str8", "d903616263", `"abc"`},
+		{"str16", "da0002c3a9", `"é"`},
+		{"str32", "db00000001" + "7a", `"z"`},
+		{"float32", "ca3fc00000", `1.5`},
+		{"uint64 beyond int64", "cfffffffffffffffff", `18446744073709552000`},
+		{"int8", "d080", `-128`},
+		{"int64 min", "d38000000000000000", `-9223372036854775808`},
+		{"uint8 as int", "ccff", `255`},
+		{"non-string map key", "810102", `{"1":2}`},
+		{"map16", "de0001a16101", `{"a":1}`},
+		{"array16", "dc0002c0c3", `[null,true]`},
+		{"nested", "82a16181a162920102a163c0", `{"a":{"b":[1,2]},"c":null}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packed, err := hex.DecodeString(tt.packed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := msgpackToJSON(packed)
+			if err != nil {
+				t.Fatalf("msgpackToJSON(%s): %v", tt.packed, err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("msgpackToJSON(%s) = %s, want %s", tt.packed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMsgpackToJSONRejectsMalformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		packed string
+	}{
+		{"empty", ""},
+		{"truncated uint16", "cd01"},
+		{"truncated float64", "cb3ff8"},
+		{"truncated fixstr", "a3616263"[:6]},
+		{"str8 longer than input", "d9ff61"},
+		{"bin8 longer than input", "c40501"},
+		{"array longer than input", "dc0005c0"},
+		{"map longer than input", "82a16101"},
+		{"huge array32 header", "ddffffffff"},
+		{"huge map32 header", "dfffffffff"},
+		{"trailing data", "c0c0"},
+		{"unsupported ext", "d40100"},
+		{"reserved type byte", "c1"},
+		{"too deep", strings.Repeat("91", msgpackMaxDepth+1) + "c0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packed, err := hex.DecodeString(tt.packed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out, err := msgpackToJSON(packed); err == nil {
+				t.Errorf("msgpackToJSON(%s) = %s, want an error", tt.packed, out)
+			}
+		})
+	}
+}
+
+func TestMsgpackMaxDepthAllowed(t *testing.T) {
+	packed, _ := hex.DecodeString(strings.Repeat("91", msgpackMaxDepth) + "c0")
+	if _, err := msgpackToJSON(packed); err != nil {
+		t.Errorf("nesting of %d arrays refused: %v", msgpackMaxDepth, err)
+	}
+}
+
+func TestJSONToMsgpackRejectsInvalidJSON(t *testing.T) {
+	for _, doc := range []string{``, `{`, `{"a":}`, `[1,]`} {
+		if _, err := jsonToMsgpack([]byte(doc)); err == nil {
+			t.Errorf("jsonToMsgpack(%q) succeeded", doc)
+		}
+	}
+}
+
+func TestMsgpackFloatPrecision(t *testing.T) {
+	for _, f := range []float64{math.MaxFloat64, math.SmallestNonzeroFloat64, -math.MaxFloat64, 0.1 + 0.2} {
+		doc, _ := json.Marshal([]float64{f})
+		out := roundTrip(t, string(doc))
+		var got []float64
+		if err := json.Unmarshal(out, &got); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0] != f {
+			t.Errorf("round trip of %v gave %s", f, out)
+		}
+	}
+}
@@ -3,44 +3,75 @@ package nexy
 import (
 	"encoding/json"
 	"time"
+
+	"github.com/vtstv/nexy/internal/models"
 )
 
 const (
-	ProtocolVersion = "1.0"
+	ProtocolVersion = "1.1"
 )
 
 type MessageType string
 
 const (
-	TypeChatMessage       MessageType = "chat_message"
-	TypeChatCreated       MessageType = "chat_created"
-	TypeAddedToGroup      MessageType = "added_to_group"
-	TypeKickedFromGroup   MessageType = "kicked_from_group"
-	TypeBannedFromGroup   MessageType = "banned_from_group"
-	TypeTyping            MessageType = "typing"
-	TypeDelivered         MessageType = "delivered"
-	TypeRead              MessageType = "read"
-	TypeEdit              MessageType = "edit"
-	TypeDelete            MessageType = "delete"
-	TypeReactionAdd       MessageType = "reaction_add"
-	TypeReactionRemove    MessageType = "reaction_remove"
-	TypeOnline            MessageType = "online"
-	TypeOffline           MessageType = "offline"
-	TypeHeartbeat         MessageType = "heartbeat"
-	TypeAck               MessageType = "ack"
-	TypeError             MessageType = "error"
-	TypeCallOffer         MessageType = "call_offer"
-	TypeCallAnswer        MessageType = "call_answer"
-	TypeICECandidate      MessageType = "ice_candidate"
-	TypeCallCancel        MessageType = "call_cancel"
-	TypeCallEnd           MessageType = "call_end"
-	TypeCallBusy          MessageType = "call_busy"
-	TypeSessionTerminated MessageType = "session_terminated"
+	TypeChatMessage         MessageType = "chat_message"
+	TypeChatCreated         MessageType = "chat_created"
+	TypeAddedToGroup        MessageType = "added_to_group"
+	TypeKickedFromGroup     MessageType = "kicked_from_group"
+	TypeBannedFromGroup     MessageType = "banned_from_group"
+	TypeTyping              MessageType = "typing"
+	TypeDelivered           MessageType = "delivered"
+	TypeRead                MessageType = "read"
+	TypeEdit                MessageType = "edit"
+	TypeDelete              MessageType = "delete"
+	TypeReactionAdd         MessageType = "reaction_add"
+	TypeReactionRemove      MessageType = "reaction_remove"
+	TypeOnline              MessageType = "online"
+	TypeOffline             MessageType = "offline"
+	TypeHeartbeat           MessageType = "heartbeat"
+	TypeAck                 MessageType = "ack"
+	TypeError               MessageType = "error"
+	TypeCallOffer           MessageType = "call_offer"
+	TypeCallAnswer          MessageType = "call_answer"
+	TypeICECandidate        MessageType = "ice_candidate"
+	TypeCallCancel          MessageType = "call_cancel"
+	TypeCallEnd             MessageType = "call_end"
+	TypeCallBusy            MessageType = "call_busy"
+	TypeSessionTerminated   MessageType = "session_terminated"
+	TypeResumed             MessageType = "resumed"
+	TypeResyncRequired      MessageType = "resync_required"
+	TypeHello               MessageType = "hello"
+	TypeWelcome             MessageType = "welcome"
+	TypePresence            MessageType = "presence"
+	TypePresenceSubscribe   MessageType = "presence_subscribe"
+	TypePresenceUnsubscribe MessageType = "presence_unsubscribe"
+	TypePresenceUpdate      MessageType = "presence_update"
+	TypeGroupCallJoin       MessageType = "group_call_join"
+	TypeGroupCallLeave      MessageType = "group_call_leave"
+	TypeGroupCallMedia      MessageType = "group_call_media"
+	TypeGroupCallState      MessageType = "group_call_state"
+	TypeForward             MessageType = "forward"
+	TypeMessagePinned       MessageType = "message_pinned"
+	TypeMessageUnpinned     MessageType = "message_unpinned"
+	TypeThreadUpdate        MessageType = "thread_update"
+	TypePollVote            MessageType = "poll_vote"
+	TypePollUpdate          MessageType = "poll_update"
+	TypeLocationUpdate      MessageType = "location_update"
+	TypeLocationStop        MessageType = "location_stop"
 )
 
 type NexyMessage struct {
 	Header NexyHeader      `json:"header"`
 	Body   json.RawMessage `json:"body"`
+
+	senderDevice string // Device the frame arrived from, set by the read pump
+	ephemeral    bool   // Only worth having live, like ephemeralTypes
+}
+
+// SenderDevice returns the device ID of the connection that sent the frame,
+// or "" for frames created by the server
+func (m *NexyMessage) SenderDevice() string {
+	return m.senderDevice
 }
 
 type NexyHeader struct {
@@ -51,6 +82,7 @@ type NexyHeader struct {
 	SenderID    int         `json:"sender_id,omitempty"`
 	RecipientID *int        `json:"recipient_id,omitempty"`
 	ChatID      *int        `json:"chat_id,omitempty"`
+	Seq         int64       `json:"seq,omitempty"` // Position in the recipient's replayable stream
 }
 
 type ChatMessageBody struct {
@@ -60,13 +92,65 @@ type ChatMessageBody struct {
 	MediaURL    string      `json:"media_url,omitempty"`
 	MediaType   string      `json:"media_type,omitempty"`
 	FileSize    *int64      `json:"file_size,omitempty"`
+	Duration    *int        `json:"duration,omitempty"`
 	ReplyToID   *int        `json:"reply_to_id,omitempty"`
 	Encryption  *Encryption `json:"encryption,omitempty"`
+	TTL         *int        `json:"ttl,omitempty"` // Seconds until the message disappears
+
+	// Users the message mentions. Clients may send explicit entities; the
+	// server adds the users named with @username.
+	Mentions []models.MentionEntity `json:"mentions,omitempty"`
+
+	// A models.NewPoll from clients, replaced by the stored models.Poll
+	Poll json.RawMessage `json:"poll,omitempty"`
+
+	// A models.NewLocation from clients, replaced by the stored models.Location
+	Location json.RawMessage `json:"location,omitempty"`
+
+	// Set by the server on forwarded messages
+	Forward *models.ForwardInfo `json:"forward,omitempty"`
+}
+
+type Encryption = models.MessageEncryption
+
+// ForwardBody copies existing messages into one or more chats. Each copy
+// arrives as a chat_message frame carrying the original attribution.
+type ForwardBody struct {
+	MessageIDs []string `json:"message_ids"`
+	ChatIDs    []int    `json:"chat_ids"`
 }
 
-type Encryption struct {
-	Algorithm string `json:"algorithm"`
-	KeyID     string `json:"key_id,omitempty"`
+// PollVoteBody votes in the poll of a message, given by server ID or UUID.
+// Empty options withdraw the vote.
+type PollVoteBody struct {
+	MessageID string `json:"message_id"`
+	Options   []int  `json:"options"`
+}
+
+// PollUpdateBody carries a poll's results after a vote or its closing
+type PollUpdateBody struct {
+	MessageID string       `json:"message_id"`
+	ServerID  int          `json:"server_id"`
+	Poll      *models.Poll `json:"poll"`
+}
+
+// LocationUpdateBody moves a live location. Clients send the message, by
+// server ID or UUID, and the new position; the server broadcasts it with the
+// message UUID, its server ID and whether it is still live.
+type LocationUpdateBody struct {
+	MessageID string   `json:"message_id"`
+	ServerID  int      `json:"server_id,omitempty"`
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Accuracy  *float64 `json:"accuracy,omitempty"`
+	Live      bool     `json:"live"`
+	LiveUntil int64    `json:"live_until,omitempty"` // Unix seconds
+}
+
+// LocationStopBody stops sharing the live location of a message, given by
+// server ID or UUID
+type LocationStopBody struct {
+	MessageID string `json:"message_id"`
 }
 
 type TypingBody struct {
@@ -88,13 +172,64 @@ type ReactionBody struct {
 	UserID    int    `json:"user_id"`
 }
 
+// ThreadUpdateBody carries a message's reply counters after a new reply.
+// Unread counts are per user and left to the client.
+type ThreadUpdateBody struct {
+	MessageID         int   `json:"message_id"` // Server ID of the message replied to
+	ReplyCount        int   `json:"reply_count"`
+	LastReplyID       int   `json:"last_reply_id"`
+	LastReplySenderID int   `json:"last_reply_sender_id"`
+	LastReplyAt       int64 `json:"last_reply_at"`
+}
+
+// PinBody announces a pin change. ForMe marks a pin kept on the sender's
+// side of a private chat only, which no other member is told about.
+type PinBody struct {
+	MessageID string `json:"message_id"`
+	ServerID  int    `json:"server_id"`
+	ForMe     bool   `json:"for_me,omitempty"`
+}
+
+// EditMessageBody carries a message's new content. Mentions are the explicit
+// mention entities of the new text, and once the edit is stored, all of them.
 type EditMessageBody struct {
+	MessageID string                 `json:"message_id"`
+	Content   string                 `json:"content"`
+	Mentions  []models.MentionEntity `json:"mentions"`
+}
+
+// DeleteBody announces a deleted message. ForMe marks a message the user hid
+// from their own history only, which no other member is told about.
+type DeleteBody struct {
 	MessageID string `json:"message_id"`
-	Content   string `json:"content"`
+	ForMe     bool   `json:"for_me,omitempty"`
 }
 
 type OnlineBody struct {
-	UserID int `json:"user_id"`
+	UserID       int                  `json:"user_id"`
+	State        string               `json:"state,omitempty"` // online, away, dnd or offline
+	CustomStatus *models.CustomStatus `json:"custom_status,omitempty"`
+}
+
+type PresenceSubscribeBody struct {
+	UserIDs []int `json:"user_ids"`
+}
+
+// PresenceBody is the current presence of a user, sent when subscribing
+type PresenceBody struct {
+	UserID       int                  `json:"user_id"`
+	IsOnline     bool                 `json:"is_online"`
+	Status       string               `json:"status"` // Privacy-filtered text, e.g. "last seen recently"
+	State        string               `json:"state,omitempty"`
+	CustomStatus *models.CustomStatus `json:"custom_status,omitempty"`
+}
+
+// PresenceUpdateBody changes the sender's own presence. Clients report away
+// when idle and online when active again.
+type PresenceUpdateBody struct {
+	State             string               `json:"state,omitempty"`
+	CustomStatus      *models.CustomStatus `json:"custom_status,omitempty"`
+	ClearCustomStatus bool                 `json:"clear_custom_status,omitempty"`
 }
 
 type ChatCreatedBody struct {
@@ -128,11 +263,27 @@ type AckBody struct {
 	ServerID  int    `json:"server_id,omitempty"`
 	Status    string `json:"status"`
 	Error     string `json:"error,omitempty"`
+	Code      string `json:"code,omitempty"` // Why an error ack refused the message
+}
+
+// HelloBody is sent by the client right after connecting
+type HelloBody struct {
+	Version      string       `json:"version"` // Highest protocol version the client speaks
+	Capabilities []Capability `json:"capabilities"`
+}
+
+// WelcomeBody answers a hello with the agreed version and capabilities
+type WelcomeBody struct {
+	Version       string       `json:"version"`
+	ServerVersion string       `json:"server_version"`
+	MinVersion    string       `json:"min_version"`
+	Capabilities  []Capability `json:"capabilities"`
 }
 
 type ErrorBody struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	MessageID string `json:"message_id,omitempty"` // Rejected frame, if any
 }
 
 type CallOfferBody struct {
@@ -157,11 +308,43 @@ type CallCancelBody struct {
 	Reason string `json:"reason,omitempty"`
 }
 
+// GroupCallMediaBody is sent with group_call_join and group_call_media, the
+// group being Header.ChatID
+type GroupCallMediaBody struct {
+	Muted bool `json:"muted"`
+	Video bool `json:"video"`
+}
+
+// GroupCallStateBody is broadcast to the group whenever someone joins, leaves
+// or changes their media. Active is false once the last participant leaves.
+type GroupCallStateBody struct {
+	ChatID       int                    `json:"chat_id"`
+	CallID       string                 `json:"call_id"`
+	Active       bool                   `json:"active"`
+	Participants []GroupCallParticipant `json:"participants"`
+}
+
+type GroupCallParticipant struct {
+	UserID   int   `json:"user_id"`
+	Muted    bool  `json:"muted"`
+	Video    bool  `json:"video"`
+	JoinedAt int64 `json:"joined_at"`
+}
+
 type SessionTerminatedBody struct {
 	SessionID int    `json:"session_id"`
 	Reason    string `json:"reason"`
 }
 
+type ResumedBody struct {
+	Seq      int64 `json:"seq"`
+	Replayed int   `json:"replayed"`
+}
+
+type ResyncRequiredBody struct {
+	Seq int64 `json:"seq"`
+}
+
 func NewNexyMessage(msgType MessageType, senderID int, chatID *int, body interface{}) (*NexyMessage, error) {
 	bodyBytes, err := json.Marshal(body)
 	if err != nil {
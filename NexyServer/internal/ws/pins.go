@@ -0,0 +1,44 @@
+package nexy
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// BroadcastPin announces a new pin. A shared pin goes to every member, a
+// pin kept on one side of a private chat only to that user's devices.
+func (h *Hub) BroadcastPin(userID int, msg *models.Message, forMe bool) {
+	h.broadcastPinChange(TypeMessagePinned, userID, msg, forMe)
+}
+
+// BroadcastUnpin announces a removed pin to the same audience as BroadcastPin
+func (h *Hub) BroadcastUnpin(userID int, msg *models.Message, forMe bool) {
+	h.broadcastPinChange(TypeMessageUnpinned, userID, msg, forMe)
+}
+
+func (h *Hub) broadcastPinChange(msgType MessageType, userID int, msg *models.Message, forMe bool) {
+	bodyBytes, _ := json.Marshal(PinBody{
+		MessageID: msg.MessageID,
+		ServerID:  msg.ID,
+		ForMe:     forMe,
+	})
+
+	nexyMsg := &NexyMessage{
+		Header: NexyHeader{
+			Type:      msgType,
+			MessageID: msg.MessageID,
+			Timestamp: time.Now().Unix(),
+			SenderID:  userID,
+			ChatID:    &msg.ChatID,
+		},
+		Body: bodyBytes,
+	}
+
+	if forMe {
+		h.deliver([]int{userID}, nexyMsg, h.unregisterClientFunc)
+		return
+	}
+	h.BroadcastToChat(msg.ChatID, nexyMsg)
+}
@@ -0,0 +1,129 @@
+package nexy
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// PollVoter casts votes in polls, applying the same checks as the REST vote
+// endpoint
+type PollVoter interface {
+	VotePoll(ctx context.Context, messageID string, userID int, options []int) (*models.Message, error)
+}
+
+func (h *Hub) SetPollVoter(voter PollVoter) {
+	h.polls = voter
+}
+
+// pollErrorCodes gives the voter's plain refusals their error frame codes
+var pollErrorCodes = map[string]string{
+	"message not found":                "not_found",
+	"message is not a poll":            "not_a_poll",
+	"poll is closed":                   "poll_closed",
+	"quiz already answered":            "quiz_answered",
+	"quiz answers cannot be withdrawn": "invalid_vote",
+	"only one option can be chosen":    "invalid_vote",
+	"invalid poll option":              "invalid_vote",
+}
+
+// withPoll replaces the poll a client sent with the stored one, results
+// included. Without a stored poll the client's is dropped, so a quiz's answer
+// never goes out as sent.
+func (h *Hub) withPoll(ctx context.Context, body json.RawMessage, serverID int) json.RawMessage {
+	polls, err := h.messageRepo.GetPolls(ctx, []int{serverID}, 0)
+	if err != nil {
+		log.Printf("Error loading poll of message %d: %v", serverID, err)
+		return withField(body, "poll", nil)
+	}
+	poll, ok := polls[serverID]
+	if !ok {
+		return withField(body, "poll", nil)
+	}
+	value, err := json.Marshal(poll)
+	if err != nil {
+		return withField(body, "poll", nil)
+	}
+	return withField(body, "poll", value)
+}
+
+// handlePollVote votes on behalf of the sender, acks the frame and shares the
+// new results
+func (h *Hub) handlePollVote(message *NexyMessage) {
+	senderID := message.Header.SenderID
+	if h.polls == nil {
+		return
+	}
+
+	var body PollVoteBody
+	if err := message.ParseBody(&body); err != nil {
+		log.Printf("Error parsing poll vote from user %d: %v", senderID, err)
+		return
+	}
+
+	msg, err := h.polls.VotePoll(context.Background(), body.MessageID, senderID, body.Options)
+	if err != nil {
+		log.Printf("Rejected poll vote from user %d: %v", senderID, err)
+		h.sendFrameError(message, err, "poll_vote_failed", pollErrorCodes)
+		return
+	}
+
+	ack, _ := NewNexyMessage(TypeAck, 0, nil, AckBody{
+		MessageID: message.Header.MessageID,
+		ServerID:  msg.ID,
+		Status:    "ok",
+	})
+	h.sendToUser(senderID, ack, h.unregisterClientFunc)
+
+	h.BroadcastPollUpdate(msg, senderID)
+}
+
+// BroadcastPollUpdate sends a poll's new results to every member of its chat.
+// userID, who just voted on or closed it, gets their own view on all their
+// devices; the others get results without anyone's votes or a quiz's answer
+// while it is open.
+func (h *Hub) BroadcastPollUpdate(msg *models.Message, userID int) {
+	if msg.Poll == nil {
+		return
+	}
+
+	shared := *msg.Poll
+	shared.MyVotes = nil
+	if shared.Quiz && !shared.Closed {
+		shared.CorrectOption = nil
+	}
+
+	memberIDs, err := h.chatRepo.GetChatMembers(context.Background(), msg.ChatID)
+	if err != nil {
+		log.Printf("Error getting chat members: %v", err)
+		return
+	}
+	others := make([]int, 0, len(memberIDs))
+	for _, memberID := range memberIDs {
+		if memberID != userID {
+			others = append(others, memberID)
+		}
+	}
+
+	if update := pollUpdate(msg, &shared); update != nil {
+		h.deliver(others, update, h.unregisterClientFunc)
+	}
+	if update := pollUpdate(msg, msg.Poll); update != nil {
+		h.deliver([]int{userID}, update, h.unregisterClientFunc)
+	}
+}
+
+func pollUpdate(msg *models.Message, poll *models.Poll) *NexyMessage {
+	update, err := NewNexyMessage(TypePollUpdate, 0, &msg.ChatID, PollUpdateBody{
+		MessageID: msg.MessageID,
+		ServerID:  msg.ID,
+		Poll:      poll,
+	})
+	if err != nil {
+		log.Printf("Error building poll update for message %d: %v", msg.ID, err)
+		return nil
+	}
+	return update
+}
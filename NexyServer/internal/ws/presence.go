@@ -0,0 +1,294 @@
+package nexy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/vtstv/nexy/internal/models"
+)
+
+const (
+	presenceSubscriptionTTL    = time.Hour
+	maxPresenceSubscriptionIDs = 100
+	presenceQueueSize          = 1024
+)
+
+// presenceEvent is a socket of a user connecting or going away on this node
+type presenceEvent struct {
+	userID    int
+	deviceID  string
+	connected bool
+}
+
+// PresenceService decides who may see a user's presence
+type PresenceService interface {
+	PresenceAudience(ctx context.Context, userID int, subscriberIDs []int) ([]int, bool, error)
+	PresenceStatus(ctx context.Context, viewerID, targetID int, isOnline bool) (string, error)
+	CurrentPresence(ctx context.Context, userID int, isOnline bool) (string, *models.CustomStatus, error)
+	SetPresence(ctx context.Context, userID int, state string) error
+	SetCustomStatus(ctx context.Context, userID int, status *models.CustomStatus) error
+}
+
+func (h *Hub) SetPresenceService(presence PresenceService) {
+	h.presence = presence
+}
+
+// presenceSubscribersKey holds the users following targetID's presence explicitly
+func presenceSubscribersKey(targetID int) string {
+	return fmt.Sprintf("nexy:presence:subs:%d", targetID)
+}
+
+// presenceSubscriptionsKey is the reverse index, used to clean up when the viewer leaves
+func presenceSubscriptionsKey(viewerID int) string {
+	return fmt.Sprintf("nexy:presence:subscribed:%d", viewerID)
+}
+
+// runPresence applies connects and disconnects to the cluster presence, the
+// device streams and the database, away from the register loop. Events are
+// handled one at a time in the order they happened, so a quick reconnect
+// never ends up offline.
+func (h *Hub) runPresence() {
+	for event := range h.presenceLog {
+		if event.connected {
+			h.addPresence(event.userID)
+			h.touchStream(event.userID, event.deviceID)
+			h.publishPresence(event.userID)
+			continue
+		}
+
+		// Only mark user as offline if no more connections on any node. The
+		// sockets are counted now, not when the event was queued, so a
+		// connect that came in since keeps the user online.
+		h.mu.RLock()
+		hasMoreClients := len(h.clients[event.userID]) > 0
+		h.mu.RUnlock()
+
+		if !hasMoreClients && h.removePresence(event.userID, h.nodeID) {
+			// Update last seen when user disconnects
+			if err := h.userRepo.UpdateLastSeen(context.Background(), event.userID); err != nil {
+				log.Printf("Error updating last seen for user %d: %v", event.userID, err)
+			}
+			h.publishPresence(event.userID)
+			h.clearPresenceSubscriptions(event.userID)
+		}
+		h.touchStream(event.userID, event.deviceID)
+	}
+}
+
+// publishPresence pushes userID's current presence to their audience and
+// explicit subscribers. It reads the state at send time, so concurrent
+// connects and disconnects settle on the right final event.
+func (h *Hub) publishPresence(userID int) {
+	if h.presence == nil {
+		return
+	}
+
+	ctx := context.Background()
+
+	var subscriberIDs []int
+	subscribers, err := h.redis.SMembers(ctx, presenceSubscribersKey(userID)).Result()
+	if err != nil {
+		log.Printf("Error getting presence subscribers for user %d: %v", userID, err)
+	}
+	for _, idStr := range subscribers {
+		if id, err := strconv.Atoi(idStr); err == nil {
+			subscriberIDs = append(subscriberIDs, id)
+		}
+	}
+
+	audience, hidden, err := h.presence.PresenceAudience(ctx, userID, subscriberIDs)
+	if err != nil {
+		log.Printf("Error getting presence audience for user %d: %v", userID, err)
+		return
+	}
+	// Hidden status: nobody gets it, subscribers included
+	if hidden {
+		return
+	}
+
+	recipients := make(map[int]bool, len(audience))
+	for _, id := range audience {
+		recipients[id] = true
+	}
+	delete(recipients, userID)
+
+	ids := make([]int, 0, len(recipients))
+	for id := range recipients {
+		ids = append(ids, id)
+	}
+
+	online := h.GetOnlineUserIDsForUsers(ids)
+	targets := make([]int, 0, len(online))
+	for _, id := range ids {
+		if online[id] {
+			targets = append(targets, id)
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	state, customStatus, err := h.presence.CurrentPresence(ctx, userID, h.IsUserOnline(userID))
+	if err != nil {
+		log.Printf("Error getting presence of user %d: %v", userID, err)
+		return
+	}
+
+	msgType := TypeOnline
+	if state == models.PresenceOffline {
+		msgType = TypeOffline
+	}
+
+	msg, _ := NewNexyMessage(msgType, userID, nil, OnlineBody{
+		UserID:       userID,
+		State:        state,
+		CustomStatus: customStatus,
+	})
+	h.deliver(targets, msg, h.unregisterClientFunc)
+}
+
+// PublishPresence pushes a user's presence after it changed outside the socket, e.g. over REST
+func (h *Hub) PublishPresence(userID int) {
+	go h.publishPresence(userID)
+}
+
+// handlePresenceUpdate stores the sender's new state or custom status and
+// pushes it to their audience
+func (h *Hub) handlePresenceUpdate(message *NexyMessage) {
+	if h.presence == nil {
+		return
+	}
+
+	var body PresenceUpdateBody
+	if err := message.ParseBody(&body); err != nil {
+		log.Printf("Error unmarshaling presence update: %v", err)
+		return
+	}
+
+	ctx := context.Background()
+	userID := message.Header.SenderID
+
+	var err error
+	if body.State != "" {
+		err = h.presence.SetPresence(ctx, userID, body.State)
+	}
+	if err == nil && (body.CustomStatus != nil || body.ClearCustomStatus) {
+		err = h.presence.SetCustomStatus(ctx, userID, body.CustomStatus)
+	}
+
+	if err != nil {
+		log.Printf("Rejected presence update from user %d: %v", userID, err)
+		errorMsg, _ := NewNexyMessage(TypeError, 0, nil, ErrorBody{
+			Code:      "invalid_presence",
+			Message:   err.Error(),
+			MessageID: message.Header.MessageID,
+		})
+		h.sendToUser(userID, errorMsg, h.unregisterClientFunc)
+		return
+	}
+
+	h.publishPresence(userID)
+}
+
+// handlePresenceSubscription follows or unfollows specific users' presence,
+// e.g. while the viewer has their profile open
+func (h *Hub) handlePresenceSubscription(message *NexyMessage) {
+	var body PresenceSubscribeBody
+	if err := message.ParseBody(&body); err != nil {
+		log.Printf("Error unmarshaling presence subscription: %v", err)
+		return
+	}
+
+	viewerID := message.Header.SenderID
+	userIDs := body.UserIDs
+	if len(userIDs) > maxPresenceSubscriptionIDs {
+		userIDs = userIDs[:maxPresenceSubscriptionIDs]
+	}
+
+	ctx := context.Background()
+
+	if message.Header.Type == TypePresenceUnsubscribe {
+		pipe := h.redis.Pipeline()
+		for _, targetID := range userIDs {
+			pipe.SRem(ctx, presenceSubscribersKey(targetID), viewerID)
+			pipe.SRem(ctx, presenceSubscriptionsKey(viewerID), targetID)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Printf("Error removing presence subscriptions for user %d: %v", viewerID, err)
+		}
+		return
+	}
+
+	if h.presence == nil {
+		return
+	}
+
+	online := h.GetOnlineUserIDsForUsers(userIDs)
+
+	for _, targetID := range userIDs {
+		if targetID == viewerID {
+			continue
+		}
+
+		status, err := h.presence.PresenceStatus(ctx, viewerID, targetID, online[targetID])
+		if err != nil {
+			log.Printf("Error checking presence of user %d for user %d: %v", targetID, viewerID, err)
+			continue
+		}
+
+		// Subscribing never reveals more than the privacy settings allow
+		if status == "" {
+			continue
+		}
+
+		pipe := h.redis.Pipeline()
+		pipe.SAdd(ctx, presenceSubscribersKey(targetID), viewerID)
+		pipe.Expire(ctx, presenceSubscribersKey(targetID), presenceSubscriptionTTL)
+		pipe.SAdd(ctx, presenceSubscriptionsKey(viewerID), targetID)
+		pipe.Expire(ctx, presenceSubscriptionsKey(viewerID), presenceSubscriptionTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Printf("Error adding presence subscription for user %d: %v", viewerID, err)
+			continue
+		}
+
+		state, customStatus, err := h.presence.CurrentPresence(ctx, targetID, online[targetID])
+		if err != nil {
+			log.Printf("Error getting presence of user %d: %v", targetID, err)
+			continue
+		}
+
+		snapshot, _ := NewNexyMessage(TypePresence, targetID, nil, PresenceBody{
+			UserID:       targetID,
+			IsOnline:     state != models.PresenceOffline,
+			Status:       status,
+			State:        state,
+			CustomStatus: customStatus,
+		})
+		h.sendToUser(viewerID, snapshot, h.unregisterClientFunc)
+	}
+}
+
+// clearPresenceSubscriptions drops everything a viewer followed once they
+// have no socket left anywhere
+func (h *Hub) clearPresenceSubscriptions(viewerID int) {
+	ctx := context.Background()
+
+	targets, err := h.redis.SMembers(ctx, presenceSubscriptionsKey(viewerID)).Result()
+	if err != nil || len(targets) == 0 {
+		return
+	}
+
+	pipe := h.redis.Pipeline()
+	for _, idStr := range targets {
+		if targetID, err := strconv.Atoi(idStr); err == nil {
+			pipe.SRem(ctx, presenceSubscribersKey(targetID), viewerID)
+		}
+	}
+	pipe.Del(ctx, presenceSubscriptionsKey(viewerID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error clearing presence subscriptions for user %d: %v", viewerID, err)
+	}
+}
@@ -0,0 +1,68 @@
+package nexy
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/vtstv/nexy/internal/models"
+)
+
+// SendScheduledMessage posts a message on the sender's behalf through the same
+// steps as a chat_message frame: access, body, mention and voice checks, the
+// insert via CreateMessageFromWebSocket, then the broadcast. The sender's own
+// devices get it too, since none of them sent it live. Refusals come back as errors with
+// an ErrorCode. A message that already exists is not broadcast again.
+func (h *Hub) SendScheduledMessage(ctx context.Context, messageID string, chatID, senderID int, body json.RawMessage) (int, error) {
+	message := &NexyMessage{
+		Header: NexyHeader{
+			Type:      TypeChatMessage,
+			MessageID: messageID,
+			Timestamp: time.Now().Unix(),
+			SenderID:  senderID,
+			ChatID:    &chatID,
+		},
+		Body: body,
+	}
+
+	if h.authorizer != nil {
+		_, action, _ := h.frameTarget(ctx, message)
+		if err := h.authorizer.Authorize(ctx, chatID, senderID, action); err != nil {
+			return 0, err
+		}
+	}
+
+	_, spec, err := models.ParseMessageBody(body)
+	if err != nil {
+		return 0, err
+	}
+	mentions, err := h.resolveMentions(ctx, chatID, senderID, body)
+	if err != nil {
+		return 0, err
+	}
+	if err := h.checkVoiceAllowed(ctx, chatID, senderID, spec); err != nil {
+		return 0, err
+	}
+	body = withMentions(body, mentions)
+
+	serverID, err := h.messageRepo.CreateMessageFromWebSocket(ctx, messageID, chatID, senderID, body)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			if existing, getErr := h.messageRepo.GetByUUID(ctx, messageID); getErr == nil && existing != nil {
+				log.Printf("Scheduled message %s was already posted, skipping broadcast", messageID)
+				return existing.ID, nil
+			}
+		}
+		return 0, err
+	}
+
+	message.Body = h.withPayload(ctx, withServerID(body, serverID), spec, serverID)
+	h.broadcastToChatMembers(chatID, message)
+	h.deliver([]int{senderID}, message, h.unregisterClientFunc)
+	h.publishThreadUpdate(ctx, chatID, body)
+
+	log.Printf("Scheduled message posted: messageID=%s, serverID=%d, chatID=%d", messageID, serverID, chatID)
+	return serverID, nil
+}
@@ -0,0 +1,230 @@
+package nexy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	streamBufferSize = 500
+	streamTTL        = 24 * time.Hour
+
+	replayRetryInterval = 10 * time.Millisecond
+)
+
+// Every device has its own stream, numbered and buffered apart from the
+// user's other devices, so each resumes from its own last acked sequence. The
+// counters and replay buffers live in Redis so a device can resume on any
+// node.
+func streamSeqKey(userID int, deviceID string) string {
+	return fmt.Sprintf("nexy:stream:seq:%d:%s", userID, deviceID)
+}
+
+func streamBufferKey(userID int, deviceID string) string {
+	return fmt.Sprintf("nexy:stream:buf:%d:%s", userID, deviceID)
+}
+
+// streamDevicesKey holds the user's devices that have a stream, scored by
+// when they were last connected
+func streamDevicesKey(userID int) string {
+	return fmt.Sprintf("nexy:stream:devices:%d", userID)
+}
+
+// ephemeralTypes are frames only worth having live. They get no sequence and
+// stay out of the replay buffer, so they cannot push real events out of it.
+var ephemeralTypes = map[MessageType]bool{
+	TypeTyping:       true,
+	TypeOnline:       true,
+	TypeOffline:      true,
+	TypePresence:     true,
+	TypeICECandidate: true,
+}
+
+// sequenced reports whether the frame belongs in the recipients' streams
+func (m *NexyMessage) sequenced() bool {
+	return !m.ephemeral && !ephemeralTypes[m.Header.Type]
+}
+
+func marshalWithSeq(message *NexyMessage, seq int64) ([]byte, error) {
+	stamped := *message
+	stamped.Header.Seq = seq
+	return json.Marshal(&stamped)
+}
+
+// touchStream records that the device is connected or just left, keeping its
+// stream alive for streamTTL after that. Devices gone for longer stop getting
+// one and have to resync.
+func (h *Hub) touchStream(userID int, deviceID string) {
+	ctx := context.Background()
+	key := streamDevicesKey(userID)
+	now := time.Now()
+
+	pipe := h.redis.Pipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.Unix()), Member: deviceID})
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.Add(-streamTTL).Unix(), 10))
+	pipe.Expire(ctx, key, streamTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error recording stream of user %d, deviceID=%s: %v", userID, deviceID, err)
+	}
+}
+
+// appendToStreams assigns the next sequence number in the stream of each
+// device of the users and stores the stamped frame in that device's bounded
+// replay buffer. It returns the sequences by user and device.
+func (h *Hub) appendToStreams(userIDs []int, message *NexyMessage) map[int]map[string]int64 {
+	seqs := make(map[int]map[string]int64, len(userIDs))
+	if len(userIDs) == 0 || !message.sequenced() {
+		return seqs
+	}
+
+	ctx := context.Background()
+	since := strconv.FormatInt(time.Now().Add(-streamTTL).Unix(), 10)
+	pipe := h.redis.Pipeline()
+	devices := make([]*redis.StringSliceCmd, len(userIDs))
+	for i, userID := range userIDs {
+		devices[i] = pipe.ZRangeByScore(ctx, streamDevicesKey(userID), &redis.ZRangeBy{Min: since, Max: "+inf"})
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		log.Printf("Error listing stream devices: %v", err)
+		return seqs
+	}
+
+	type streamRef struct {
+		userID   int
+		deviceID string
+		incr     *redis.IntCmd
+	}
+	var streams []streamRef
+	pipe = h.redis.Pipeline()
+	for i, userID := range userIDs {
+		for _, deviceID := range devices[i].Val() {
+			streams = append(streams, streamRef{
+				userID:   userID,
+				deviceID: deviceID,
+				incr:     pipe.Incr(ctx, streamSeqKey(userID, deviceID)),
+			})
+		}
+	}
+	if len(streams) == 0 {
+		return seqs
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error allocating stream sequences: %v", err)
+		return seqs
+	}
+
+	pipe = h.redis.Pipeline()
+	for _, stream := range streams {
+		seq := stream.incr.Val()
+		data, err := marshalWithSeq(message, seq)
+		if err != nil {
+			log.Printf("Error marshaling stream frame: %v", err)
+			continue
+		}
+		if seqs[stream.userID] == nil {
+			seqs[stream.userID] = make(map[string]int64)
+		}
+		seqs[stream.userID][stream.deviceID] = seq
+
+		key := streamBufferKey(stream.userID, stream.deviceID)
+		pipe.RPush(ctx, key, data)
+		pipe.LTrim(ctx, key, -streamBufferSize, -1)
+		pipe.Expire(ctx, key, streamTTL)
+		pipe.Expire(ctx, streamSeqKey(stream.userID, stream.deviceID), streamTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error buffering stream frames: %v", err)
+	}
+
+	return seqs
+}
+
+// resumeStream replays the frames a reconnecting device missed after lastSeq,
+// or tells it to resync when they have already fallen out of the buffer
+func (h *Hub) resumeStream(client *Client, lastSeq int64) {
+	defer client.finishResume()
+
+	ctx := context.Background()
+
+	current, err := h.redis.Get(ctx, streamSeqKey(client.userID, client.deviceID)).Int64()
+	if err != nil && err != redis.Nil {
+		log.Printf("Error reading stream sequence for user %d: %v", client.userID, err)
+		h.sendResyncRequired(client, 0)
+		return
+	}
+
+	frames, err := h.redis.LRange(ctx, streamBufferKey(client.userID, client.deviceID), 0, -1).Result()
+	if err != nil {
+		log.Printf("Error reading stream buffer for user %d: %v", client.userID, err)
+		h.sendResyncRequired(client, current)
+		return
+	}
+
+	type missedFrame struct {
+		seq     int64
+		message NexyMessage
+		data    []byte
+	}
+
+	var missed []missedFrame
+	for _, frame := range frames {
+		var msg NexyMessage
+		if err := json.Unmarshal([]byte(frame), &msg); err != nil {
+			continue
+		}
+		if msg.Header.Seq > lastSeq {
+			missed = append(missed, missedFrame{seq: msg.Header.Seq, message: msg, data: []byte(frame)})
+		}
+	}
+	// Frames are appended by several workers and nodes, so the buffer is not
+	// necessarily in sequence order
+	sort.Slice(missed, func(i, j int) bool { return missed[i].seq < missed[j].seq })
+
+	// The gap is unrecoverable if the client is ahead of us or the oldest
+	// missed frame has already been trimmed
+	if lastSeq > current || (lastSeq < current && (len(missed) == 0 || missed[0].seq != lastSeq+1)) {
+		log.Printf("Stream gap for user %d, deviceID=%s: last_seq=%d, current=%d", client.userID, client.deviceID, lastSeq, current)
+		h.sendResyncRequired(client, current)
+		return
+	}
+
+	replayed := 0
+	for _, frame := range missed {
+		data := client.adapt(&frame.message, frame.seq, frame.data)
+		if data == nil {
+			continue
+		}
+		// A client that cannot keep up is dropped; it resumes again from the
+		// last frame it actually received
+		if !client.replay(frame.seq, data) {
+			log.Printf("Stream replay stalled for user %d, deviceID=%s after %d frames, closing", client.userID, client.deviceID, replayed)
+			client.closeConnection()
+			return
+		}
+		replayed++
+	}
+
+	resumed, _ := NewNexyMessage(TypeResumed, 0, nil, ResumedBody{Seq: current, Replayed: replayed})
+	if data, err := json.Marshal(resumed); err == nil {
+		client.replay(0, data)
+	}
+
+	log.Printf("Resumed stream for user %d, deviceID=%s: replayed %d frames", client.userID, client.deviceID, replayed)
+}
+
+func (h *Hub) sendResyncRequired(client *Client, current int64) {
+	msg, _ := NewNexyMessage(TypeResyncRequired, 0, nil, ResyncRequiredBody{Seq: current})
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	client.replay(0, data)
+}
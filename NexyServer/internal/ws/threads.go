@@ -0,0 +1,40 @@
+package nexy
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+)
+
+// publishThreadUpdate sends the new reply counters of the message a chat
+// message replies to, if it is a reply, to every member of the chat
+func (h *Hub) publishThreadUpdate(ctx context.Context, chatID int, bodyJSON []byte) {
+	var body ChatMessageBody
+	if err := json.Unmarshal(bodyJSON, &body); err != nil || body.ReplyToID == nil {
+		return
+	}
+	parentID := *body.ReplyToID
+
+	threads, err := h.messageRepo.GetThreadInfo(ctx, chatID, []int{parentID}, 0)
+	if err != nil {
+		log.Printf("Error loading thread of message %d: %v", parentID, err)
+		return
+	}
+	thread, ok := threads[parentID]
+	if !ok {
+		// The reply points at a message of another chat
+		return
+	}
+
+	update, err := NewNexyMessage(TypeThreadUpdate, 0, &chatID, ThreadUpdateBody{
+		MessageID:         parentID,
+		ReplyCount:        thread.ReplyCount,
+		LastReplyID:       thread.LastReplyID,
+		LastReplySenderID: thread.LastReplySenderID,
+		LastReplyAt:       thread.LastReplyAt.Unix(),
+	})
+	if err != nil {
+		return
+	}
+	h.BroadcastToChat(chatID, update)
+}
@@ -0,0 +1,18 @@
+-- Migration: 010_add_presence_state.sql
+
+-- Explicit presence chosen by the user (or reported by the client when idle)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS presence_state VARCHAR(20) NOT NULL DEFAULT 'online';
+-- presence_state values:
+-- 'online'    - shown as online while connected
+-- 'away'      - client reported the user idle; reset when the last connection closes
+-- 'dnd'       - do not disturb, push notifications are suppressed
+-- 'invisible' - connected but shown as offline
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_presence_state_check;
+ALTER TABLE users ADD CONSTRAINT users_presence_state_check
+    CHECK (presence_state IN ('online', 'away', 'dnd', 'invisible'));
+
+-- Optional custom status, cleared once it expires
+ALTER TABLE users ADD COLUMN IF NOT EXISTS custom_status_text VARCHAR(100);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS custom_status_emoji VARCHAR(32);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS custom_status_expires_at TIMESTAMP;
@@ -0,0 +1,27 @@
+-- Migration: 011_add_calls.sql
+
+-- One row per finished call, written by the signaling layer once the call
+-- reaches a final state
+CREATE TABLE IF NOT EXISTS calls (
+    id SERIAL PRIMARY KEY,
+    call_id VARCHAR(100) UNIQUE NOT NULL,
+    caller_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    callee_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    chat_id INTEGER REFERENCES chats(id) ON DELETE SET NULL,
+    is_video BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('ended', 'missed', 'busy', 'timeout')),
+    end_reason VARCHAR(50),
+    started_at TIMESTAMP NOT NULL,
+    answered_at TIMESTAMP,
+    ended_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+-- status values:
+-- 'ended'   - answered and hung up, or declined by the callee (end_reason 'declined')
+-- 'missed'  - the caller hung up before an answer
+-- 'busy'    - the callee was in another call or had calls turned off
+-- 'timeout' - nobody answered
+
+CREATE INDEX IF NOT EXISTS idx_calls_caller_id ON calls(caller_id, started_at DESC);
+CREATE INDEX IF NOT EXISTS idx_calls_callee_id ON calls(callee_id, started_at DESC);
+CREATE INDEX IF NOT EXISTS idx_calls_chat_id ON calls(chat_id);
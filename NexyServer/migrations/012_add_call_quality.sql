@@ -0,0 +1,21 @@
+-- Migration: 012_add_call_quality.sql
+
+-- WebRTC stats summary each participant posts once a call is over. A later
+-- report for the same call replaces the earlier one.
+CREATE TABLE IF NOT EXISTS call_quality (
+    id SERIAL PRIMARY KEY,
+    call_id VARCHAR(100) NOT NULL REFERENCES calls(call_id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rtt_ms INTEGER,
+    jitter_ms INTEGER,
+    packet_loss REAL,
+    bitrate_kbps INTEGER,
+    candidate_type VARCHAR(10) NOT NULL CHECK (candidate_type IN ('host', 'srflx', 'prflx', 'relay')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(call_id, user_id)
+);
+-- packet_loss is a percentage of packets lost, 0-100
+-- candidate_type is the local candidate of the selected pair; 'relay' means
+-- the media went through TURN
+
+CREATE INDEX IF NOT EXISTS idx_call_quality_created_at ON call_quality(created_at);
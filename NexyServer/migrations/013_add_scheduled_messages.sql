@@ -0,0 +1,29 @@
+-- Migration: 013_add_scheduled_messages.sql
+
+-- Messages composed ahead of time and posted by the server at send_at.
+-- message_id is the UUID the message gets once sent, so a dispatch that is
+-- retried after a crash hits the messages unique key instead of posting twice.
+CREATE TABLE IF NOT EXISTS scheduled_messages (
+    id SERIAL PRIMARY KEY,
+    message_id VARCHAR(100) UNIQUE NOT NULL,
+    chat_id INTEGER NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+    sender_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    body JSONB NOT NULL,
+    send_at TIMESTAMP NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sending', 'sent', 'cancelled', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    claimed_at TIMESTAMP,
+    sent_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+-- status values:
+-- 'pending'   - waiting for send_at; the only state that can be edited or cancelled
+-- 'sending'   - claimed by a dispatcher; reclaimed if claimed_at goes stale
+-- 'sent'      - posted to the chat
+-- 'cancelled' - cancelled by the sender
+-- 'failed'    - refused (e.g. the sender left the chat) or out of retries
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_messages_due ON scheduled_messages(send_at) WHERE status IN ('pending', 'sending');
+CREATE INDEX IF NOT EXISTS idx_scheduled_messages_sender ON scheduled_messages(sender_id, chat_id, send_at);
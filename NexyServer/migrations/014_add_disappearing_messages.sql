@@ -0,0 +1,11 @@
+-- Migration: 014_add_disappearing_messages.sql
+
+-- Per-chat auto-delete timer in seconds, NULL when off. It applies to
+-- messages sent after it was set.
+ALTER TABLE chats ADD COLUMN IF NOT EXISTS message_ttl INTEGER CHECK (message_ttl > 0);
+
+-- When the message is hard-deleted by the expiry sweeper. Set on insert from
+-- the message's own TTL or, failing that, the chat timer.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_messages_expires_at ON messages(expires_at) WHERE expires_at IS NOT NULL;
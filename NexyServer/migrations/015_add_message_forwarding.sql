@@ -0,0 +1,7 @@
+-- Migration: 015_add_message_forwarding.sql
+
+-- Origin of a forwarded message. Forwarding a forward keeps the first origin,
+-- so these always point at where the content was originally posted.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS forwarded_from_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS forwarded_from_chat_id INTEGER REFERENCES chats(id) ON DELETE SET NULL;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS forwarded_date TIMESTAMP;
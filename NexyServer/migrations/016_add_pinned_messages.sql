@@ -0,0 +1,16 @@
+-- Migration: 016_add_pinned_messages.sql
+
+-- A chat can have several pinned messages. for_user_id is NULL for a pin every
+-- member sees; in private chats it may instead name the only user who sees it.
+CREATE TABLE IF NOT EXISTS pinned_messages (
+    id SERIAL PRIMARY KEY,
+    chat_id INTEGER NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    pinned_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    for_user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    pinned_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pinned_messages_shared ON pinned_messages(chat_id, message_id) WHERE for_user_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pinned_messages_own ON pinned_messages(chat_id, message_id, for_user_id) WHERE for_user_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_pinned_messages_chat ON pinned_messages(chat_id, pinned_at DESC);
@@ -0,0 +1,13 @@
+-- Migration: 017_add_reply_threads.sql
+
+-- Replies are looked up by the message they answer
+CREATE INDEX IF NOT EXISTS idx_messages_reply_to_id ON messages(reply_to_id) WHERE reply_to_id IS NOT NULL;
+
+-- The last reply each user has seen in a thread, for "new replies" counts
+CREATE TABLE IF NOT EXISTS thread_read_state (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    last_read_reply_id INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, message_id)
+);
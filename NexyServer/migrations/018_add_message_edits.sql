@@ -0,0 +1,14 @@
+-- Migration: 018_add_message_edits.sql
+
+-- Every version of a message's text that an edit replaced. written_at is when
+-- that version was posted or last edited, edited_at when it was replaced.
+CREATE TABLE IF NOT EXISTS message_edits (
+    id SERIAL PRIMARY KEY,
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    content TEXT,
+    edited_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    written_at TIMESTAMP NOT NULL,
+    edited_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_edits_message_id ON message_edits(message_id, id);
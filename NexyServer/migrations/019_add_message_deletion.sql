@@ -0,0 +1,18 @@
+-- Migration: 019_add_message_deletion.sql
+
+-- Messages a user deleted for themselves only. Everyone else still sees them.
+CREATE TABLE IF NOT EXISTS hidden_messages (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    chat_id INTEGER NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+    hidden_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, message_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_hidden_messages_user_chat ON hidden_messages(user_id, chat_id);
+
+-- Deleting other members' messages is now a right of its own. Existing owners
+-- and admins keep it; those without explicit permissions already have it.
+UPDATE chat_members
+SET permissions = permissions || '{"delete_messages": true}'::jsonb
+WHERE role IN ('owner', 'admin') AND permissions IS NOT NULL;
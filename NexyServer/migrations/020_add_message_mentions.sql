@@ -0,0 +1,15 @@
+-- Migration: 020_add_message_mentions.sql
+
+-- Users a message mentions, one row per span of text naming them. A mention
+-- stays unread until the user jumps to it; the sender's own are born read.
+CREATE TABLE IF NOT EXISTS message_mentions (
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    chat_id INTEGER NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    span_offset INTEGER NOT NULL,
+    span_length INTEGER NOT NULL,
+    is_read BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY (message_id, span_offset)
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_mentions_unread ON message_mentions(user_id, chat_id, message_id) WHERE is_read = false;
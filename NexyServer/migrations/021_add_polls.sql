@@ -0,0 +1,37 @@
+-- Migration: 021_add_polls.sql
+
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_message_type_check;
+ALTER TABLE messages ADD CONSTRAINT messages_message_type_check CHECK (message_type IN ('text', 'media', 'file', 'system', 'voice', 'poll'));
+
+-- The poll of a poll message. The sender of the message created it. A poll
+-- stops taking votes once closed_at is set or close_at has passed.
+CREATE TABLE IF NOT EXISTS polls (
+    id SERIAL PRIMARY KEY,
+    message_id INTEGER NOT NULL UNIQUE REFERENCES messages(id) ON DELETE CASCADE,
+    question TEXT NOT NULL,
+    multiple_choice BOOLEAN NOT NULL DEFAULT false,
+    public_voters BOOLEAN NOT NULL DEFAULT false,
+    quiz BOOLEAN NOT NULL DEFAULT false,
+    correct_option INTEGER,
+    close_at TIMESTAMP,
+    closed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS poll_options (
+    poll_id INTEGER NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+    option_index INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    PRIMARY KEY (poll_id, option_index)
+);
+
+CREATE TABLE IF NOT EXISTS poll_votes (
+    poll_id INTEGER NOT NULL,
+    option_index INTEGER NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    voted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (poll_id, user_id, option_index),
+    FOREIGN KEY (poll_id, option_index) REFERENCES poll_options(poll_id, option_index) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_poll_votes_option ON poll_votes(poll_id, option_index);
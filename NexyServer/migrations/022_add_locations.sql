@@ -0,0 +1,19 @@
+-- Migration: 022_add_locations.sql
+
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_message_type_check;
+ALTER TABLE messages ADD CONSTRAINT messages_message_type_check CHECK (message_type IN ('text', 'media', 'file', 'system', 'voice', 'poll', 'location'));
+
+-- The position a location message shows. Live locations carry live_until and
+-- are updated in place until then, or until stopped_at is set.
+CREATE TABLE IF NOT EXISTS message_locations (
+    message_id INTEGER PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    accuracy DOUBLE PRECISION,
+    venue TEXT,
+    live_until TIMESTAMP,
+    stopped_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_locations_live ON message_locations(live_until) WHERE live_until IS NOT NULL AND stopped_at IS NULL;
@@ -0,0 +1,6 @@
+-- Migration: 023_drop_message_type_check.sql
+
+-- Message types are declared in the server's registry (models.MessageTypeSpec),
+-- which validates every message clients send over WS or REST. The CHECK only
+-- repeated that list and needed a migration for each new type.
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_message_type_check;
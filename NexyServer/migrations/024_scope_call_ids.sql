@@ -0,0 +1,19 @@
+-- Migration: 024_scope_call_ids.sql
+
+-- Call IDs are picked by the caller's client, so two callers can pick the
+-- same one. Calls are unique per caller instead, so a collision no longer
+-- drops another user's call.
+ALTER TABLE call_quality DROP CONSTRAINT IF EXISTS call_quality_call_id_fkey;
+ALTER TABLE call_quality DROP CONSTRAINT IF EXISTS call_quality_call_id_user_id_key;
+ALTER TABLE calls DROP CONSTRAINT IF EXISTS calls_call_id_key;
+ALTER TABLE calls ADD CONSTRAINT calls_caller_id_call_id_key UNIQUE (caller_id, call_id);
+
+CREATE INDEX IF NOT EXISTS idx_calls_call_id ON calls(call_id);
+
+-- Quality reports point at the call by caller and call ID as well
+ALTER TABLE call_quality ADD COLUMN IF NOT EXISTS caller_id INTEGER;
+UPDATE call_quality q SET caller_id = c.caller_id FROM calls c WHERE c.call_id = q.call_id AND q.caller_id IS NULL;
+ALTER TABLE call_quality ALTER COLUMN caller_id SET NOT NULL;
+ALTER TABLE call_quality ADD CONSTRAINT call_quality_call_fkey
+    FOREIGN KEY (caller_id, call_id) REFERENCES calls(caller_id, call_id) ON DELETE CASCADE;
+ALTER TABLE call_quality ADD CONSTRAINT call_quality_caller_id_call_id_user_id_key UNIQUE (caller_id, call_id, user_id);
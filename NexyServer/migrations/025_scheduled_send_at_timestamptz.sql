@@ -0,0 +1,8 @@
+-- Migration: 025_scheduled_send_at_timestamptz.sql
+
+-- send_at was a TIMESTAMP holding UTC, but due messages are found by comparing
+-- it with CURRENT_TIMESTAMP, which is read in the session time zone. Storing
+-- it with its zone makes the comparison right whatever the server's zone.
+-- The values written so far are UTC, as the API converts send_at to UTC.
+ALTER TABLE scheduled_messages
+    ALTER COLUMN send_at TYPE TIMESTAMPTZ USING send_at AT TIME ZONE 'UTC';